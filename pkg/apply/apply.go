@@ -0,0 +1,143 @@
+// Package apply decodes rendered manifests and applies them to a cluster with server-side apply.
+package apply
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+// Applier applies objects through a dynamic client, resolving their resources with a RESTMapper.
+type Applier struct {
+	Client dynamic.Interface
+	Mapper meta.RESTMapper
+	// FieldManager identifies the owner of applied fields, and should be stable across runs.
+	FieldManager string
+	// Namespace is used for namespaced objects that do not declare their own.
+	Namespace string
+}
+
+// Result reports the outcome of applying a single object.
+type Result struct {
+	Object *unstructured.Unstructured
+	Err    error
+}
+
+// Decode splits a multi-document YAML or JSON manifest into objects. Empty documents are skipped and
+// `List` kinds are expanded into their items.
+func Decode(manifest []byte) (objects []*unstructured.Unstructured, err error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
+	for {
+		var raw map[string]interface{}
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return objects, nil
+			}
+			return nil, fmt.Errorf("decoding manifest: %w", err)
+		}
+		if len(raw) == 0 {
+			continue
+		}
+		object := &unstructured.Unstructured{Object: raw}
+		if object.IsList() {
+			list, err := object.ToList()
+			if err != nil {
+				return nil, err
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			continue
+		}
+		if object.GetKind() == "" || object.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("decoding manifest: object is missing kind or apiVersion")
+		}
+		objects = append(objects, object)
+	}
+}
+
+// Apply applies each object in order, continuing past failures so every object gets a result.
+func (a *Applier) Apply(ctx context.Context, objects []*unstructured.Unstructured) []Result {
+	results := make([]Result, len(objects))
+	for i, object := range objects {
+		results[i] = Result{Object: object, Err: a.applyObject(ctx, object)}
+	}
+	return results
+}
+
+func (a *Applier) applyObject(ctx context.Context, object *unstructured.Unstructured) error {
+	resource, err := a.ResourceFor(object)
+	if err != nil {
+		return err
+	}
+	data, err := object.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	force := true
+	applied, err := resource.Patch(ctx, object.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: a.FieldManager,
+		Force:        &force,
+	})
+	if err != nil {
+		return err
+	}
+	if applied != nil {
+		object.SetNamespace(applied.GetNamespace())
+		object.SetUID(applied.GetUID())
+		object.SetResourceVersion(applied.GetResourceVersion())
+	}
+	return nil
+}
+
+// ResourceFor returns the dynamic resource client that serves the given object, defaulting its namespace if needed.
+func (a *Applier) ResourceFor(object *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := object.GroupVersionKind()
+	mapping, err := a.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("resolving resource for %v: %w", gvk, err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return a.Client.Resource(mapping.Resource), nil
+	}
+	if object.GetNamespace() == "" {
+		namespace := a.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		object.SetNamespace(namespace)
+	}
+	return a.Client.Resource(mapping.Resource).Namespace(object.GetNamespace()), nil
+}
+
+// Reference formats an object the way kubectl does, e.g. `deployment.apps/app`.
+func Reference(object *unstructured.Unstructured) string {
+	gvk := object.GroupVersionKind()
+	kind := strings.ToLower(gvk.Kind)
+	if gvk.Group != "" {
+		kind = fmt.Sprintf("%v.%v", kind, gvk.Group)
+	}
+	return fmt.Sprintf("%v/%v", kind, object.GetName())
+}
+
+// PrintResults writes a line per result, returning the number of objects that failed to apply.
+func PrintResults(results []Result, out io.Writer) (failed int) {
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			_, _ = fmt.Fprintf(out, "%v failed: %v\n", Reference(result.Object), result.Err)
+		} else {
+			_, _ = fmt.Fprintf(out, "%v serverside-applied\n", Reference(result.Object))
+		}
+	}
+	return failed
+}
@@ -0,0 +1,136 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const manifest = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: stack-env
+data:
+  ENV: local
+---
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: apps
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: unknown
+`
+
+func testMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	return mapper
+}
+
+// applyReactor emulates server-side apply by returning the applied object, since the fake tracker does not support it.
+func applyReactor(action k8stesting.Action) (bool, runtime.Object, error) {
+	patch := action.(k8stesting.PatchAction)
+	if patch.GetPatchType() != types.ApplyPatchType {
+		return false, nil, nil
+	}
+	object := &unstructured.Unstructured{}
+	if err := object.UnmarshalJSON(patch.GetPatch()); err != nil {
+		return true, nil, err
+	}
+	object.SetResourceVersion("1")
+	return true, object, nil
+}
+
+func TestDecode(t *testing.T) {
+	objects, err := Decode([]byte(manifest))
+	assert.NoError(t, err)
+	assert.Len(t, objects, 3)
+	assert.Equal(t, "stack-env", objects[0].GetName())
+	assert.Equal(t, "Deployment", objects[1].GetKind())
+
+	_, err = Decode([]byte("metadata:\n  name: missing-kind\n"))
+	assert.Error(t, err)
+}
+
+func TestDecodeList(t *testing.T) {
+	objects, err := Decode([]byte(`
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: one
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: two
+`))
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+	assert.Equal(t, "two", objects[1].GetName())
+}
+
+func TestApply(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	client.PrependReactor("patch", "*", applyReactor)
+
+	applier := &Applier{Client: client, Mapper: testMapper(), FieldManager: "app", Namespace: "testns"}
+	objects, err := Decode([]byte(manifest))
+	assert.NoError(t, err)
+
+	results := applier.Apply(context.Background(), objects)
+	assert.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[1].Err)
+	assert.Error(t, results[2].Err)
+	assert.Equal(t, "testns", results[0].Object.GetNamespace())
+	assert.Equal(t, "apps", results[1].Object.GetNamespace())
+
+	var patches []k8stesting.PatchAction
+	for _, action := range client.Actions() {
+		if patch, ok := action.(k8stesting.PatchAction); ok {
+			patches = append(patches, patch)
+		}
+	}
+	assert.Len(t, patches, 2)
+	assert.Equal(t, types.ApplyPatchType, patches[0].GetPatchType())
+	assert.Equal(t, "testns", patches[0].GetNamespace())
+	assert.Equal(t, "configmaps", patches[0].GetResource().Resource)
+
+	var out bytes.Buffer
+	failed := PrintResults(results, &out)
+	assert.Equal(t, 1, failed)
+	assert.Contains(t, out.String(), "configmap/stack-env serverside-applied\n")
+	assert.Contains(t, out.String(), "deployment.apps/app serverside-applied\n")
+	assert.Contains(t, out.String(), "widget.example.com/unknown failed: ")
+}
+
+func TestResourceForClusterScoped(t *testing.T) {
+	applier := &Applier{Client: fake.NewSimpleDynamicClient(runtime.NewScheme()), Mapper: testMapper(), Namespace: "testns"}
+	namespace := &unstructured.Unstructured{}
+	namespace.SetAPIVersion("v1")
+	namespace.SetKind("Namespace")
+	namespace.SetName("apps")
+
+	_, err := applier.ResourceFor(namespace)
+	assert.NoError(t, err)
+	assert.Equal(t, "", namespace.GetNamespace())
+}
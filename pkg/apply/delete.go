@@ -0,0 +1,59 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Delete deletes each object in order with background propagation, continuing past failures so every object gets a result.
+// Objects that no longer exist are reported with a NotFound error.
+func (a *Applier) Delete(ctx context.Context, objects []*unstructured.Unstructured) []Result {
+	results := make([]Result, len(objects))
+	for i, object := range objects {
+		results[i] = Result{Object: object, Err: a.deleteObject(ctx, object)}
+	}
+	return results
+}
+
+func (a *Applier) deleteObject(ctx context.Context, object *unstructured.Unstructured) error {
+	resource, err := a.ResourceFor(object)
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	return resource.Delete(ctx, object.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+}
+
+// PrintDeleted writes a line per result the way `kubectl delete` does, returning the number of objects that failed to delete.
+// Objects that were already gone are not counted as failures.
+func PrintDeleted(results []Result, out io.Writer) (failed int) {
+	for _, result := range results {
+		name := deletedName(result.Object)
+		switch {
+		case result.Err == nil:
+			_, _ = fmt.Fprintf(out, "%v deleted\n", name)
+		case errors.IsNotFound(result.Err):
+			_, _ = fmt.Fprintf(out, "%v already deleted\n", name)
+		default:
+			failed++
+			_, _ = fmt.Fprintf(out, "%v failed: %v\n", name, result.Err)
+		}
+	}
+	return failed
+}
+
+// deletedName formats an object as `kubectl delete` does, e.g. `deployment.apps "app"`
+func deletedName(object *unstructured.Unstructured) string {
+	gvk := object.GroupVersionKind()
+	kind := strings.ToLower(gvk.Kind)
+	if gvk.Group != "" {
+		kind = fmt.Sprintf("%v.%v", kind, gvk.Group)
+	}
+	return fmt.Sprintf("%v %q", kind, object.GetName())
+}
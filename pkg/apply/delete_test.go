@@ -0,0 +1,33 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func TestDelete(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), configMap("existing", nil))
+	applier := &Applier{Client: client, Mapper: testMapper(), Namespace: "testns"}
+
+	results := applier.Delete(context.Background(), []*unstructured.Unstructured{
+		configMap("existing", nil),
+		configMap("missing", nil),
+	})
+
+	var out bytes.Buffer
+	failed := PrintDeleted(results, &out)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, "configmap \"existing\" deleted\nconfigmap \"missing\" already deleted\n", out.String())
+
+	_, err := client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("testns").
+		Get(context.Background(), "existing", metav1.GetOptions{})
+	assert.Error(t, err)
+}
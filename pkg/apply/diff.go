@@ -0,0 +1,113 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// volatileMetadata lists metadata fields set by the API server that would otherwise show up in every diff.
+var volatileMetadata = []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp", "selfLink"}
+
+// Difference describes how applying an object would change its live counterpart.
+type Difference struct {
+	Object *unstructured.Unstructured
+	// Diff is a unified diff from the live object to the object as it would be after applying.
+	// It is empty when applying would change nothing.
+	Diff string
+	Err  error
+}
+
+// Diff compares each object with the cluster by performing a server-side dry-run apply, so that
+// defaulting and fields owned by other managers are reflected in the result.
+func (a *Applier) Diff(ctx context.Context, objects []*unstructured.Unstructured) []Difference {
+	differences := make([]Difference, len(objects))
+	for i, object := range objects {
+		diff, err := a.diffObject(ctx, object)
+		differences[i] = Difference{Object: object, Diff: diff, Err: err}
+	}
+	return differences
+}
+
+func (a *Applier) diffObject(ctx context.Context, object *unstructured.Unstructured) (string, error) {
+	resource, err := a.ResourceFor(object)
+	if err != nil {
+		return "", err
+	}
+
+	live, err := resource.Get(ctx, object.GetName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		live = nil
+	} else if err != nil {
+		return "", err
+	}
+
+	data, err := object.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+	force := true
+	merged, err := resource.Patch(ctx, object.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: a.FieldManager,
+		Force:        &force,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	from, err := normalizedYAML(live)
+	if err != nil {
+		return "", err
+	}
+	to, err := normalizedYAML(merged)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: "live/" + Reference(object),
+		ToFile:   "merged/" + Reference(object),
+		Context:  3,
+	})
+}
+
+func normalizedYAML(object *unstructured.Unstructured) (string, error) {
+	if object == nil {
+		return "", nil
+	}
+	normalized := object.DeepCopy()
+	for _, field := range volatileMetadata {
+		unstructured.RemoveNestedField(normalized.Object, "metadata", field)
+	}
+	out, err := yaml.Marshal(normalized.Object)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// PrintDifferences writes each non-empty diff, returning the number of objects that differ and
+// the number that could not be compared.
+func PrintDifferences(differences []Difference, out io.Writer) (changed, failed int) {
+	for _, difference := range differences {
+		if difference.Err != nil {
+			failed++
+			_, _ = fmt.Fprintf(out, "%v failed: %v\n", Reference(difference.Object), difference.Err)
+			continue
+		}
+		if difference.Diff != "" {
+			changed++
+			_, _ = fmt.Fprint(out, difference.Diff)
+		}
+	}
+	return changed, failed
+}
@@ -0,0 +1,79 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func configMap(name string, data map[string]interface{}) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       "testns",
+			"resourceVersion": "42",
+		},
+		"data": data,
+	}}
+	return object
+}
+
+func TestDiff(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		configMap("unchanged", map[string]interface{}{"ENV": "local"}),
+		configMap("changed", map[string]interface{}{"ENV": "local"}),
+	)
+	client.PrependReactor("patch", "*", applyReactor)
+	applier := &Applier{Client: client, Mapper: testMapper(), FieldManager: "app", Namespace: "testns"}
+
+	objects, err := Decode([]byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+  namespace: testns
+data:
+  ENV: local
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+  namespace: testns
+data:
+  ENV: ci
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: created
+data:
+  ENV: ci
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: unknown
+`))
+	assert.NoError(t, err)
+
+	differences := applier.Diff(context.Background(), objects)
+	assert.Len(t, differences, 4)
+	assert.Empty(t, differences[0].Diff)
+	assert.Contains(t, differences[1].Diff, "-  ENV: local\n+  ENV: ci\n")
+	assert.Contains(t, differences[2].Diff, "--- live/configmap/created\n+++ merged/configmap/created\n")
+	assert.NotContains(t, differences[2].Diff, "resourceVersion")
+	assert.Error(t, differences[3].Err)
+
+	var out bytes.Buffer
+	changed, failed := PrintDifferences(differences, &out)
+	assert.Equal(t, 2, changed)
+	assert.Equal(t, 1, failed)
+}
@@ -0,0 +1,213 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// dockerHubServer is the key Docker stores Docker Hub credentials under
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// AuthConfig holds the credentials for a registry, in the form the Docker Engine API expects them.
+type AuthConfig struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	ServerAddress string `json:"serveraddress,omitempty"`
+}
+
+// RegistryServer returns the registry server of an image reference, such as `localhost:5000` for
+// `localhost:5000/app:latest`, or Docker Hub for references without one.
+func RegistryServer(reference string) string {
+	host, ok := registryHost(reference)
+	if !ok || host == "docker.io" || host == "index.docker.io" {
+		return dockerHubServer
+	}
+	return host
+}
+
+// NamesRegistry reports whether an image reference starts with a registry host, as `localhost:5000/app` does.
+func NamesRegistry(reference string) bool {
+	_, ok := registryHost(reference)
+	return ok
+}
+
+// registryHost returns the first component of a reference when it is a registry host rather than part of the
+// repository name
+func registryHost(reference string) (string, bool) {
+	i := strings.Index(reference, "/")
+	if i < 0 {
+		return "", false
+	}
+	first := reference[:i]
+	return first, strings.ContainsAny(first, ".:") || first == "localhost"
+}
+
+// SplitReference splits an image reference into its repository and tag, defaulting the tag to `latest`.
+func SplitReference(reference string) (repository, tag string) {
+	i := strings.LastIndex(reference, ":")
+	if i < 0 || strings.Contains(reference[i:], "/") {
+		return reference, "latest"
+	}
+	return reference[:i], reference[i+1:]
+}
+
+// CredentialHelper runs a docker credential helper, such as `docker-credential-desktop get`, with the given standard
+// input, returning its standard output
+type CredentialHelper func(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error)
+
+// ReadAuthConfig looks up the credentials stored for a registry server by `docker login`, in the config.json of
+// DOCKER_CONFIG or ~/.docker or the credential helpers it configures. An empty AuthConfig is returned for servers
+// without credentials.
+func ReadAuthConfig(ctx context.Context, server string) (AuthConfig, error) {
+	path, err := DockerConfigPath()
+	if err != nil {
+		return AuthConfig{ServerAddress: server}, nil
+	}
+	auth, err := ReadAuthConfigFile(ctx, path, server, nil)
+	if os.IsNotExist(err) {
+		return AuthConfig{ServerAddress: server}, nil
+	}
+	return auth, err
+}
+
+// DockerConfigPath returns the path of the docker config.json in DOCKER_CONFIG or ~/.docker.
+func DockerConfigPath() (string, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// ReadAuthConfigFile looks up the credentials stored for a registry server in the given docker config.json. The
+// credential helper configured for the server in credHelpers is asked first, then the auths of the file, and then the
+// credsStore helper, as the docker CLI does. helper runs the credential helpers, defaulting to running them from the
+// PATH. An empty AuthConfig is returned for servers without credentials.
+func ReadAuthConfigFile(ctx context.Context, path, server string, helper CredentialHelper) (AuthConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return AuthConfig{}, err
+	}
+
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Auth          string `json:"auth"`
+			IdentityToken string `json:"identitytoken"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(data, &dockerConfig); err != nil {
+		return AuthConfig{}, fmt.Errorf("reading docker config: %w", err)
+	}
+	for key, name := range dockerConfig.CredHelpers {
+		if SameServer(key, server) {
+			return helperAuthConfig(ctx, helper, name, server)
+		}
+	}
+	for key, entry := range dockerConfig.Auths {
+		if !SameServer(key, server) || (entry.Auth == "" && entry.IdentityToken == "") {
+			continue
+		}
+		auth := AuthConfig{ServerAddress: server, IdentityToken: entry.IdentityToken}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return AuthConfig{}, fmt.Errorf("invalid credentials for registry `%v` in docker config: %w", key, err)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return AuthConfig{}, fmt.Errorf("invalid credentials for registry `%v` in docker config", key)
+			}
+			auth.Username, auth.Password = parts[0], parts[1]
+		}
+		return auth, nil
+	}
+	if dockerConfig.CredsStore != "" {
+		return helperAuthConfig(ctx, helper, dockerConfig.CredsStore, server)
+	}
+	return AuthConfig{ServerAddress: server}, nil
+}
+
+// helperAuthConfig asks a docker credential helper for the credentials of a server. Helpers keep identity tokens under
+// the `<token>` user.
+func helperAuthConfig(ctx context.Context, helper CredentialHelper, name, server string) (AuthConfig, error) {
+	if helper == nil {
+		helper = runCredentialHelper
+	}
+	out, err := helper(ctx, []byte(server), "docker-credential-"+name, "get")
+	if err != nil {
+		if strings.Contains(err.Error(), credentialsNotFound) {
+			return AuthConfig{ServerAddress: server}, nil
+		}
+		return AuthConfig{}, fmt.Errorf("reading the credentials for registry `%v` from the `%v` credential helper: %w", server, name, err)
+	}
+	var stored struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &stored); err != nil {
+		return AuthConfig{}, fmt.Errorf("reading the credentials for registry `%v` from the `%v` credential helper: %w", server, name, err)
+	}
+	if stored.Username == "<token>" {
+		return AuthConfig{ServerAddress: server, IdentityToken: stored.Secret}, nil
+	}
+	return AuthConfig{ServerAddress: server, Username: stored.Username, Password: stored.Secret}, nil
+}
+
+// credentialsNotFound is the message credential helpers print for servers they hold no credentials for
+const credentialsNotFound = "credentials not found"
+
+// runCredentialHelper runs a credential helper from the PATH, reporting its output when it fails
+func runCredentialHelper(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// helpers print why they failed on stdout
+		return nil, fmt.Errorf("running %v: %v: %v", name, err, strings.TrimSpace(string(out)+" "+stderr.String()))
+	}
+	return out, nil
+}
+
+// SameServer reports whether two registry servers are the same, ignoring the scheme and path that docker config keys
+// may carry, such as `https://index.docker.io/v1/`, and the different names of Docker Hub.
+func SameServer(a, b string) bool {
+	hub := func(host string) string {
+		if host == "docker.io" || host == dockerHubHost {
+			return serverHost(dockerHubServer)
+		}
+		return host
+	}
+	return hub(serverHost(a)) == hub(serverHost(b))
+}
+
+// serverHost strips the scheme and path that docker config keys may carry, such as `https://index.docker.io/v1/`
+func serverHost(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	return strings.SplitN(server, "/", 2)[0]
+}
+
+// encode returns the credentials in the form of the engine's X-Registry-Auth header
+func (a AuthConfig) encode() (string, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,104 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryServer(t *testing.T) {
+	assert.Equal(t, "localhost:5000", RegistryServer("localhost:5000/app:latest"))
+	assert.Equal(t, "localhost", RegistryServer("localhost/app"))
+	assert.Equal(t, "myregistry.azurecr.io", RegistryServer("myregistry.azurecr.io/team/app:v1"))
+	assert.Equal(t, dockerHubServer, RegistryServer("library/app:v1"))
+	assert.Equal(t, dockerHubServer, RegistryServer("app"))
+	assert.Equal(t, dockerHubServer, RegistryServer("docker.io/library/app"))
+}
+
+func TestSplitReference(t *testing.T) {
+	tests := []struct {
+		reference, repository, tag string
+	}{
+		{"app", "app", "latest"},
+		{"app:v1", "app", "v1"},
+		{"localhost:5000/app", "localhost:5000/app", "latest"},
+		{"localhost:5000/app:v1", "localhost:5000/app", "v1"},
+	}
+	for _, tt := range tests {
+		repository, tag := SplitReference(tt.reference)
+		assert.Equal(t, tt.repository, repository, tt.reference)
+		assert.Equal(t, tt.tag, tag, tt.reference)
+	}
+}
+
+func TestReadAuthConfig(t *testing.T) {
+	dir := tempDir(t)
+	// dXNlcjpwYXNzd29yZA== is user:password
+	writeFiles(t, dir, map[string]string{"config.json": `{"auths": {
+		"https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNzd29yZA=="},
+		"myregistry.azurecr.io": {"identitytoken": "token"}
+	}}`})
+	_ = os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	auth, err := ReadAuthConfig(context.Background(), dockerHubServer)
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{Username: "user", Password: "password", ServerAddress: dockerHubServer}, auth)
+
+	auth, err = ReadAuthConfig(context.Background(), "myregistry.azurecr.io")
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{IdentityToken: "token", ServerAddress: "myregistry.azurecr.io"}, auth)
+
+	auth, err = ReadAuthConfig(context.Background(), "localhost:5000")
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{ServerAddress: "localhost:5000"}, auth)
+
+	auth, err = ReadAuthConfigFile(context.Background(), filepath.Join(dir, "config.json"), "index.docker.io", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", auth.Username)
+
+	_, err = ReadAuthConfigFile(context.Background(), filepath.Join(dir, "missing.json"), "localhost:5000", nil)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReadAuthConfigFromHelpers(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, map[string]string{"config.json": `{
+		"auths": {"https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNzd29yZA=="}, "ghcr.io": {}},
+		"credsStore": "desktop",
+		"credHelpers": {"gcr.io": "gcloud"}
+	}`})
+	var asked []string
+	helper := func(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+		asked = append(asked, name+" "+string(stdin))
+		switch string(stdin) {
+		case "gcr.io":
+			return []byte(`{"ServerURL":"gcr.io","Username":"<token>","Secret":"refresh-token"}`), nil
+		case "ghcr.io":
+			return []byte(`{"ServerURL":"ghcr.io","Username":"bot","Secret":"token"}`), nil
+		}
+		return nil, errors.New("running " + name + ": exit status 1: credentials not found in native keychain")
+	}
+	path := filepath.Join(dir, "config.json")
+
+	auth, err := ReadAuthConfigFile(context.Background(), path, dockerHubServer, helper)
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{Username: "user", Password: "password", ServerAddress: dockerHubServer}, auth)
+
+	auth, err = ReadAuthConfigFile(context.Background(), path, "ghcr.io", helper)
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{Username: "bot", Password: "token", ServerAddress: "ghcr.io"}, auth)
+
+	auth, err = ReadAuthConfigFile(context.Background(), path, "gcr.io", helper)
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{IdentityToken: "refresh-token", ServerAddress: "gcr.io"}, auth)
+
+	auth, err = ReadAuthConfigFile(context.Background(), path, "localhost:5000", helper)
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{ServerAddress: "localhost:5000"}, auth, "servers the helper holds nothing for are anonymous")
+	assert.Equal(t, []string{"docker-credential-desktop ghcr.io", "docker-credential-gcloud gcr.io", "docker-credential-desktop localhost:5000"}, asked)
+}
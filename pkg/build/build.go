@@ -0,0 +1,110 @@
+// Package build builds container images from a Dockerfile and context, either through the Docker Engine API or a
+// BuildKit daemon, streaming structured progress as it goes.
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Builder builds a single image.
+type Builder interface {
+	// Build builds the image described by opts, calling progress for each event as it happens.
+	Build(ctx context.Context, opts Options, progress func(Event)) (Result, error)
+}
+
+// Options describes an image build.
+type Options struct {
+	// ContextDir is the directory sent as the build context.
+	ContextDir string
+	// Dockerfile is the path of the Dockerfile, which may be outside of the context.
+	Dockerfile string
+	// Tags name the built image, in `name:tag` form.
+	Tags []string
+	// BuildArgs are passed to the Dockerfile's ARG instructions.
+	BuildArgs map[string]string
+	// Target is the stage of a multi-stage Dockerfile to build, or empty for the last stage.
+	Target string
+	// Labels are added to the built image.
+	Labels  map[string]string
+	NoCache bool
+	// Push pushes the tagged images to their registries once built.
+	Push bool
+	// Platforms to build for, e.g. `linux/arm64`, or none for the platform of the builder. Building for several
+	// platforms produces a multi-platform image.
+	Platforms []string
+	// Secrets are mounted by `RUN --mount=type=secret` instructions, without being stored in the image.
+	Secrets []Secret
+	// CacheFrom are image references whose layers may be reused as build cache.
+	CacheFrom []string
+}
+
+// Secret is a build secret, read from either a file or an environment variable of the process running the build.
+type Secret struct {
+	// ID is the id the Dockerfile mounts the secret by.
+	ID string
+	// Src is the path of a file holding the secret.
+	Src string
+	// Env is the name of an environment variable holding the secret.
+	Env string
+}
+
+// String formats the secret as the value of a buildctl or buildx `--secret` flag.
+func (s Secret) String() string {
+	if s.Env != "" {
+		return fmt.Sprintf("id=%v,env=%v", s.ID, s.Env)
+	}
+	return fmt.Sprintf("id=%v,src=%v", s.ID, s.Src)
+}
+
+// Result describes a built image.
+type Result struct {
+	// ImageID is the digest of the image configuration, as reported by `docker images`.
+	ImageID string
+	// Digest is the digest of the image manifest, when the builder produced one, such as when the image was pushed.
+	// For multi-platform images it is the digest of the manifest list.
+	Digest string
+	// Platforms maps each platform of a multi-platform image to the digest of its manifest, when known.
+	Platforms map[string]string
+}
+
+// EventType distinguishes the kinds of build progress.
+type EventType string
+
+const (
+	// EventStep reports that a build step started.
+	EventStep EventType = "step"
+	// EventLog carries output of the current step.
+	EventLog EventType = "log"
+	// EventStatus reports progress of a long running operation, such as pulling a base image.
+	EventStatus EventType = "status"
+)
+
+// Event is a unit of build progress.
+type Event struct {
+	Type EventType
+	// Step names the step the event belongs to, e.g. `RUN make`.
+	Step string
+	// Message is the output or status text, without a trailing newline.
+	Message string
+	// Cached is set for events reporting that their step was satisfied from the build cache.
+	Cached bool
+}
+
+// ForOptions returns a builder able to build opts: the Docker Engine API builds a single platform without secrets,
+// so images for several platforms or with secrets are built through buildx instead.
+func ForOptions(builder Builder, opts Options) Builder {
+	if _, ok := builder.(*DockerBuilder); ok && (len(opts.Platforms) > 1 || len(opts.Secrets) > 0) {
+		return &BuildxBuilder{}
+	}
+	return builder
+}
+
+// FromEnvironment returns a BuildKit builder when BUILDKIT_HOST is set, or the Docker Engine configured by DOCKER_HOST.
+func FromEnvironment() (Builder, error) {
+	if host := os.Getenv("BUILDKIT_HOST"); host != "" {
+		return &BuildKitBuilder{Address: host}, nil
+	}
+	return NewDockerBuilder(os.Getenv("DOCKER_HOST"))
+}
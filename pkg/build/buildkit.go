@@ -0,0 +1,227 @@
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BuildKitBuilder builds images with a BuildKit daemon, driving it through `buildctl`.
+type BuildKitBuilder struct {
+	// Address of the daemon, as given to `buildctl --addr`, e.g. `unix:///run/buildkit/buildkitd.sock`.
+	Address string
+	// Command is the buildctl executable, defaulting to `buildctl` on the PATH.
+	Command string
+}
+
+// buildKitStatus is a line of `buildctl --progress rawjson` output, or a trace of a build by the Docker Engine
+type buildKitStatus struct {
+	Vertexes []buildKitVertex       `json:"vertexes"`
+	Statuses []buildKitVertexStatus `json:"statuses"`
+	Logs     []buildKitVertexLog    `json:"logs"`
+}
+
+// buildKitVertex is a step of a BuildKit build
+type buildKitVertex struct {
+	Digest    string     `json:"digest"`
+	Name      string     `json:"name"`
+	Started   *time.Time `json:"started"`
+	Completed *time.Time `json:"completed"`
+	Cached    bool       `json:"cached"`
+	Error     string     `json:"error"`
+}
+
+// buildKitVertexStatus is the progress of a task of a step, such as pulling a layer
+type buildKitVertexStatus struct {
+	Vertex    string     `json:"vertex"`
+	Name      string     `json:"name"`
+	Current   int64      `json:"current"`
+	Total     int64      `json:"total"`
+	Completed *time.Time `json:"completed"`
+}
+
+// buildKitVertexLog is output of a step
+type buildKitVertexLog struct {
+	Vertex string `json:"vertex"`
+	Data   []byte `json:"data"`
+}
+
+// Build runs `buildctl build` with the Dockerfile frontend, storing the result as an image in the daemon and pushing it
+// when requested. buildctl reads registry credentials from the docker config itself.
+func (b *BuildKitBuilder) Build(ctx context.Context, opts Options, progress func(Event)) (Result, error) {
+	command := b.Command
+	if command == "" {
+		command = "buildctl"
+	}
+	return runRawJSONBuild(ctx, progress, func(metadataFile string) *exec.Cmd {
+		return exec.CommandContext(ctx, command, buildKitArgs(b.Address, opts, metadataFile)...)
+	})
+}
+
+// runRawJSONBuild runs a build command reporting `rawjson` progress on stderr and writing BuildKit metadata to the
+// file it is given, as both buildctl and buildx do
+func runRawJSONBuild(ctx context.Context, progress func(Event), command func(metadataFile string) *exec.Cmd) (Result, error) {
+	metadata, err := ioutil.TempFile("", "stack-buildkit-metadata-*.json")
+	if err != nil {
+		return Result{}, err
+	}
+	_ = metadata.Close()
+	defer os.Remove(metadata.Name())
+
+	cmd := command(metadata.Name())
+	name := filepath.Base(cmd.Path)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return Result{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return Result{}, fmt.Errorf("starting %v: %w", name, err)
+	}
+	failures, output := decodeBuildKitProgress(stderr, progress)
+	if err := cmd.Wait(); err != nil {
+		if len(failures) > 0 {
+			return Result{}, fmt.Errorf("%v build failed: %v", name, strings.Join(failures, "; "))
+		}
+		return Result{}, fmt.Errorf("%v build failed: %v: %v", name, err, strings.TrimSpace(output))
+	}
+	return readBuildKitMetadata(metadata.Name())
+}
+
+func buildKitArgs(address string, opts Options, metadataFile string) []string {
+	var args []string
+	if address != "" {
+		args = append(args, "--addr", address)
+	}
+	args = append(args, "build",
+		"--progress", "rawjson",
+		"--frontend", "dockerfile.v0",
+		"--local", "context="+opts.ContextDir,
+		"--local", "dockerfile="+filepath.Dir(opts.Dockerfile),
+		"--opt", "filename="+filepath.Base(opts.Dockerfile),
+		"--metadata-file", metadataFile,
+	)
+	for _, key := range sortedKeys(opts.BuildArgs) {
+		args = append(args, "--opt", fmt.Sprintf("build-arg:%v=%v", key, opts.BuildArgs[key]))
+	}
+	for _, key := range sortedKeys(opts.Labels) {
+		args = append(args, "--opt", fmt.Sprintf("label:%v=%v", key, opts.Labels[key]))
+	}
+	if opts.Target != "" {
+		args = append(args, "--opt", "target="+opts.Target)
+	}
+	if len(opts.Platforms) > 0 {
+		args = append(args, "--opt", "platform="+strings.Join(opts.Platforms, ","))
+	}
+	for _, secret := range opts.Secrets {
+		args = append(args, "--secret", secret.String())
+	}
+	for _, ref := range opts.CacheFrom {
+		args = append(args, "--import-cache", "type=registry,ref="+ref)
+	}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	output := "type=image"
+	if len(opts.Tags) > 0 {
+		output += fmt.Sprintf(`,"name=%v"`, strings.Join(opts.Tags, ","))
+	}
+	if opts.Push {
+		output += ",push=true"
+	}
+	return append(args, "--output", output)
+}
+
+// decodeBuildKitProgress converts rawjson progress into events until the stream ends, returning the errors of failed
+// vertexes and any output that was not progress, such as buildctl's own error messages
+func decodeBuildKitProgress(stream io.Reader, progress func(Event)) (failures []string, output string) {
+	events := newBuildKitEvents(progress)
+	var other bytes.Buffer
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var status buildKitStatus
+		if err := json.Unmarshal(scanner.Bytes(), &status); err != nil {
+			other.Write(scanner.Bytes())
+			other.WriteByte('\n')
+			continue
+		}
+		events.update(status)
+	}
+	return events.failures, other.String()
+}
+
+// buildKitEvents converts BuildKit statuses into events, naming the step of each event by the vertex it belongs to
+type buildKitEvents struct {
+	progress func(Event)
+	names    map[string]string
+	started  map[string]bool
+	// failures are the errors of failed vertexes
+	failures []string
+}
+
+func newBuildKitEvents(progress func(Event)) *buildKitEvents {
+	return &buildKitEvents{progress: progress, names: map[string]string{}, started: map[string]bool{}}
+}
+
+func (e *buildKitEvents) update(status buildKitStatus) {
+	for _, vertex := range status.Vertexes {
+		e.names[vertex.Digest] = vertex.Name
+		if vertex.Started != nil && !e.started[vertex.Digest] {
+			e.started[vertex.Digest] = true
+			e.progress(Event{Type: EventStep, Step: vertex.Name, Message: vertex.Name, Cached: vertex.Cached})
+		}
+		if vertex.Error != "" {
+			e.failures = append(e.failures, fmt.Sprintf("%v: %v", vertex.Name, vertex.Error))
+		}
+	}
+	for _, s := range status.Statuses {
+		message := s.Name
+		if s.Total > 0 {
+			message = fmt.Sprintf("%v %v/%v", message, s.Current, s.Total)
+		}
+		if s.Completed != nil {
+			message += " done"
+		}
+		e.progress(Event{Type: EventStatus, Step: e.names[s.Vertex], Message: message})
+	}
+	for _, log := range status.Logs {
+		for _, line := range strings.Split(strings.TrimRight(string(log.Data), "\n"), "\n") {
+			e.progress(Event{Type: EventLog, Step: e.names[log.Vertex], Message: line})
+		}
+	}
+}
+
+func readBuildKitMetadata(path string) (Result, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Result{}, err
+	}
+	var metadata struct {
+		Digest       string `json:"containerimage.digest"`
+		ConfigDigest string `json:"containerimage.config.digest"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return Result{}, fmt.Errorf("reading buildkit metadata: %w", err)
+	}
+	return Result{ImageID: metadata.ConfigDigest, Digest: metadata.Digest}, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildKitArgs(t *testing.T) {
+	args := buildKitArgs("unix:///run/buildkit/buildkitd.sock", Options{
+		ContextDir: "/src/app",
+		Dockerfile: "/src/docker/Dockerfile.app",
+		Tags:       []string{"app:1.0", "app:latest"},
+		BuildArgs:  map[string]string{"B": "2", "A": "1"},
+		Target:     "release",
+		NoCache:    true,
+		Push:       true,
+		Platforms:  []string{"linux/amd64", "linux/arm64"},
+		Secrets:    []Secret{{ID: "token", Env: "GIT_TOKEN"}},
+		CacheFrom:  []string{"localhost:5000/app:cache"},
+	}, "/tmp/metadata.json")
+
+	assert.Equal(t, strings.Join([]string{
+		"--addr unix:///run/buildkit/buildkitd.sock build --progress rawjson --frontend dockerfile.v0",
+		"--local context=/src/app --local dockerfile=/src/docker --opt filename=Dockerfile.app --metadata-file /tmp/metadata.json",
+		"--opt build-arg:A=1 --opt build-arg:B=2 --opt target=release --opt platform=linux/amd64,linux/arm64",
+		"--secret id=token,env=GIT_TOKEN --import-cache type=registry,ref=localhost:5000/app:cache --no-cache --output type=image,\"name=app:1.0,app:latest\",push=true",
+	}, " "), strings.Join(args, " "))
+}
+
+func TestDecodeBuildKitProgress(t *testing.T) {
+	stream := strings.NewReader(`{"vertexes":[{"digest":"sha256:a","name":"[1/2] FROM docker.io/library/alpine","started":"2021-03-01T12:00:00Z","cached":true}]}
+{"vertexes":[{"digest":"sha256:b","name":"[2/2] RUN make","started":"2021-03-01T12:00:01Z"}],"logs":[{"vertex":"sha256:b","stream":1,"data":"Y2MgLW8gYXBwCm9rCg=="}]}
+{"statuses":[{"id":"extracting","vertex":"sha256:a","name":"extracting","current":5,"total":10}]}
+{"vertexes":[{"digest":"sha256:b","name":"[2/2] RUN make","started":"2021-03-01T12:00:01Z","error":"exit code: 2"}]}
+error: failed to solve
+`)
+	var events []Event
+	failures, output := decodeBuildKitProgress(stream, func(event Event) { events = append(events, event) })
+
+	assert.Equal(t, []Event{
+		{Type: EventStep, Step: "[1/2] FROM docker.io/library/alpine", Message: "[1/2] FROM docker.io/library/alpine", Cached: true},
+		{Type: EventStep, Step: "[2/2] RUN make", Message: "[2/2] RUN make"},
+		{Type: EventLog, Step: "[2/2] RUN make", Message: "cc -o app"},
+		{Type: EventLog, Step: "[2/2] RUN make", Message: "ok"},
+		{Type: EventStatus, Step: "[1/2] FROM docker.io/library/alpine", Message: "extracting 5/10"},
+	}, events)
+	assert.Equal(t, []string{"[2/2] RUN make: exit code: 2"}, failures)
+	assert.Equal(t, "error: failed to solve\n", output)
+}
+
+func TestBuildKitBuild(t *testing.T) {
+	dir := tempDir(t)
+	// a stand-in for buildctl that reports a step and writes the metadata file it is given
+	writeFiles(t, dir, map[string]string{"buildctl": `#!/bin/sh
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--metadata-file" ]; then metadata="$2"; fi
+  shift
+done
+echo '{"vertexes":[{"digest":"sha256:a","name":"[1/1] FROM scratch","started":"2021-03-01T12:00:00Z"}]}' >&2
+echo '{"containerimage.digest":"sha256:manifest","containerimage.config.digest":"sha256:config"}' > "$metadata"
+`})
+	buildctl := filepath.Join(dir, "buildctl")
+	assert.NoError(t, os.Chmod(buildctl, 0755))
+
+	var events []Event
+	builder := &BuildKitBuilder{Command: buildctl}
+	result, err := builder.Build(context.Background(), Options{ContextDir: dir, Dockerfile: filepath.Join(dir, "Dockerfile")}, func(event Event) {
+		events = append(events, event)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Result{ImageID: "sha256:config", Digest: "sha256:manifest"}, result)
+	assert.Len(t, events, 1)
+}
@@ -0,0 +1,73 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// BuildxBuilder builds images with `docker buildx`, which can build for several platforms at once.
+type BuildxBuilder struct {
+	// Builder names the buildx builder instance to use, defaulting to the current one.
+	Builder string
+	// Command is the docker executable, defaulting to `docker` on the PATH.
+	Command string
+}
+
+// Build runs `docker buildx build`. A multi-platform image cannot be loaded into the Docker Engine's image store, so
+// it must be pushed.
+func (b *BuildxBuilder) Build(ctx context.Context, opts Options, progress func(Event)) (Result, error) {
+	if len(opts.Platforms) > 1 && !opts.Push {
+		return Result{}, fmt.Errorf("images for several platforms (%v) can only be pushed, not loaded into docker", strings.Join(opts.Platforms, ", "))
+	}
+	command := b.Command
+	if command == "" {
+		command = "docker"
+	}
+	return runRawJSONBuild(ctx, progress, func(metadataFile string) *exec.Cmd {
+		return exec.CommandContext(ctx, command, buildxArgs(b.Builder, opts, metadataFile)...)
+	})
+}
+
+func buildxArgs(builder string, opts Options, metadataFile string) []string {
+	args := []string{"buildx", "build"}
+	if builder != "" {
+		args = append(args, "--builder", builder)
+	}
+	args = append(args,
+		"--progress", "rawjson",
+		"--metadata-file", metadataFile,
+		"--file", opts.Dockerfile,
+	)
+	for _, tag := range opts.Tags {
+		args = append(args, "--tag", tag)
+	}
+	for _, key := range sortedKeys(opts.BuildArgs) {
+		args = append(args, "--build-arg", fmt.Sprintf("%v=%v", key, opts.BuildArgs[key]))
+	}
+	for _, key := range sortedKeys(opts.Labels) {
+		args = append(args, "--label", fmt.Sprintf("%v=%v", key, opts.Labels[key]))
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	if len(opts.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(opts.Platforms, ","))
+	}
+	for _, secret := range opts.Secrets {
+		args = append(args, "--secret", secret.String())
+	}
+	for _, ref := range opts.CacheFrom {
+		args = append(args, "--cache-from", ref)
+	}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if opts.Push {
+		args = append(args, "--push")
+	} else {
+		args = append(args, "--load")
+	}
+	return append(args, opts.ContextDir)
+}
@@ -0,0 +1,43 @@
+package build
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildxArgs(t *testing.T) {
+	args := buildxArgs("multiarch", Options{
+		ContextDir: "/src/app",
+		Dockerfile: "/src/app/Dockerfile",
+		Tags:       []string{"localhost:5000/app:v1"},
+		BuildArgs:  map[string]string{"VERSION": "1"},
+		Labels:     map[string]string{ContentHashLabel: "abc"},
+		Platforms:  []string{"linux/amd64", "linux/arm64"},
+		Secrets:    []Secret{{ID: "npmrc", Src: "/home/dev/.npmrc"}, {ID: "token", Env: "GIT_TOKEN"}},
+		CacheFrom:  []string{"localhost:5000/app:cache"},
+		Push:       true,
+	}, "/tmp/metadata.json")
+
+	assert.Equal(t, strings.Join([]string{
+		"buildx build --builder multiarch --progress rawjson --metadata-file /tmp/metadata.json --file /src/app/Dockerfile",
+		"--tag localhost:5000/app:v1 --build-arg VERSION=1 --label stack-content-hash=abc --platform linux/amd64,linux/arm64",
+		"--secret id=npmrc,src=/home/dev/.npmrc --secret id=token,env=GIT_TOKEN --cache-from localhost:5000/app:cache --push /src/app",
+	}, " "), strings.Join(args, " "))
+}
+
+func TestBuildxMultiPlatformNeedsPush(t *testing.T) {
+	_, err := (&BuildxBuilder{}).Build(context.Background(), Options{Platforms: []string{"linux/amd64", "linux/arm64"}}, func(Event) {})
+	assert.EqualError(t, err, "images for several platforms (linux/amd64, linux/arm64) can only be pushed, not loaded into docker")
+}
+
+func TestForOptions(t *testing.T) {
+	docker := &DockerBuilder{}
+	buildkit := &BuildKitBuilder{}
+	assert.Equal(t, docker, ForOptions(docker, Options{Platforms: []string{"linux/arm64"}, CacheFrom: []string{"app:cache"}}))
+	assert.Equal(t, &BuildxBuilder{}, ForOptions(docker, Options{Platforms: []string{"linux/amd64", "linux/arm64"}}))
+	assert.Equal(t, &BuildxBuilder{}, ForOptions(docker, Options{Secrets: []Secret{{ID: "token", Env: "GIT_TOKEN"}}}))
+	assert.Equal(t, buildkit, ForOptions(buildkit, Options{Platforms: []string{"linux/amd64", "linux/arm64"}}))
+}
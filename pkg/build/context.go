@@ -0,0 +1,264 @@
+package build
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ignorePattern is a single .dockerignore rule
+type ignorePattern struct {
+	regexp    *regexp.Regexp
+	dirs      int
+	exclusion bool
+}
+
+// Ignore matches context paths against the rules of a .dockerignore file, following Docker's semantics: later rules
+// win, `!` re-includes, `**` matches any number of directories, and a rule matching a directory matches its contents.
+type Ignore struct {
+	patterns      []ignorePattern
+	hasExclusions bool
+}
+
+// ReadIgnore reads the .dockerignore file of a context directory, returning an Ignore that matches nothing if there is none.
+func ReadIgnore(contextDir string) (*Ignore, error) {
+	f, err := os.Open(filepath.Join(contextDir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return &Ignore{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading .dockerignore: %w", err)
+	}
+	return NewIgnore(lines)
+}
+
+// NewIgnore compiles .dockerignore rules. Blank lines and `#` comments are skipped.
+func NewIgnore(lines []string) (*Ignore, error) {
+	ignore := &Ignore{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := ignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			pattern.exclusion = true
+			ignore.hasExclusions = true
+			line = strings.TrimSpace(line[1:])
+		}
+		line = filepath.ToSlash(filepath.Clean(line))
+		line = strings.TrimPrefix(line, "/")
+		if line == "." {
+			continue
+		}
+		re, err := patternRegexp(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern `%v`: %w", line, err)
+		}
+		pattern.regexp = re
+		pattern.dirs = len(strings.Split(line, "/"))
+		ignore.patterns = append(ignore.patterns, pattern)
+	}
+	return ignore, nil
+}
+
+// patternRegexp translates a .dockerignore pattern into an anchored regular expression
+func patternRegexp(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+				}
+				if i+1 == len(pattern) {
+					expr.WriteString(".*")
+				} else {
+					expr.WriteString("(.*/)?")
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		case '[', ']', '-', '^':
+			expr.WriteByte(c)
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// Matches reports whether the slash separated path, relative to the context, is ignored.
+func (ig *Ignore) Matches(path string) bool {
+	path = filepath.ToSlash(path)
+	parents := strings.Split(path, "/")
+	matched := false
+	for _, pattern := range ig.patterns {
+		if pattern.exclusion != matched {
+			continue
+		}
+		match := pattern.regexp.MatchString(path)
+		if !match && len(parents) > 1 && pattern.dirs < len(parents) {
+			match = pattern.regexp.MatchString(strings.Join(parents[:pattern.dirs], "/"))
+		}
+		if match {
+			matched = !pattern.exclusion
+		}
+	}
+	return matched
+}
+
+// ContextFile is a file, directory or symlink included in a build context.
+type ContextFile struct {
+	// Path is slash separated and relative to the context directory.
+	Path string
+	Info os.FileInfo
+}
+
+// ContextFiles lists the entries of a context directory that are not ignored by its .dockerignore, in lexical order.
+// The Dockerfile and .dockerignore are always included, as the builder needs them.
+func ContextFiles(contextDir, dockerfile string) ([]ContextFile, error) {
+	ignore, err := ReadIgnore(contextDir)
+	if err != nil {
+		return nil, err
+	}
+	alwaysIncluded := map[string]bool{".dockerignore": true}
+	if rel, inside := relativeToContext(contextDir, dockerfile); inside {
+		alwaysIncluded[rel] = true
+	}
+
+	var files []ContextFile
+	err = filepath.Walk(contextDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if !alwaysIncluded[rel] && ignore.Matches(rel) {
+			// nothing below an ignored directory can be re-included without an exclusion rule
+			if info.IsDir() && !ignore.hasExclusions {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, ContextFile{Path: rel, Info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// relativeToContext returns the slash separated path of the Dockerfile within the context, if it is inside it
+func relativeToContext(contextDir, dockerfile string) (string, bool) {
+	rel, err := filepath.Rel(contextDir, dockerfile)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// contextDockerfileName returns the path of the Dockerfile within the archive written by WriteContext
+func contextDockerfileName(contextDir, dockerfile string) string {
+	if rel, inside := relativeToContext(contextDir, dockerfile); inside {
+		return rel
+	}
+	return ".stack-dockerfile"
+}
+
+// WriteContext writes the build context as a tar archive, returning the path of the Dockerfile within it.
+// A Dockerfile outside of the context is added to the archive under a generated name.
+func WriteContext(w io.Writer, contextDir, dockerfile string) (dockerfileName string, err error) {
+	files, err := ContextFiles(contextDir, dockerfile)
+	if err != nil {
+		return "", err
+	}
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		if err := addToTar(tw, filepath.Join(contextDir, filepath.FromSlash(file.Path)), file.Path, file.Info); err != nil {
+			return "", err
+		}
+	}
+
+	dockerfileName = contextDockerfileName(contextDir, dockerfile)
+	if _, inside := relativeToContext(contextDir, dockerfile); !inside {
+		info, err := os.Stat(dockerfile)
+		if err != nil {
+			return "", err
+		}
+		if err := addToTar(tw, dockerfile, dockerfileName, info); err != nil {
+			return "", err
+		}
+	}
+	return dockerfileName, tw.Close()
+}
+
+func addToTar(tw *tar.Writer, path, name string, info os.FileInfo) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		link = target
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	// ownership of the local files is meaningless inside the image
+	header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,98 @@
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles creates files with the given contents below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "stack-build-test")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func TestIgnoreMatches(t *testing.T) {
+	ignore, err := NewIgnore([]string{
+		"# comment",
+		"node_modules",
+		"*.log",
+		"**/*.tmp",
+		"/build",
+		"docs/*",
+		"!docs/README.md",
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"node_modules", true},
+		{"node_modules/react/index.js", true},
+		{"src/node_modules", false},
+		{"debug.log", true},
+		{"logs/debug.log", false},
+		{"a/b/c.tmp", true},
+		{"c.tmp", true},
+		{"build/app", true},
+		{"docs/guide.md", true},
+		{"docs/README.md", false},
+		{"main.go", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ignored, ignore.Matches(tt.path), tt.path)
+	}
+}
+
+func TestWriteContext(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, map[string]string{
+		"app/Dockerfile":            "FROM alpine\n",
+		"app/.dockerignore":         "node_modules\nDockerfile\n",
+		"app/main.go":               "package main\n",
+		"app/node_modules/x/x.js":   "",
+		"Dockerfile-outside-of-ctx": "FROM scratch\n",
+	})
+
+	var archive bytes.Buffer
+	name, err := WriteContext(&archive, filepath.Join(dir, "app"), filepath.Join(dir, "app", "Dockerfile"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Dockerfile", name)
+	// the Dockerfile is sent even though it is ignored
+	assert.Equal(t, []string{".dockerignore", "Dockerfile", "main.go"}, tarNames(t, &archive))
+
+	archive.Reset()
+	name, err = WriteContext(&archive, filepath.Join(dir, "app"), filepath.Join(dir, "Dockerfile-outside-of-ctx"))
+	assert.NoError(t, err)
+	assert.Equal(t, ".stack-dockerfile", name)
+	assert.Equal(t, []string{".dockerignore", "main.go", ".stack-dockerfile"}, tarNames(t, &archive))
+}
+
+func tarNames(t *testing.T, archive io.Reader) (names []string) {
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return names
+		}
+		assert.NoError(t, err)
+		names = append(names, header.Name)
+	}
+}
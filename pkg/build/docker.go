@@ -0,0 +1,356 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// DockerBuilder builds images through the Docker Engine API, with the engine's BuildKit.
+type DockerBuilder struct {
+	// Client sends requests to the engine, and must be able to reach BaseURL.
+	Client  *http.Client
+	BaseURL string
+}
+
+// NewDockerBuilder returns a builder for the engine at host, given in DOCKER_HOST form such as
+// `unix:///var/run/docker.sock` or `tcp://127.0.0.1:2375`. An empty host uses the default socket.
+func NewDockerBuilder(host string) (*DockerBuilder, error) {
+	if host == "" {
+		host = defaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host `%v`: %w", host, err)
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &DockerBuilder{Client: &http.Client{Transport: transport}, BaseURL: "http://docker"}, nil
+	case "tcp", "http":
+		return &DockerBuilder{Client: &http.Client{}, BaseURL: "http://" + u.Host}, nil
+	}
+	return nil, fmt.Errorf("unsupported docker host `%v`: only unix and tcp hosts are supported", host)
+}
+
+// dockerMessage is a line of the JSON stream returned by the build endpoint
+type dockerMessage struct {
+	Stream   string     `json:"stream"`
+	Status   string     `json:"status"`
+	ID       string     `json:"id"`
+	Progress string     `json:"progress"`
+	Error    string     `json:"error"`
+	Aux      *dockerAux `json:"aux"`
+}
+
+// dockerAux is the auxiliary data of a message: the ID of a built image, the digest of a pushed one, or the progress
+// of a BuildKit build
+type dockerAux struct {
+	ID     string `json:"ID"`
+	Digest string `json:"Digest"`
+	// Trace is the protobuf encoded progress of a BuildKit build, which the engine sends base64 encoded
+	Trace []byte `json:"-"`
+}
+
+func (a *dockerAux) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &a.Trace)
+	}
+	type fields dockerAux
+	return json.Unmarshal(data, (*fields)(a))
+}
+
+// Build sends the context to the engine's build endpoint and streams its output as events, then pushes each tag when
+// requested.
+func (b *DockerBuilder) Build(ctx context.Context, opts Options, progress func(Event)) (Result, error) {
+	result, err := b.build(ctx, opts, progress)
+	if err != nil || !opts.Push {
+		return result, err
+	}
+	for _, tag := range opts.Tags {
+		digest, err := b.push(ctx, tag, progress)
+		if err != nil {
+			return result, err
+		}
+		result.Digest = digest
+	}
+	return result, nil
+}
+
+func (b *DockerBuilder) build(ctx context.Context, opts Options, progress func(Event)) (Result, error) {
+	query, err := buildQuery(opts, contextDockerfileName(opts.ContextDir, opts.Dockerfile))
+	if err != nil {
+		return Result{}, err
+	}
+
+	// the context is archived as the engine reads it, and closing the reader stops archiving if the engine gives up early
+	body, writer := io.Pipe()
+	defer body.Close()
+	go func() {
+		_, err := WriteContext(writer, opts.ContextDir, opts.Dockerfile)
+		_ = writer.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.BaseURL+"/build?"+query.Encode(), body)
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("sending build to docker: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return Result{}, fmt.Errorf("docker build failed: %v", dockerError(message))
+	}
+
+	return decodeDockerStream(resp.Body, progress)
+}
+
+func buildQuery(opts Options, dockerfileName string) (url.Values, error) {
+	query := url.Values{}
+	for _, tag := range opts.Tags {
+		query.Add("t", tag)
+	}
+	query.Set("dockerfile", dockerfileName)
+	// version 2 builds with BuildKit, which Dockerfiles using RUN --mount, heredocs or other BuildKit syntax need
+	query.Set("version", "2")
+	query.Set("rm", "1")
+	if opts.NoCache {
+		query.Set("nocache", "1")
+	}
+	if opts.Target != "" {
+		query.Set("target", opts.Target)
+	}
+	switch len(opts.Platforms) {
+	case 0:
+	case 1:
+		query.Set("platform", opts.Platforms[0])
+	default:
+		return nil, fmt.Errorf("the docker engine builds a single platform, use buildx or BuildKit to build for %v", strings.Join(opts.Platforms, ", "))
+	}
+	if len(opts.Secrets) > 0 {
+		return nil, fmt.Errorf("the docker engine cannot mount build secrets, use buildx or BuildKit")
+	}
+	if len(opts.CacheFrom) > 0 {
+		cacheFrom, err := json.Marshal(opts.CacheFrom)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("cachefrom", string(cacheFrom))
+	}
+	if len(opts.BuildArgs) > 0 {
+		buildArgs, err := json.Marshal(opts.BuildArgs)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("buildargs", string(buildArgs))
+	}
+	if len(opts.Labels) > 0 {
+		labels, err := json.Marshal(opts.Labels)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("labels", string(labels))
+	}
+	return query, nil
+}
+
+// decodeDockerStream converts the engine's JSON message stream into events, returning the built image ID. BuildKit
+// builds report their progress as traces, and the classic builder as lines of output.
+func decodeDockerStream(stream io.Reader, progress func(Event)) (Result, error) {
+	var result Result
+	var step string
+	events := newBuildKitEvents(progress)
+	decoder := json.NewDecoder(stream)
+	for {
+		var message dockerMessage
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return result, fmt.Errorf("reading docker build output: %w", err)
+		}
+		switch {
+		case message.Error != "":
+			return result, fmt.Errorf("docker build failed: %v", strings.TrimSpace(message.Error))
+		case message.ID == buildKitTraceID && message.Aux != nil:
+			status, err := decodeBuildKitTrace(message.Aux.Trace)
+			if err != nil {
+				return result, fmt.Errorf("reading docker build output: %w", err)
+			}
+			events.update(status)
+		case message.Aux != nil && message.Aux.ID != "":
+			result.ImageID = message.Aux.ID
+		case message.Stream != "":
+			for _, line := range strings.Split(strings.TrimRight(message.Stream, "\n"), "\n") {
+				if strings.HasPrefix(line, "Step ") {
+					step = line
+					progress(Event{Type: EventStep, Step: step, Message: line})
+					continue
+				}
+				cached := strings.TrimSpace(line) == "---> Using cache"
+				progress(Event{Type: EventLog, Step: step, Message: line, Cached: cached})
+			}
+		case message.Status != "":
+			progress(Event{Type: EventStatus, Step: step, Message: statusText(message)})
+		}
+	}
+	if result.ImageID == "" {
+		return result, fmt.Errorf("docker build finished without reporting an image")
+	}
+	return result, nil
+}
+
+// push pushes a tagged image to its registry, returning the digest of the pushed manifest
+func (b *DockerBuilder) push(ctx context.Context, reference string, progress func(Event)) (string, error) {
+	auth, err := ReadAuthConfig(ctx, RegistryServer(reference))
+	if err != nil {
+		return "", err
+	}
+	header, err := auth.encode()
+	if err != nil {
+		return "", err
+	}
+	repository, tag := SplitReference(reference)
+	query := url.Values{"tag": []string{tag}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.BaseURL+"/images/"+repository+"/push?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Registry-Auth", header)
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("pushing `%v`: %w", reference, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("pushing `%v` failed: %v", reference, dockerError(message))
+	}
+
+	step := "push " + reference
+	progress(Event{Type: EventStep, Step: step, Message: step})
+	var digest string
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message dockerMessage
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", fmt.Errorf("reading docker push output: %w", err)
+		}
+		switch {
+		case message.Error != "":
+			return "", fmt.Errorf("pushing `%v` failed: %v", reference, strings.TrimSpace(message.Error))
+		case message.Aux != nil && message.Aux.Digest != "":
+			digest = message.Aux.Digest
+		case message.Status != "":
+			progress(Event{Type: EventStatus, Step: step, Message: statusText(message)})
+		}
+	}
+	if digest == "" {
+		return "", fmt.Errorf("pushing `%v` finished without reporting a digest", reference)
+	}
+	return digest, nil
+}
+
+// Inspect looks up an image in the engine's local image store.
+func (b *DockerBuilder) Inspect(ctx context.Context, reference string) (ImageInfo, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.BaseURL+"/images/"+reference+"/json", nil)
+	if err != nil {
+		return ImageInfo{}, false, err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return ImageInfo{}, false, fmt.Errorf("inspecting `%v`: %w", reference, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ImageInfo{}, false, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ImageInfo{}, false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ImageInfo{}, false, fmt.Errorf("inspecting `%v` failed: %v", reference, dockerError(body))
+	}
+
+	var image struct {
+		ID          string   `json:"Id"`
+		RepoDigests []string `json:"RepoDigests"`
+		Config      struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(body, &image); err != nil {
+		return ImageInfo{}, false, fmt.Errorf("inspecting `%v`: %w", reference, err)
+	}
+	info := ImageInfo{ID: image.ID, Labels: image.Config.Labels}
+	repository, _ := SplitReference(reference)
+	for _, repoDigest := range image.RepoDigests {
+		if strings.HasPrefix(repoDigest, repository+"@") {
+			info.Digest = strings.TrimPrefix(repoDigest, repository+"@")
+		}
+	}
+	return info, true, nil
+}
+
+// Export streams the image a reference names from the engine as a `docker save` archive.
+func (b *DockerBuilder) Export(ctx context.Context, reference string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.BaseURL+"/images/"+reference+"/get", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("exporting `%v`: %w", reference, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("exporting `%v` failed: %v", reference, dockerError(body))
+	}
+	return resp.Body, nil
+}
+
+// statusText formats a status message of the engine, such as `31603596830f: Pushing [=>  ]`
+func statusText(message dockerMessage) string {
+	text := message.Status
+	if message.ID != "" {
+		text = fmt.Sprintf("%v: %v", message.ID, text)
+	}
+	if message.Progress != "" {
+		text = fmt.Sprintf("%v %v", text, message.Progress)
+	}
+	return text
+}
+
+// dockerError extracts the message of an engine error response
+func dockerError(body []byte) string {
+	var response struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && response.Message != "" {
+		return response.Message
+	}
+	return strings.TrimSpace(string(body))
+}
@@ -0,0 +1,247 @@
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerBuild(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, map[string]string{"Dockerfile": "FROM alpine\n", "main.go": "package main\n"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/build", r.URL.Path)
+		assert.Equal(t, []string{"app:latest"}, r.URL.Query()["t"])
+		assert.Equal(t, "Dockerfile", r.URL.Query().Get("dockerfile"))
+		assert.Equal(t, "dev", r.URL.Query().Get("target"))
+		assert.Equal(t, `["app:cache"]`, r.URL.Query().Get("cachefrom"))
+		var buildArgs map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(r.URL.Query().Get("buildargs")), &buildArgs))
+		assert.Equal(t, map[string]string{"VERSION": "1.0"}, buildArgs)
+
+		var names []string
+		reader := tar.NewReader(r.Body)
+		for header, err := reader.Next(); err == nil; header, err = reader.Next() {
+			names = append(names, header.Name)
+		}
+		assert.Equal(t, []string{"Dockerfile", "main.go"}, names)
+
+		for _, line := range []string{
+			`{"stream":"Step 1/2 : FROM alpine\n"}`,
+			`{"status":"Pulling fs layer","id":"31603596830f","progress":"[>   ]"}`,
+			`{"stream":" ---> a24bb4013296\n"}`,
+			`{"stream":"Step 2/2 : COPY main.go .\n"}`,
+			`{"stream":" ---> Using cache\n"}`,
+			`{"aux":{"ID":"sha256:4d2ac5f0"}}`,
+			`{"stream":"Successfully built 4d2ac5f0\n"}`,
+		} {
+			_, _ = fmt.Fprintln(w, line)
+		}
+	}))
+	defer server.Close()
+
+	builder, err := NewDockerBuilder(strings.Replace(server.URL, "http://", "tcp://", 1))
+	assert.NoError(t, err)
+
+	var events []Event
+	result, err := builder.Build(context.Background(), Options{
+		ContextDir: dir,
+		Dockerfile: filepath.Join(dir, "Dockerfile"),
+		Tags:       []string{"app:latest"},
+		BuildArgs:  map[string]string{"VERSION": "1.0"},
+		Target:     "dev",
+		CacheFrom:  []string{"app:cache"},
+	}, func(event Event) { events = append(events, event) })
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:4d2ac5f0", result.ImageID)
+
+	assert.Equal(t, Event{Type: EventStep, Step: "Step 1/2 : FROM alpine", Message: "Step 1/2 : FROM alpine"}, events[0])
+	assert.Equal(t, Event{Type: EventStatus, Step: "Step 1/2 : FROM alpine", Message: "31603596830f: Pulling fs layer [>   ]"}, events[1])
+	assert.Equal(t, Event{Type: EventLog, Step: "Step 2/2 : COPY main.go .", Message: " ---> Using cache", Cached: true}, events[4])
+}
+
+// protoField appends a length-delimited or varint protobuf field to a message
+func protoField(message []byte, number int, value interface{}) []byte {
+	uvarint := func(message []byte, x uint64) []byte {
+		buf := make([]byte, binary.MaxVarintLen64)
+		return append(message, buf[:binary.PutUvarint(buf, x)]...)
+	}
+	switch value := value.(type) {
+	case []byte:
+		message = uvarint(message, uint64(number<<3|2))
+		message = uvarint(message, uint64(len(value)))
+		return append(message, value...)
+	case string:
+		return protoField(message, number, []byte(value))
+	case int:
+		message = uvarint(message, uint64(number<<3))
+		return uvarint(message, uint64(value))
+	}
+	panic("unsupported protobuf field")
+}
+
+func TestDockerBuildKitBuild(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, map[string]string{"Dockerfile": "FROM alpine\nRUN --mount=type=cache,target=/root/.cache true\n"})
+
+	started := protoField(nil, 1, 1700000000)
+	vertex := protoField(protoField(protoField(nil, 1, "sha256:run"), 3, "[2/2] RUN true"), 5, started)
+	status := protoField(protoField(protoField(nil, 2, "sha256:run"), 3, "extracting"), 5, 10)
+	log := protoField(protoField(nil, 1, "sha256:run"), 4, "hello\n")
+	trace := protoField(protoField(protoField(nil, 1, vertex), 2, status), 3, log)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("version"), "builds use BuildKit")
+		for _, line := range []string{
+			fmt.Sprintf(`{"id":"moby.buildkit.trace","aux":%q}`, base64.StdEncoding.EncodeToString(trace)),
+			`{"id":"moby.image.id","aux":{"ID":"sha256:4d2ac5f0"}}`,
+		} {
+			_, _ = fmt.Fprintln(w, line)
+		}
+	}))
+	defer server.Close()
+
+	builder, err := NewDockerBuilder(strings.Replace(server.URL, "http://", "tcp://", 1))
+	assert.NoError(t, err)
+	var events []Event
+	result, err := builder.Build(context.Background(), Options{ContextDir: dir, Dockerfile: filepath.Join(dir, "Dockerfile"), Tags: []string{"app:latest"}}, func(event Event) { events = append(events, event) })
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:4d2ac5f0", result.ImageID)
+	assert.Equal(t, []Event{
+		{Type: EventStep, Step: "[2/2] RUN true", Message: "[2/2] RUN true"},
+		{Type: EventStatus, Step: "[2/2] RUN true", Message: "extracting 0/10"},
+		{Type: EventLog, Step: "[2/2] RUN true", Message: "hello"},
+	}, events)
+
+	_, err = decodeDockerStream(strings.NewReader(`{"id":"moby.buildkit.trace","aux":"/w=="}`), func(Event) {})
+	assert.EqualError(t, err, "reading docker build output: invalid buildkit trace")
+}
+
+func TestDockerBuildError(t *testing.T) {
+	_, err := decodeDockerStream(strings.NewReader(`{"stream":"Step 1/1 : RUN false\n"}
+{"errorDetail":{"code":1,"message":"returned a non-zero code: 1"},"error":"The command '/bin/sh -c false' returned a non-zero code: 1"}
+`), func(Event) {})
+	assert.EqualError(t, err, "docker build failed: The command '/bin/sh -c false' returned a non-zero code: 1")
+}
+
+func TestNewDockerBuilder(t *testing.T) {
+	builder, err := NewDockerBuilder("")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://docker", builder.BaseURL)
+
+	_, err = NewDockerBuilder("ssh://user@host")
+	assert.EqualError(t, err, "unsupported docker host `ssh://user@host`: only unix and tcp hosts are supported")
+}
+
+func TestDockerPush(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, map[string]string{"Dockerfile": "FROM alpine\n"})
+	_ = os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/build":
+			_, _ = fmt.Fprintln(w, `{"aux":{"ID":"sha256:4d2ac5f0"}}`)
+		case "/images/localhost:5000/app/push":
+			assert.Equal(t, "v1", r.URL.Query().Get("tag"))
+			auth, err := base64.URLEncoding.DecodeString(r.Header.Get("X-Registry-Auth"))
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"serveraddress":"localhost:5000"}`, string(auth))
+			_, _ = fmt.Fprintln(w, `{"status":"Pushing","id":"31603596830f","progress":"[=>  ]"}`)
+			_, _ = fmt.Fprintln(w, `{"status":"v1: digest: sha256:9a83 size: 528"}`)
+			_, _ = fmt.Fprintln(w, `{"progressDetail":{},"aux":{"Tag":"v1","Digest":"sha256:9a83","Size":528}}`)
+		default:
+			t.Errorf("unexpected request to %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	builder, err := NewDockerBuilder(strings.Replace(server.URL, "http://", "tcp://", 1))
+	assert.NoError(t, err)
+	var events []Event
+	result, err := builder.Build(context.Background(), Options{
+		ContextDir: dir,
+		Dockerfile: filepath.Join(dir, "Dockerfile"),
+		Tags:       []string{"localhost:5000/app:v1"},
+		Push:       true,
+	}, func(event Event) { events = append(events, event) })
+	assert.NoError(t, err)
+	assert.Equal(t, Result{ImageID: "sha256:4d2ac5f0", Digest: "sha256:9a83"}, result)
+	assert.Equal(t, Event{Type: EventStep, Step: "push localhost:5000/app:v1", Message: "push localhost:5000/app:v1"}, events[0])
+	assert.Equal(t, "31603596830f: Pushing [=>  ]", events[1].Message)
+}
+
+func TestDockerPushError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, `{"errorDetail":{"message":"unauthorized"},"error":"unauthorized: authentication required"}`)
+	}))
+	defer server.Close()
+
+	builder, err := NewDockerBuilder(strings.Replace(server.URL, "http://", "tcp://", 1))
+	assert.NoError(t, err)
+	_, err = builder.push(context.Background(), "registry.example.com/app", func(Event) {})
+	assert.EqualError(t, err, "pushing `registry.example.com/app` failed: unauthorized: authentication required")
+}
+
+func TestDockerInspect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/images/localhost:5000/app:v1/json":
+			_, _ = fmt.Fprint(w, `{"Id":"sha256:4d2a","RepoDigests":["localhost:5000/app@sha256:9a83"],"Config":{"Labels":{"stack-content-hash":"abc"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"message":"No such image"}`)
+		}
+	}))
+	defer server.Close()
+
+	builder, err := NewDockerBuilder(strings.Replace(server.URL, "http://", "tcp://", 1))
+	assert.NoError(t, err)
+	info, found, err := builder.Inspect(context.Background(), "localhost:5000/app:v1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, ImageInfo{ID: "sha256:4d2a", Digest: "sha256:9a83", Labels: map[string]string{ContentHashLabel: "abc"}}, info)
+
+	_, found, err = builder.Inspect(context.Background(), "app:v2")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestDockerExport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/images/app:v1/get":
+			_, _ = fmt.Fprint(w, "archive")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"message":"reference does not exist"}`)
+		}
+	}))
+	defer server.Close()
+
+	builder, err := NewDockerBuilder(strings.Replace(server.URL, "http://", "tcp://", 1))
+	assert.NoError(t, err)
+	archive, err := builder.Export(context.Background(), "app:v1")
+	assert.NoError(t, err)
+	content, err := ioutil.ReadAll(archive)
+	assert.NoError(t, err)
+	assert.NoError(t, archive.Close())
+	assert.Equal(t, "archive", string(content))
+
+	_, err = builder.Export(context.Background(), "app:v2")
+	assert.EqualError(t, err, "exporting `app:v2` failed: reference does not exist")
+}
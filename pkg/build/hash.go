@@ -0,0 +1,77 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ContentHashLabel is the image label recording the content hash an image was built from.
+const ContentHashLabel = "stack-content-hash"
+
+// ContentHash returns a hash of everything that determines the result of a build: the Dockerfile, the files of the
+// context that are not ignored by its .dockerignore, the build args, the target and the platforms. Images built from the same
+// content hash are interchangeable, so a build can be skipped when an image with the hash already exists.
+func ContentHash(opts Options) (string, error) {
+	h := sha256.New()
+
+	field(h, "dockerfile")
+	if err := hashFile(h, opts.Dockerfile); err != nil {
+		return "", err
+	}
+
+	files, err := ContextFiles(opts.ContextDir, opts.Dockerfile)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		field(h, "file", file.Path, file.Info.Mode().String())
+		path := filepath.Join(opts.ContextDir, filepath.FromSlash(file.Path))
+		switch {
+		case file.Info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", err
+			}
+			field(h, target)
+		case file.Info.Mode().IsRegular():
+			if err := hashFile(h, path); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(opts.BuildArgs) {
+		field(h, "arg", key, opts.BuildArgs[key])
+	}
+	field(h, "target", opts.Target)
+	field(h, "platforms")
+	field(h, opts.Platforms...)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// field writes length prefixed values, so that the boundaries between values are part of the hash
+func field(h hash.Hash, values ...string) {
+	for _, value := range values {
+		_, _ = fmt.Fprintf(h, "%d:%s", len(value), value)
+	}
+}
+
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(h, "%d:", info.Size())
+	_, err = io.Copy(h, f)
+	return err
+}
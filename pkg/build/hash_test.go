@@ -0,0 +1,45 @@
+package build
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentHash(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, map[string]string{
+		"Dockerfile":    "FROM alpine\n",
+		".dockerignore": "*.log\n",
+		"main.go":       "package main\n",
+	})
+	opts := Options{ContextDir: dir, Dockerfile: filepath.Join(dir, "Dockerfile"), Tags: []string{"app:v1"}}
+	hash := func(opts Options) string {
+		h, err := ContentHash(opts)
+		assert.NoError(t, err)
+		return h
+	}
+	original := hash(opts)
+	assert.Len(t, original, 64)
+
+	// ignored files and tags do not change the hash
+	writeFiles(t, dir, map[string]string{"debug.log": "ignored"})
+	opts.Tags = []string{"app:v2"}
+	assert.Equal(t, original, hash(opts))
+
+	withArg := opts
+	withArg.BuildArgs = map[string]string{"VERSION": "1"}
+	assert.NotEqual(t, original, hash(withArg))
+
+	withTarget := opts
+	withTarget.Target = "release"
+	assert.NotEqual(t, original, hash(withTarget))
+
+	withPlatforms := opts
+	withPlatforms.Platforms = []string{"linux/arm64"}
+	assert.NotEqual(t, original, hash(withPlatforms))
+
+	writeFiles(t, dir, map[string]string{"main.go": "package main // changed\n"})
+	assert.NotEqual(t, original, hash(opts))
+}
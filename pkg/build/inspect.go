@@ -0,0 +1,28 @@
+package build
+
+import (
+	"context"
+	"io"
+)
+
+// ImageInfo describes an existing image.
+type ImageInfo struct {
+	ID string
+	// Digest is the digest of the image manifest in its registry, if known.
+	Digest string
+	Labels map[string]string
+	// Platforms maps each platform of a multi-platform image to the digest of its manifest.
+	Platforms map[string]string
+}
+
+// Inspector looks up existing images.
+type Inspector interface {
+	// Inspect returns the image a reference names, reporting false if there is none.
+	Inspect(ctx context.Context, reference string) (ImageInfo, bool, error)
+}
+
+// Exporter reads images out of a local image store.
+type Exporter interface {
+	// Export streams the image a reference names as a `docker save` archive, which the caller must close.
+	Export(ctx context.Context, reference string) (io.ReadCloser, error)
+}
@@ -0,0 +1,259 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	manifestV2    = "application/vnd.docker.distribution.manifest.v2+json"
+	manifestList  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ociManifest   = "application/vnd.oci.image.manifest.v1+json"
+	ociIndex      = "application/vnd.oci.image.index.v1+json"
+	dockerHubHost = "registry-1.docker.io"
+)
+
+// RegistryClient looks up images in their registries through the registry HTTP API, authenticating with the
+// credentials stored by `docker login`.
+type RegistryClient struct {
+	Client *http.Client
+}
+
+// NewRegistryClient returns a registry client using the default HTTP client.
+func NewRegistryClient() *RegistryClient {
+	return &RegistryClient{Client: http.DefaultClient}
+}
+
+// Inspect fetches the manifest and configuration of an image from its registry. For multi-platform images the
+// configuration of the first platform is returned, along with the digest of the index.
+func (r *RegistryClient) Inspect(ctx context.Context, reference string) (ImageInfo, bool, error) {
+	server := RegistryServer(reference)
+	auth, err := ReadAuthConfig(ctx, server)
+	if err != nil {
+		return ImageInfo{}, false, err
+	}
+	repository, tag := SplitReference(reference)
+	session := &registrySession{client: r.Client, auth: auth, base: registryBaseURL(server), repository: repositoryPath(repository)}
+
+	var manifest struct {
+		MediaType string `json:"mediaType"`
+		Config    struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Manifests []struct {
+			Digest   string `json:"digest"`
+			Platform *struct {
+				OS           string `json:"os"`
+				Architecture string `json:"architecture"`
+				Variant      string `json:"variant"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	digest, found, err := session.get(ctx, "manifests/"+tag, strings.Join([]string{manifestV2, manifestList, ociManifest, ociIndex}, ", "), &manifest)
+	if err != nil || !found {
+		return ImageInfo{}, found, err
+	}
+	var platforms map[string]string
+	for _, m := range manifest.Manifests {
+		// attestation manifests are listed with an unknown platform
+		if m.Platform == nil || m.Platform.OS == "unknown" {
+			continue
+		}
+		platform := m.Platform.OS + "/" + m.Platform.Architecture
+		if m.Platform.Variant != "" {
+			platform += "/" + m.Platform.Variant
+		}
+		if platforms == nil {
+			platforms = map[string]string{}
+		}
+		platforms[platform] = m.Digest
+	}
+	if len(manifest.Manifests) > 0 {
+		if _, found, err = session.get(ctx, "manifests/"+manifest.Manifests[0].Digest, strings.Join([]string{manifestV2, ociManifest}, ", "), &manifest); err != nil || !found {
+			return ImageInfo{}, found, err
+		}
+	}
+
+	var imageConfig struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if _, found, err = session.get(ctx, "blobs/"+manifest.Config.Digest, "", &imageConfig); err != nil || !found {
+		return ImageInfo{}, found, err
+	}
+	return ImageInfo{ID: manifest.Config.Digest, Digest: digest, Labels: imageConfig.Config.Labels, Platforms: platforms}, true, nil
+}
+
+// registryBaseURL returns the URL of a registry's API. Registries on the local machine, such as a `registry:2`
+// container, are reached over plain HTTP.
+func registryBaseURL(server string) string {
+	if server == dockerHubServer {
+		return "https://" + dockerHubHost
+	}
+	host := server
+	if h, _, err := net.SplitHostPort(server); err == nil {
+		host = h
+	}
+	if host == "localhost" || host == "127.0.0.1" || host == "::1" {
+		return "http://" + server
+	}
+	return "https://" + server
+}
+
+// repositoryPath returns the path of a repository within its registry, e.g. `library/app` for `app`
+func repositoryPath(repository string) string {
+	server := RegistryServer(repository)
+	if host, ok := registryHost(repository); ok {
+		repository = strings.TrimPrefix(repository, host+"/")
+	}
+	if server == dockerHubServer && !strings.Contains(repository, "/") {
+		return "library/" + repository
+	}
+	return repository
+}
+
+// registrySession sends requests for a repository, answering the registry's authentication challenges
+type registrySession struct {
+	client     *http.Client
+	auth       AuthConfig
+	base       string
+	repository string
+	token      string
+	basic      bool
+}
+
+// get decodes the JSON response of a registry API path, returning the digest the registry reports for it
+func (s *registrySession) get(ctx context.Context, path, accept string, into interface{}) (digest string, found bool, err error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%v/v2/%v/%v", s.base, s.repository, path), nil)
+		if err != nil {
+			return "", false, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		switch {
+		case s.token != "":
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		case s.basic:
+			req.SetBasicAuth(s.auth.Username, s.auth.Password)
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return "", false, fmt.Errorf("querying registry: %w", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return "", false, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			if err := s.authenticate(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return "", false, err
+			}
+			continue
+		case resp.StatusCode == http.StatusNotFound:
+			return "", false, nil
+		case resp.StatusCode != http.StatusOK:
+			return "", false, fmt.Errorf("registry returned %v for %v: %v", resp.Status, path, strings.TrimSpace(string(body)))
+		}
+		if err := json.Unmarshal(body, into); err != nil {
+			return "", false, fmt.Errorf("reading registry response for %v: %w", path, err)
+		}
+		return resp.Header.Get("Docker-Content-Digest"), true, nil
+	}
+}
+
+// authenticate answers a WWW-Authenticate challenge, fetching a bearer token from the registry's token service
+func (s *registrySession) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		s.basic = true
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported registry authentication `%v`", challenge)
+	}
+
+	query := url.Values{}
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%v:pull", s.repository)
+	}
+	query.Set("scope", scope)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if s.auth.Username != "" {
+		req.SetBasicAuth(s.auth.Username, s.auth.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("authenticating with registry: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("authenticating with registry: %v", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("authenticating with registry: %w", err)
+	}
+	s.token = token.Token
+	if s.token == "" {
+		s.token = token.AccessToken
+	}
+	return nil
+}
+
+// parseChallenge splits a WWW-Authenticate header such as `Bearer realm="https://auth",service="registry"`
+func parseChallenge(challenge string) (scheme string, params map[string]string) {
+	params = map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	scheme = strings.ToLower(parts[0])
+	if len(parts) < 2 {
+		return scheme, params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[strings.ToLower(key)] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return scheme, params
+}
@@ -0,0 +1,92 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositoryPath(t *testing.T) {
+	assert.Equal(t, "library/app", repositoryPath("app"))
+	assert.Equal(t, "library/app", repositoryPath("docker.io/app"))
+	assert.Equal(t, "team/app", repositoryPath("team/app"))
+	assert.Equal(t, "app", repositoryPath("localhost/app"))
+	assert.Equal(t, "team/app", repositoryPath("localhost:5000/team/app"))
+}
+
+func TestRegistryBaseURL(t *testing.T) {
+	assert.Equal(t, "https://registry-1.docker.io", registryBaseURL(dockerHubServer))
+	assert.Equal(t, "http://localhost:5000", registryBaseURL("localhost:5000"))
+	assert.Equal(t, "http://127.0.0.1:5000", registryBaseURL("127.0.0.1:5000"))
+	assert.Equal(t, "https://myregistry.azurecr.io", registryBaseURL("myregistry.azurecr.io"))
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/app:pull"`)
+	assert.Equal(t, "bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/app:pull",
+	}, params)
+
+	scheme, params = parseChallenge(`Basic realm=Registry`)
+	assert.Equal(t, "basic", scheme)
+	assert.Equal(t, map[string]string{"realm": "Registry"}, params)
+}
+
+func TestRegistryInspect(t *testing.T) {
+	_ = os.Setenv("DOCKER_CONFIG", tempDir(t))
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "repository:team/app:pull", r.URL.Query().Get("scope"))
+			_, _ = fmt.Fprint(w, `{"token":"secret"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/team/app/manifests/v1":
+			w.Header().Set("Docker-Content-Digest", "sha256:index")
+			_, _ = fmt.Fprint(w, `{"mediaType":"`+ociIndex+`","manifests":[
+				{"digest":"sha256:amd64","platform":{"os":"linux","architecture":"amd64"}},
+				{"digest":"sha256:arm64","platform":{"os":"linux","architecture":"arm64","variant":"v8"}},
+				{"digest":"sha256:attestation","platform":{"os":"unknown","architecture":"unknown"}}
+			]}`)
+		case "/v2/team/app/manifests/sha256:amd64":
+			_, _ = fmt.Fprint(w, `{"mediaType":"`+ociManifest+`","config":{"digest":"sha256:config"}}`)
+		case "/v2/team/app/blobs/sha256:config":
+			_, _ = fmt.Fprint(w, `{"config":{"Labels":{"stack-content-hash":"abc"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	info, found, err := NewRegistryClient().Inspect(context.Background(), host+"/team/app:v1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, ImageInfo{
+		ID:        "sha256:config",
+		Digest:    "sha256:index",
+		Labels:    map[string]string{ContentHashLabel: "abc"},
+		Platforms: map[string]string{"linux/amd64": "sha256:amd64", "linux/arm64/v8": "sha256:arm64"},
+	}, info)
+
+	_, found, err = NewRegistryClient().Inspect(context.Background(), host+"/team/app:v2")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
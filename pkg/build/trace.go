@@ -0,0 +1,155 @@
+package build
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// buildKitTraceID identifies the messages of the engine's build stream that carry BuildKit progress
+const buildKitTraceID = "moby.buildkit.trace"
+
+var errInvalidTrace = errors.New("invalid buildkit trace")
+
+// decodeBuildKitTrace decodes the progress the Docker Engine reports for BuildKit builds, a protobuf encoded
+// StatusResponse of the BuildKit control API, reading only the fields events are made of
+func decodeBuildKitTrace(data []byte) (buildKitStatus, error) {
+	var status buildKitStatus
+	err := protoFields(data, func(number int, _ uint64, value []byte) error {
+		switch number {
+		case 1:
+			vertex, err := decodeTraceVertex(value)
+			status.Vertexes = append(status.Vertexes, vertex)
+			return err
+		case 2:
+			vertexStatus, err := decodeTraceVertexStatus(value)
+			status.Statuses = append(status.Statuses, vertexStatus)
+			return err
+		case 3:
+			log, err := decodeTraceVertexLog(value)
+			status.Logs = append(status.Logs, log)
+			return err
+		}
+		return nil
+	})
+	return status, err
+}
+
+func decodeTraceVertex(data []byte) (buildKitVertex, error) {
+	var vertex buildKitVertex
+	err := protoFields(data, func(number int, varint uint64, value []byte) (err error) {
+		switch number {
+		case 1:
+			vertex.Digest = string(value)
+		case 3:
+			vertex.Name = string(value)
+		case 4:
+			vertex.Cached = varint != 0
+		case 5:
+			vertex.Started, err = decodeTraceTimestamp(value)
+		case 6:
+			vertex.Completed, err = decodeTraceTimestamp(value)
+		case 7:
+			vertex.Error = string(value)
+		}
+		return err
+	})
+	return vertex, err
+}
+
+func decodeTraceVertexStatus(data []byte) (buildKitVertexStatus, error) {
+	var status buildKitVertexStatus
+	err := protoFields(data, func(number int, varint uint64, value []byte) (err error) {
+		switch number {
+		case 2:
+			status.Vertex = string(value)
+		case 3:
+			status.Name = string(value)
+		case 4:
+			status.Current = int64(varint)
+		case 5:
+			status.Total = int64(varint)
+		case 8:
+			status.Completed, err = decodeTraceTimestamp(value)
+		}
+		return err
+	})
+	return status, err
+}
+
+func decodeTraceVertexLog(data []byte) (buildKitVertexLog, error) {
+	var log buildKitVertexLog
+	err := protoFields(data, func(number int, _ uint64, value []byte) error {
+		switch number {
+		case 1:
+			log.Vertex = string(value)
+		case 4:
+			log.Data = value
+		}
+		return nil
+	})
+	return log, err
+}
+
+// decodeTraceTimestamp decodes a google.protobuf.Timestamp
+func decodeTraceTimestamp(data []byte) (*time.Time, error) {
+	var seconds, nanos int64
+	err := protoFields(data, func(number int, varint uint64, _ []byte) error {
+		switch number {
+		case 1:
+			seconds = int64(varint)
+		case 2:
+			nanos = int64(varint)
+		}
+		return nil
+	})
+	timestamp := time.Unix(seconds, nanos).UTC()
+	return &timestamp, err
+}
+
+// protoFields calls field with the number and value of each field of a protobuf message, either a varint or the bytes
+// of a length-delimited field. Fixed-size fields are skipped, as no field that is read has one.
+func protoFields(data []byte, field func(number int, varint uint64, value []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errInvalidTrace
+		}
+		data = data[n:]
+		number := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			varint, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errInvalidTrace
+			}
+			data = data[n:]
+			if err := field(number, varint, nil); err != nil {
+				return err
+			}
+		case 1:
+			if len(data) < 8 {
+				return errInvalidTrace
+			}
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return errInvalidTrace
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+			if err := field(number, 0, value); err != nil {
+				return err
+			}
+		case 5:
+			if len(data) < 4 {
+				return errInvalidTrace
+			}
+			data = data[4:]
+		default:
+			return errInvalidTrace
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package credentials provides the credentials of container registries, and encodes them as the
+// `kubernetes.io/dockerconfigjson` secrets clusters pull images with.
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Credentials authenticate with a registry.
+type Credentials struct {
+	Username string
+	Password string
+	// Email is only kept for the clusters that still expect one, and is left out when empty.
+	Email string
+}
+
+// Provider provides the credentials for a registry server, such as `myregistry.azurecr.io`.
+type Provider interface {
+	Credentials(ctx context.Context, server string) (Credentials, error)
+}
+
+// DockerConfigJSON returns the content of a `.dockerconfigjson` key holding the credentials for a server, in the form
+// written by `kubectl create secret docker-registry`.
+func DockerConfigJSON(server string, credentials Credentials) ([]byte, error) {
+	if server == "" {
+		return nil, fmt.Errorf("no registry server given")
+	}
+	type registryAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email,omitempty"`
+		Auth     string `json:"auth"`
+	}
+	return json.Marshal(map[string]map[string]registryAuth{
+		"auths": {server: {
+			Username: credentials.Username,
+			Password: credentials.Password,
+			Email:    credentials.Email,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(credentials.Username + ":" + credentials.Password)),
+		}},
+	})
+}
+
+// UsernamePassword provides fixed credentials, such as those of an Azure service principal or a registry robot account.
+type UsernamePassword struct {
+	Username string
+	Password string
+	Email    string
+}
+
+// Credentials returns the username and password, which must both be set.
+func (u UsernamePassword) Credentials(ctx context.Context, server string) (Credentials, error) {
+	if u.Username == "" || u.Password == "" {
+		return Credentials{}, fmt.Errorf("a username and password are required for registry `%v`", server)
+	}
+	return Credentials{Username: u.Username, Password: u.Password, Email: u.Email}, nil
+}
+
+// jsonKeyUsername is the username Google Container Registry and Artifact Registry accept service account keys with
+const jsonKeyUsername = "_json_key"
+
+// JSONKey provides the credentials of a Google service account JSON key, for Google Container Registry and Artifact
+// Registry.
+type JSONKey struct {
+	Key []byte
+}
+
+// Credentials returns the key as the password of the `_json_key` user, after checking that it is a service account key.
+func (k JSONKey) Credentials(ctx context.Context, server string) (Credentials, error) {
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+	}
+	if err := json.Unmarshal(k.Key, &key); err != nil {
+		return Credentials{}, fmt.Errorf("invalid JSON key for registry `%v`: %w", server, err)
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" {
+		return Credentials{}, fmt.Errorf("the JSON key for registry `%v` is not a service account key", server)
+	}
+	return Credentials{Username: jsonKeyUsername, Password: string(k.Key)}, nil
+}
+
+// runner runs a command with the given standard input, returning its standard output
+type runner func(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error)
+
+// runCommand runs a command, reporting its standard error when it fails
+func runCommand(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running %v: %v: %v", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
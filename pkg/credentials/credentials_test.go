@@ -0,0 +1,43 @@
+package credentials
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerConfigJSON(t *testing.T) {
+	content, err := DockerConfigJSON("myregistry.azurecr.io", Credentials{Username: "sp-id", Password: "sp-password"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"auths":{"myregistry.azurecr.io":{"username":"sp-id","password":"sp-password","auth":"c3AtaWQ6c3AtcGFzc3dvcmQ="}}}`, string(content))
+
+	content, err = DockerConfigJSON("ghcr.io", Credentials{Username: "bot", Password: "token", Email: "bot@example.com"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"email":"bot@example.com"`)
+
+	_, err = DockerConfigJSON("", Credentials{Username: "bot", Password: "token"})
+	assert.EqualError(t, err, "no registry server given")
+}
+
+func TestUsernamePassword(t *testing.T) {
+	credentials, err := UsernamePassword{Username: "bot", Password: "token"}.Credentials(context.Background(), "ghcr.io")
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "bot", Password: "token"}, credentials)
+
+	_, err = UsernamePassword{Username: "bot"}.Credentials(context.Background(), "ghcr.io")
+	assert.EqualError(t, err, "a username and password are required for registry `ghcr.io`")
+}
+
+func TestJSONKey(t *testing.T) {
+	key := `{"type":"service_account","project_id":"stack","client_email":"puller@stack.iam.gserviceaccount.com"}`
+	credentials, err := JSONKey{Key: []byte(key)}.Credentials(context.Background(), "us-docker.pkg.dev")
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "_json_key", Password: key}, credentials)
+
+	_, err = JSONKey{Key: []byte(`{"type":"authorized_user"}`)}.Credentials(context.Background(), "gcr.io")
+	assert.EqualError(t, err, "the JSON key for registry `gcr.io` is not a service account key")
+
+	_, err = JSONKey{Key: []byte("not json")}.Credentials(context.Background(), "gcr.io")
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/altiscope/platform-stack/pkg/build"
+)
+
+// DockerConfig imports the credentials stored for a registry by `docker login`, including those kept by credential
+// helpers such as `docker-credential-desktop` or `docker-credential-gcloud`.
+type DockerConfig struct {
+	// Path is the docker config.json to read, defaulting to the one in DOCKER_CONFIG or ~/.docker.
+	Path string
+
+	run runner
+}
+
+// Credentials reads the credentials for the server from the docker config, asking the credential helper configured
+// for the server, if any.
+func (d DockerConfig) Credentials(ctx context.Context, server string) (Credentials, error) {
+	path := d.Path
+	if path == "" {
+		var err error
+		if path, err = build.DockerConfigPath(); err != nil {
+			return Credentials{}, err
+		}
+	}
+	auth, err := build.ReadAuthConfigFile(ctx, path, server, build.CredentialHelper(d.run))
+	if os.IsNotExist(err) {
+		return Credentials{}, fmt.Errorf("reading docker config: %w", err)
+	}
+	if err != nil {
+		return Credentials{}, err
+	}
+	if auth.Username != "" {
+		return Credentials{Username: auth.Username, Password: auth.Password}, nil
+	}
+	// identity tokens are exchanged for access tokens by docker, which clusters cannot do
+	if auth.IdentityToken != "" {
+		return Credentials{}, fmt.Errorf("docker config `%v` holds an identity token rather than a username and password for registry `%v`", path, server)
+	}
+	return Credentials{}, fmt.Errorf("no credentials for registry `%v` in docker config `%v` - run `docker login %v` first", server, path, server)
+}
@@ -0,0 +1,50 @@
+package credentials
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack-credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	// dXNlcjpwYXNzd29yZA== is user:password
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{
+		"auths": {"https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNzd29yZA=="}, "ghcr.io": {}},
+		"credsStore": "desktop",
+		"credHelpers": {"gcr.io": "gcloud"}
+	}`), 0600))
+
+	var asked []string
+	run := func(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+		asked = append(asked, name+" "+string(stdin))
+		if name == "docker-credential-gcloud" {
+			return []byte(`{"ServerURL":"gcr.io","Username":"<token>","Secret":"refresh-token"}`), nil
+		}
+		return []byte(`{"ServerURL":"ghcr.io","Username":"bot","Secret":"token"}`), nil
+	}
+	config := DockerConfig{Path: path, run: run}
+
+	credentials, err := config.Credentials(context.Background(), "docker.io")
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "user", Password: "password"}, credentials)
+
+	credentials, err = config.Credentials(context.Background(), "ghcr.io")
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "bot", Password: "token"}, credentials)
+
+	_, err = config.Credentials(context.Background(), "gcr.io")
+	assert.EqualError(t, err, "docker config `"+path+"` holds an identity token rather than a username and password for registry `gcr.io`")
+	assert.Equal(t, []string{"docker-credential-desktop ghcr.io", "docker-credential-gcloud gcr.io"}, asked)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"auths": {}}`), 0600))
+	_, err = config.Credentials(context.Background(), "ghcr.io")
+	assert.EqualError(t, err, "no credentials for registry `ghcr.io` in docker config `"+path+"` - run `docker login ghcr.io` first")
+}
@@ -0,0 +1,48 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ecrServer matches the servers of ECR registries, capturing their region
+var ecrServer = regexp.MustCompile(`^[0-9]+\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// ECR provides the short-lived tokens of Amazon Elastic Container Registry through `aws ecr get-login-password`, so
+// that the AWS CLI's own credentials, profiles and SSO sessions are used. Tokens are valid for 12 hours, so secrets
+// holding them need to be refreshed regularly.
+type ECR struct {
+	// Region defaults to the region of the registry server.
+	Region string
+	// Profile is the AWS CLI profile to use, if not the default one.
+	Profile string
+
+	run runner
+}
+
+// Credentials returns a login token for the `AWS` user.
+func (e ECR) Credentials(ctx context.Context, server string) (Credentials, error) {
+	region := e.Region
+	if region == "" {
+		match := ecrServer.FindStringSubmatch(server)
+		if match == nil {
+			return Credentials{}, fmt.Errorf("`%v` is not an ECR registry, give the region of the registry", server)
+		}
+		region = match[2]
+	}
+	args := []string{"ecr", "get-login-password", "--region", region}
+	if e.Profile != "" {
+		args = append(args, "--profile", e.Profile)
+	}
+	run := e.run
+	if run == nil {
+		run = runCommand
+	}
+	token, err := run(ctx, nil, "aws", args...)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("getting an ECR token for `%v`: %w", server, err)
+	}
+	return Credentials{Username: "AWS", Password: strings.TrimSpace(string(token))}, nil
+}
@@ -0,0 +1,37 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestECR(t *testing.T) {
+	var commands [][]string
+	run := func(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+		commands = append(commands, append([]string{name}, args...))
+		return []byte("ecr-token\n"), nil
+	}
+
+	credentials, err := ECR{run: run}.Credentials(context.Background(), "123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "AWS", Password: "ecr-token"}, credentials)
+
+	_, err = ECR{Region: "us-east-1", Profile: "ci", run: run}.Credentials(context.Background(), "registry.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"aws", "ecr", "get-login-password", "--region", "eu-west-1"},
+		{"aws", "ecr", "get-login-password", "--region", "us-east-1", "--profile", "ci"},
+	}, commands)
+
+	_, err = ECR{run: run}.Credentials(context.Background(), "registry.example.com")
+	assert.EqualError(t, err, "`registry.example.com` is not an ECR registry, give the region of the registry")
+
+	failing := func(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+		return nil, fmt.Errorf("running aws: exit status 255: Unable to locate credentials")
+	}
+	_, err = ECR{Region: "us-east-1", run: failing}.Credentials(context.Background(), "123456789012.dkr.ecr.us-east-1.amazonaws.com")
+	assert.EqualError(t, err, "getting an ECR token for `123456789012.dkr.ecr.us-east-1.amazonaws.com`: running aws: exit status 255: Unable to locate credentials")
+}
@@ -0,0 +1,267 @@
+// Package history keeps a record of each deployment of a stack component in the cluster, so that earlier revisions
+// can be listed and re-applied. Like Helm releases, each revision is stored compressed in its own Secret.
+package history
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// StackLabel identifies the stack a revision belongs to. It differs from the `stack` label so that revisions are
+	// not mistaken for the stack's own secrets.
+	StackLabel = "stack-history"
+	// EnvironmentLabel identifies the environment a revision was deployed to.
+	EnvironmentLabel = "stack-environment"
+	// ComponentLabel identifies the component a revision deployed.
+	ComponentLabel = "stack-component"
+	// RevisionLabel holds the revision number.
+	RevisionLabel = "stack-revision"
+
+	// SecretType is the type of the Secrets revisions are stored in.
+	SecretType v1.SecretType = "stack/revision.v1"
+
+	revisionKey = "revision"
+)
+
+// Status describes the outcome of a revision.
+type Status string
+
+const (
+	// StatusDeployed marks the revision currently deployed.
+	StatusDeployed Status = "deployed"
+	// StatusSuperseded marks a revision that was successfully deployed and later replaced.
+	StatusSuperseded Status = "superseded"
+	// StatusFailed marks a revision that did not apply cleanly.
+	StatusFailed Status = "failed"
+)
+
+var invalidNameCharacters = regexp.MustCompile(`[^a-z0-9-.]+`)
+
+// Manifest is a rendered manifest, identified by its path relative to the stack directory.
+type Manifest struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// Revision is a single deployment of a component.
+type Revision struct {
+	Stack       string     `json:"stack"`
+	Environment string     `json:"environment"`
+	Component   string     `json:"component"`
+	Number      int        `json:"number"`
+	Status      Status     `json:"status"`
+	Description string     `json:"description,omitempty"`
+	Manifests   []Manifest `json:"manifests"`
+	Images      []string   `json:"images,omitempty"`
+	// PinnedImages maps the image references of the rendered manifests to the digest references they were deployed as
+	PinnedImages map[string]string `json:"pinnedImages,omitempty"`
+	GitCommit    string            `json:"gitCommit,omitempty"`
+	User         string            `json:"user,omitempty"`
+	DeployedAt   time.Time         `json:"deployedAt"`
+}
+
+// Name returns the name of the Secret holding a revision.
+func Name(stack, environment, component string, number int) string {
+	name := strings.ToLower(fmt.Sprintf("%v-%v-%v.v%v", stack, environment, component, number))
+	return strings.Trim(invalidNameCharacters.ReplaceAllString(name, "-"), "-.")
+}
+
+// Images returns the distinct container images referenced by the pod templates of the given objects, in order.
+func Images(objects []*unstructured.Unstructured) (images []string) {
+	seen := map[string]bool{}
+	var visit func(value interface{})
+	visit = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, key := range []string{"initContainers", "containers"} {
+				containers, _ := v[key].([]interface{})
+				for _, container := range containers {
+					fields, _ := container.(map[string]interface{})
+					image, _ := fields["image"].(string)
+					if image != "" && !seen[image] {
+						seen[image] = true
+						images = append(images, image)
+					}
+				}
+			}
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				visit(v[key])
+			}
+		case []interface{}:
+			for _, item := range v {
+				visit(item)
+			}
+		}
+	}
+	for _, object := range objects {
+		visit(object.Object)
+	}
+	return images
+}
+
+// Store keeps revisions in Secrets within a single namespace.
+type Store struct {
+	Client    corev1.SecretsGetter
+	Namespace string
+	// MaxRevisions limits the number of revisions kept per component, removing the oldest first. Zero keeps all revisions.
+	MaxRevisions int
+}
+
+// List returns the revisions of a component, oldest first. An empty component lists the revisions of every component.
+func (s *Store) List(ctx context.Context, stack, environment, component string) ([]*Revision, error) {
+	selector := labels.Set{StackLabel: stack, EnvironmentLabel: environment}
+	if component != "" {
+		selector[ComponentLabel] = component
+	}
+	secrets, err := s.Client.Secrets(s.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("listing revisions: %w", err)
+	}
+	revisions := make([]*Revision, 0, len(secrets.Items))
+	for i := range secrets.Items {
+		revision, err := decode(&secrets.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		if revisions[i].Component != revisions[j].Component {
+			return revisions[i].Component < revisions[j].Component
+		}
+		return revisions[i].Number < revisions[j].Number
+	})
+	return revisions, nil
+}
+
+// Get returns a single revision of a component.
+func (s *Store) Get(ctx context.Context, stack, environment, component string, number int) (*Revision, error) {
+	secret, err := s.Client.Secrets(s.Namespace).Get(ctx, Name(stack, environment, component, number), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("revision %v of component `%v` not found", number, component)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(secret)
+}
+
+// Record saves a new revision of its component, numbering it after the latest existing revision. When it deployed
+// successfully, the previously deployed revision is marked as superseded.
+func (s *Store) Record(ctx context.Context, revision *Revision) error {
+	existing, err := s.List(ctx, revision.Stack, revision.Environment, revision.Component)
+	if err != nil {
+		return err
+	}
+	revision.Number = 1
+	if len(existing) > 0 {
+		revision.Number = existing[len(existing)-1].Number + 1
+	}
+	secret, err := encode(revision)
+	if err != nil {
+		return err
+	}
+	secrets := s.Client.Secrets(s.Namespace)
+	if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("recording revision: %w", err)
+	}
+
+	if revision.Status == StatusDeployed {
+		for _, previous := range existing {
+			if previous.Status != StatusDeployed {
+				continue
+			}
+			previous.Status = StatusSuperseded
+			if err := s.update(ctx, previous); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.MaxRevisions > 0 && len(existing)+1 > s.MaxRevisions {
+		for _, old := range existing[:len(existing)+1-s.MaxRevisions] {
+			err := secrets.Delete(ctx, Name(old.Stack, old.Environment, old.Component, old.Number), metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("removing revision %v: %w", old.Number, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) update(ctx context.Context, revision *Revision) error {
+	secret, err := encode(revision)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Client.Secrets(s.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("updating revision %v: %w", revision.Number, err)
+	}
+	return nil
+}
+
+func encode(revision *Revision) (*v1.Secret, error) {
+	data, err := json.Marshal(revision)
+	if err != nil {
+		return nil, err
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: Name(revision.Stack, revision.Environment, revision.Component, revision.Number),
+			Labels: map[string]string{
+				StackLabel:       revision.Stack,
+				EnvironmentLabel: revision.Environment,
+				ComponentLabel:   revision.Component,
+				RevisionLabel:    strconv.Itoa(revision.Number),
+			},
+		},
+		Type: SecretType,
+		Data: map[string][]byte{revisionKey: compressed.Bytes()},
+	}, nil
+}
+
+func decode(secret *v1.Secret) (*Revision, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(secret.Data[revisionKey]))
+	if err != nil {
+		return nil, fmt.Errorf("decoding revision `%v`: %w", secret.Name, err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("decoding revision `%v`: %w", secret.Name, err)
+	}
+	revision := &Revision{}
+	if err := json.Unmarshal(data, revision); err != nil {
+		return nil, fmt.Errorf("decoding revision `%v`: %w", secret.Name, err)
+	}
+	return revision, nil
+}
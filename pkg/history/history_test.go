@@ -0,0 +1,74 @@
+package history
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func revision(component string, status Status) *Revision {
+	return &Revision{
+		Stack:       "app",
+		Environment: "local",
+		Component:   component,
+		Status:      status,
+		Manifests:   []Manifest{{Path: "./deployments/app.yaml", Content: "kind: ConfigMap\n"}},
+	}
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "app-local-config.v3", Name("app", "local", "config", 3))
+	assert.Equal(t, "my-app-local-config.v1", Name("My_App", "local", "config", 1))
+}
+
+func TestRecord(t *testing.T) {
+	ctx := context.Background()
+	store := &Store{Client: fake.NewSimpleClientset().CoreV1(), Namespace: "default", MaxRevisions: 3}
+
+	assert.NoError(t, store.Record(ctx, revision("app", StatusDeployed)))
+	assert.NoError(t, store.Record(ctx, revision("app", StatusFailed)))
+	assert.NoError(t, store.Record(ctx, revision("config", StatusDeployed)))
+	assert.NoError(t, store.Record(ctx, revision("app", StatusDeployed)))
+
+	revisions, err := store.List(ctx, "app", "local", "app")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 3)
+	assert.Equal(t, []Status{StatusSuperseded, StatusFailed, StatusDeployed}, []Status{revisions[0].Status, revisions[1].Status, revisions[2].Status})
+	assert.Equal(t, 3, revisions[2].Number)
+	assert.Equal(t, "kind: ConfigMap\n", revisions[2].Manifests[0].Content)
+
+	all, err := store.List(ctx, "app", "local", "")
+	assert.NoError(t, err)
+	assert.Len(t, all, 4)
+	assert.Equal(t, "config", all[3].Component)
+
+	// the oldest revision is removed once the limit is exceeded
+	assert.NoError(t, store.Record(ctx, revision("app", StatusDeployed)))
+	_, err = store.Get(ctx, "app", "local", "app", 1)
+	assert.EqualError(t, err, "revision 1 of component `app` not found")
+	latest, err := store.Get(ctx, "app", "local", "app", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDeployed, latest.Status)
+}
+
+func TestImages(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Deployment",
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"initContainers": []interface{}{map[string]interface{}{"image": "migrate:1.0"}},
+					"containers": []interface{}{
+						map[string]interface{}{"image": "app:1.0"},
+						map[string]interface{}{"image": "migrate:1.0"},
+					},
+				},
+			},
+		},
+	}}
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap"}}
+	assert.Equal(t, []string{"migrate:1.0", "app:1.0"}, Images([]*unstructured.Unstructured{configMap, deployment}))
+}
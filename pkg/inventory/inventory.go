@@ -0,0 +1,210 @@
+// Package inventory records the objects a stack has applied to a cluster, so they can be found again
+// without the manifests that produced them.
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// StackLabel is the label identifying the stack an inventory belongs to.
+	StackLabel = "stack"
+	// EnvironmentLabel is the label identifying the environment an inventory belongs to.
+	EnvironmentLabel = "stack-environment"
+	// InventoryLabel marks a ConfigMap as an inventory.
+	InventoryLabel = "stack-inventory"
+)
+
+var invalidNameCharacters = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// ObjectReference identifies an applied object.
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// NewObjectReference returns a reference to the given object.
+func NewObjectReference(object *unstructured.Unstructured) ObjectReference {
+	return ObjectReference{
+		APIVersion: object.GetAPIVersion(),
+		Kind:       object.GetKind(),
+		Namespace:  object.GetNamespace(),
+		Name:       object.GetName(),
+	}
+}
+
+type objectKey struct {
+	group, kind, namespace, name string
+}
+
+func (r ObjectReference) key() objectKey {
+	group := ""
+	if gv, err := schema.ParseGroupVersion(r.APIVersion); err == nil {
+		group = gv.Group
+	}
+	return objectKey{group: group, kind: r.Kind, namespace: r.Namespace, name: r.Name}
+}
+
+// Unstructured returns an object carrying only the identity of the reference.
+func (r ObjectReference) Unstructured() *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion(r.APIVersion)
+	object.SetKind(r.Kind)
+	object.SetNamespace(r.Namespace)
+	object.SetName(r.Name)
+	return object
+}
+
+// Inventory lists the objects applied for each component of a stack in one environment.
+type Inventory struct {
+	Stack       string
+	Environment string
+	Components  map[string][]ObjectReference
+}
+
+// New returns an empty inventory for the given stack and environment.
+func New(stack, environment string) *Inventory {
+	return &Inventory{Stack: stack, Environment: environment, Components: map[string][]ObjectReference{}}
+}
+
+// ComponentNames returns the names of all components with recorded objects, sorted.
+func (inv *Inventory) ComponentNames() []string {
+	names := make([]string, 0, len(inv.Components))
+	for name := range inv.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Add records objects for a component, keeping any objects already recorded for it.
+func (inv *Inventory) Add(component string, objects []ObjectReference) {
+	inv.Components[component] = Union(inv.Components[component], objects)
+}
+
+// Set replaces the objects recorded for a component.
+func (inv *Inventory) Set(component string, objects []ObjectReference) {
+	if len(objects) == 0 {
+		delete(inv.Components, component)
+		return
+	}
+	inv.Components[component] = objects
+}
+
+// Remove forgets the objects recorded for a component.
+func (inv *Inventory) Remove(component string) {
+	delete(inv.Components, component)
+}
+
+// Union returns the references in a followed by those in b that are not also in a.
+func Union(a, b []ObjectReference) []ObjectReference {
+	union := append([]ObjectReference{}, a...)
+	return append(union, Difference(b, a)...)
+}
+
+// Difference returns the references in a that are not in b. References are compared by group, kind, namespace and
+// name, so an object whose manifest moves to a newer API version is not treated as a different object.
+func Difference(a, b []ObjectReference) (difference []ObjectReference) {
+	exclude := make(map[objectKey]bool, len(b))
+	for _, ref := range b {
+		exclude[ref.key()] = true
+	}
+	for _, ref := range a {
+		if !exclude[ref.key()] {
+			difference = append(difference, ref)
+		}
+	}
+	return difference
+}
+
+// Name returns the name of the ConfigMap holding the inventory of a stack in an environment.
+func Name(stack, environment string) string {
+	name := strings.ToLower(fmt.Sprintf("%v-%v-inventory", stack, environment))
+	return strings.Trim(invalidNameCharacters.ReplaceAllString(name, "-"), "-")
+}
+
+// Store keeps inventories in ConfigMaps within a single namespace.
+type Store struct {
+	Client    corev1.ConfigMapsGetter
+	Namespace string
+}
+
+// Load retrieves the inventory of a stack in an environment, returning an empty inventory if none has been saved.
+func (s *Store) Load(ctx context.Context, stack, environment string) (*Inventory, error) {
+	inv := New(stack, environment)
+	configMap, err := s.Client.ConfigMaps(s.Namespace).Get(ctx, Name(stack, environment), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return inv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading inventory: %w", err)
+	}
+	for component, data := range configMap.Data {
+		var refs []ObjectReference
+		if err := json.Unmarshal([]byte(data), &refs); err != nil {
+			return nil, fmt.Errorf("loading inventory for component `%v`: %w", component, err)
+		}
+		inv.Components[component] = refs
+	}
+	return inv, nil
+}
+
+// Save writes the inventory, creating its ConfigMap if needed. An empty inventory deletes the ConfigMap.
+func (s *Store) Save(ctx context.Context, inv *Inventory) error {
+	configMaps := s.Client.ConfigMaps(s.Namespace)
+	name := Name(inv.Stack, inv.Environment)
+	if len(inv.Components) == 0 {
+		err := configMaps.Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("deleting inventory: %w", err)
+		}
+		return nil
+	}
+
+	data := make(map[string]string, len(inv.Components))
+	for component, refs := range inv.Components {
+		encoded, err := json.Marshal(refs)
+		if err != nil {
+			return err
+		}
+		data[component] = string(encoded)
+	}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.Namespace,
+			Labels: map[string]string{
+				StackLabel:       inv.Stack,
+				EnvironmentLabel: inv.Environment,
+				InventoryLabel:   "true",
+			},
+		},
+		Data: data,
+	}
+
+	existing, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	} else if err == nil {
+		configMap.ResourceVersion = existing.ResourceVersion
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("saving inventory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var (
+	configMap  = ObjectReference{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "stack-env"}
+	deployment = ObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "default", Name: "app"}
+	service    = ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "app"}
+)
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "app-local-inventory", Name("app", "local"))
+	assert.Equal(t, "my-app-staging-inventory", Name("My_App", "staging"))
+}
+
+func TestDifference(t *testing.T) {
+	assert.Equal(t, []ObjectReference{service}, Difference([]ObjectReference{deployment, service}, []ObjectReference{deployment}))
+	assert.Empty(t, Difference([]ObjectReference{deployment}, []ObjectReference{deployment, service}))
+
+	upgraded := deployment
+	upgraded.APIVersion = "apps/v1beta1"
+	assert.Empty(t, Difference([]ObjectReference{upgraded}, []ObjectReference{deployment}))
+}
+
+func TestUnion(t *testing.T) {
+	assert.Equal(t, []ObjectReference{deployment, service, configMap}, Union([]ObjectReference{deployment, service}, []ObjectReference{service, configMap}))
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	store := &Store{Client: client.CoreV1(), Namespace: "default"}
+
+	inv, err := store.Load(ctx, "app", "local")
+	assert.NoError(t, err)
+	assert.Empty(t, inv.Components)
+
+	inv.Add("config", []ObjectReference{configMap})
+	inv.Add("app", []ObjectReference{deployment})
+	assert.NoError(t, store.Save(ctx, inv))
+
+	saved, err := client.CoreV1().ConfigMaps("default").Get(ctx, "app-local-inventory", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "app", saved.Labels[StackLabel])
+	assert.Equal(t, "local", saved.Labels[EnvironmentLabel])
+
+	inv.Add("app", []ObjectReference{service})
+	assert.NoError(t, store.Save(ctx, inv))
+
+	loaded, err := store.Load(ctx, "app", "local")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app", "config"}, loaded.ComponentNames())
+	assert.Equal(t, []ObjectReference{deployment, service}, loaded.Components["app"])
+
+	loaded.Remove("app")
+	loaded.Set("config", nil)
+	assert.NoError(t, store.Save(ctx, loaded))
+	_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "app-local-inventory", metav1.GetOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	dataFromFileKey    = "kubetpl/data-from-file"
+	dataFromEnvFileKey = "kubetpl/data-from-env-file"
+)
+
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// includeFiles hydrates the `data` of ConfigMaps and Secrets that declare file includes.
+// Documents without include directives are passed through untouched.
+func includeFiles(contents []byte, dir string, allowFsAccess bool) ([]byte, error) {
+	if !bytes.Contains(contents, []byte(dataFromFileKey)) && !bytes.Contains(contents, []byte(dataFromEnvFileKey)) {
+		return contents, nil
+	}
+
+	var out bytes.Buffer
+	separators := documentSeparator.FindAllIndex(contents, -1)
+	start := 0
+	for i := 0; i <= len(separators); i++ {
+		end := len(contents)
+		if i < len(separators) {
+			end = separators[i][0]
+		}
+		document, err := includeDocumentFiles(contents[start:end], dir, allowFsAccess)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(document)
+		if i < len(separators) {
+			out.Write(contents[separators[i][0]:separators[i][1]])
+			start = separators[i][1]
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func includeDocumentFiles(document []byte, dir string, allowFsAccess bool) ([]byte, error) {
+	if !bytes.Contains(document, []byte(dataFromFileKey)) && !bytes.Contains(document, []byte(dataFromEnvFileKey)) {
+		return document, nil
+	}
+
+	var object yaml.MapSlice
+	if err := yaml.Unmarshal(document, &object); err != nil {
+		return nil, fmt.Errorf("parsing document: %w", err)
+	}
+
+	object, files, err := popStringList(object, dataFromFileKey)
+	if err != nil {
+		return nil, err
+	}
+	object, envFiles, err := popStringList(object, dataFromEnvFileKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 && len(envFiles) == 0 {
+		return document, nil
+	}
+	if !allowFsAccess {
+		return nil, fmt.Errorf("`%v` and `%v` require filesystem access to be allowed", dataFromFileKey, dataFromEnvFileKey)
+	}
+
+	kind, _ := lookup(object, "kind").(string)
+	if kind != "ConfigMap" && kind != "Secret" {
+		return nil, fmt.Errorf("file includes are only supported for ConfigMap and Secret, got `%v`", kind)
+	}
+	encode := func(value []byte) string {
+		if kind == "Secret" {
+			return base64.StdEncoding.EncodeToString(value)
+		}
+		return string(value)
+	}
+
+	data, _ := lookup(object, "data").(yaml.MapSlice)
+	for _, file := range files {
+		key, path := filepath.Base(file), file
+		if split := strings.SplitN(file, "=", 2); len(split) == 2 {
+			key, path = split[0], split[1]
+		}
+		contents, err := ioutil.ReadFile(resolvePath(dir, path))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", dataFromFileKey, err)
+		}
+		data = set(data, key, encode(contents))
+	}
+	for _, envFile := range envFiles {
+		values, err := ReadEnvFile(resolvePath(dir, envFile))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", dataFromEnvFileKey, err)
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			data = set(data, key, encode([]byte(values[key])))
+		}
+	}
+	object = set(object, "data", data)
+
+	rendered, err := yaml.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("\n"), rendered...), nil
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func lookup(object yaml.MapSlice, key string) interface{} {
+	for _, item := range object {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func set(object yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range object {
+		if item.Key == key {
+			object[i].Value = value
+			return object
+		}
+	}
+	return append(object, yaml.MapItem{Key: key, Value: value})
+}
+
+// popStringList removes key from object, returning its value as a list of strings.
+func popStringList(object yaml.MapSlice, key string) (yaml.MapSlice, []string, error) {
+	for i, item := range object {
+		if item.Key != key {
+			continue
+		}
+		remaining := append(yaml.MapSlice{}, object[:i]...)
+		remaining = append(remaining, object[i+1:]...)
+		list, ok := item.Value.([]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("expecting `%v` to be a list of files", key)
+		}
+		values := make([]string, len(list))
+		for j, elem := range list {
+			values[j] = fmt.Sprint(elem)
+		}
+		return remaining, values, nil
+	}
+	return object, nil, nil
+}
@@ -0,0 +1,179 @@
+// Package render renders Kubernetes manifest templates in-process.
+//
+// Templates follow the conventions of kubetpl (https://github.com/shyiko/kubetpl): the template syntax is chosen
+// with a `# kubetpl:syntax:<syntax>` directive, defaults may be provided with `# kubetpl:set:KEY=value` directives,
+// and ConfigMaps and Secrets may be hydrated from files on disk with `kubetpl/data-from-file` and
+// `kubetpl/data-from-env-file` when filesystem access is allowed.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const (
+	directivePrefix = "# kubetpl:"
+
+	// SyntaxDollar substitutes shell-style `$VAR` and `${VAR}` placeholders. This is the default syntax.
+	SyntaxDollar = "$"
+	// SyntaxGoTemplate renders the template with text/template, exposing values as `{{ .VAR }}`.
+	SyntaxGoTemplate = "go-template"
+)
+
+// Options control how a template is rendered.
+type Options struct {
+	// Defaults are `KEY=value` values applied before ConfigFiles, which override them. They override the defaults of
+	// `# kubetpl:set:` directives.
+	Defaults []string
+	// ConfigFiles are .env formatted files providing template values, equivalent to kubetpl's `-i` flag.
+	ConfigFiles []string
+	// Values are `KEY=value` overrides applied after ConfigFiles, equivalent to kubetpl's `-s` flag.
+	Values []string
+	// AllowFsAccess permits documents to include file contents, equivalent to kubetpl's `--allow-fs-access` flag.
+	AllowFsAccess bool
+}
+
+// RenderFile renders the template at the given path using values loaded from opts.
+func RenderFile(filename string, opts Options) ([]byte, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	values, err := LoadValues(opts)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := Render(contents, values, filepath.Dir(filename), opts.AllowFsAccess)
+	if err != nil {
+		return nil, fmt.Errorf("rendering `%v`: %w", filename, err)
+	}
+	return rendered, nil
+}
+
+// Render renders template contents with the given values. Relative paths of file includes are resolved against dir.
+func Render(contents []byte, values Values, dir string, allowFsAccess bool) ([]byte, error) {
+	syntax, defaults, body, err := parseDirectives(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	// directive defaults have the lowest precedence
+	merged := Values{}
+	merged.Merge(defaults)
+	merged.Merge(values)
+
+	var substituted []byte
+	switch syntax {
+	case SyntaxDollar:
+		substituted, err = substituteDollar(body, merged)
+	case SyntaxGoTemplate:
+		substituted, err = executeGoTemplate(body, merged)
+	default:
+		err = fmt.Errorf("unsupported template syntax `%v`", syntax)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return includeFiles(substituted, dir, allowFsAccess)
+}
+
+// parseDirectives strips `# kubetpl:` directive comments from contents, returning the selected syntax
+// and any default values they declare.
+func parseDirectives(contents []byte) (syntax string, defaults Values, body []byte, err error) {
+	syntax = SyntaxDollar
+	defaults = Values{}
+	var out bytes.Buffer
+	for _, line := range strings.SplitAfter(string(contents), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, directivePrefix) {
+			out.WriteString(line)
+			continue
+		}
+		directive := strings.SplitN(strings.TrimPrefix(trimmed, directivePrefix), ":", 2)
+		if len(directive) != 2 {
+			return "", nil, nil, fmt.Errorf("malformed directive `%v`", trimmed)
+		}
+		switch directive[0] {
+		case "syntax":
+			syntax = strings.TrimSpace(directive[1])
+		case "set":
+			key, value, err := ParseValue(directive[1])
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("directive `%v`: %w", trimmed, err)
+			}
+			defaults[key] = value
+		default:
+			return "", nil, nil, fmt.Errorf("unknown directive `%v`", trimmed)
+		}
+	}
+	return syntax, defaults, out.Bytes(), nil
+}
+
+// substituteDollar replaces `$VAR` and `${VAR}` placeholders with their values. `$$` yields a literal `$`,
+// and a `$` not followed by a variable name is left untouched.
+func substituteDollar(contents []byte, values Values) ([]byte, error) {
+	var out bytes.Buffer
+	text := []rune(string(contents))
+	for i := 0; i < len(text); i++ {
+		if text[i] != '$' || i+1 >= len(text) {
+			out.WriteRune(text[i])
+			continue
+		}
+		next := text[i+1]
+		switch {
+		case next == '$':
+			out.WriteRune('$')
+			i++
+		case next == '{':
+			end := i + 2
+			for end < len(text) && text[end] != '}' {
+				end++
+			}
+			if end >= len(text) {
+				return nil, fmt.Errorf("unterminated placeholder `%v`", string(text[i:]))
+			}
+			name := string(text[i+2 : end])
+			if !isIdentifier(name) {
+				return nil, fmt.Errorf("invalid placeholder `${%v}`", name)
+			}
+			value, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("template variable `%v` is not defined", name)
+			}
+			out.WriteString(value)
+			i = end
+		case isIdentifierRune(next, true):
+			end := i + 1
+			for end < len(text) && isIdentifierRune(text[end], false) {
+				end++
+			}
+			name := string(text[i+1 : end])
+			value, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("template variable `%v` is not defined", name)
+			}
+			out.WriteString(value)
+			i = end - 1
+		default:
+			out.WriteRune(text[i])
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func executeGoTemplate(contents []byte, values Values) ([]byte, error) {
+	parsed, err := template.New("manifest").Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := parsed.Execute(&out, map[string]string(values)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,120 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   Values
+		expected string
+		err      bool
+	}{
+		{"dollar syntax", "# kubetpl:syntax:$\nimage: $IMAGE:${TAG}\n", Values{"IMAGE": "app", "TAG": "v1"}, "image: app:v1\n", false},
+		{"default syntax", "image: $IMAGE\n", Values{"IMAGE": "app"}, "image: app\n", false},
+		{"escaped dollar", "cmd: echo $$HOME $\n", Values{}, "cmd: echo $HOME $\n", false},
+		{"undefined variable", "image: $IMAGE\n", Values{}, "", true},
+		{"unterminated placeholder", "image: ${IMAGE\n", Values{"IMAGE": "app"}, "", true},
+		{"set directive default", "# kubetpl:set:TAG=latest\ntag: $TAG\n", Values{}, "tag: latest\n", false},
+		{"set directive overridden", "# kubetpl:set:TAG=latest\ntag: $TAG\n", Values{"TAG": "v2"}, "tag: v2\n", false},
+		{"go-template syntax", "# kubetpl:syntax:go-template\nimage: {{ .IMAGE }}\n", Values{"IMAGE": "app"}, "image: app\n", false},
+		{"go-template undefined variable", "# kubetpl:syntax:go-template\nimage: {{ .IMAGE }}\n", Values{}, "", true},
+		{"unsupported syntax", "# kubetpl:syntax:template-kind\n", Values{}, "", true},
+		{"unknown directive", "# kubetpl:unknown:value\n", Values{}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := Render([]byte(tt.template), tt.values, ".", false)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(rendered))
+		})
+	}
+}
+
+func TestRenderFile(t *testing.T) {
+	rendered, err := RenderFile("testdata/configmap.yaml", Options{
+		ConfigFiles:   []string{"testdata/config-local.env"},
+		Values:        []string{`APP_TAG="v2.0.0"`},
+		AllowFsAccess: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: stack-env
+data:
+  APP_TAG: v1.0.0
+  ENV: local
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: stack-secret
+data:
+  greeting.txt: aGVsbG8gd29ybGQ=
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: app-v2.0.0
+`, string(rendered))
+}
+
+func TestRenderFileWithoutFsAccess(t *testing.T) {
+	_, err := RenderFile("testdata/configmap.yaml", Options{
+		ConfigFiles: []string{"testdata/config-local.env"},
+	})
+	assert.Error(t, err)
+}
+
+func TestLoadValues(t *testing.T) {
+	values, err := LoadValues(Options{
+		Defaults:    []string{"APP_TAG=latest", "IMAGE_TAG=latest"},
+		ConfigFiles: []string{"testdata/config-local.env"},
+		Values:      []string{`ENV="ci"`, "EXTRA='quoted value'"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Values{"ENV": "ci", "APP_TAG": "v1.0.0", "IMAGE_TAG": "latest", "EXTRA": "quoted value"}, values, "config files override defaults")
+
+	_, err = LoadValues(Options{ConfigFiles: []string{"testdata/missing.env"}})
+	assert.Error(t, err)
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		pair  string
+		key   string
+		value string
+		err   bool
+	}{
+		{`KEY="value"`, "KEY", "value", false},
+		{`KEY=value=with=equals`, "KEY", "value=with=equals", false},
+		{`KEY="escaped \"quote\""`, "KEY", `escaped "quote"`, false},
+		{`KEY=`, "KEY", "", false},
+		{`KEY`, "", "", true},
+		{`1KEY=value`, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pair, func(t *testing.T) {
+			key, value, err := ParseValue(tt.pair)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.key, key)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Values holds the variables made available to a template during rendering.
+type Values map[string]string
+
+// Merge copies every key of other into v, overwriting keys that already exist.
+func (v Values) Merge(other Values) {
+	for key, value := range other {
+		v[key] = value
+	}
+}
+
+// LoadValues builds the set of template values from the given options.
+// Defaults are applied first, then config files in order, with later files taking precedence, followed by any explicit
+// overrides.
+func LoadValues(opts Options) (Values, error) {
+	values := Values{}
+	for _, value := range opts.Defaults {
+		key, value, err := ParseValue(value)
+		if err != nil {
+			return values, err
+		}
+		values[key] = value
+	}
+	for _, configFile := range opts.ConfigFiles {
+		fileValues, err := ReadEnvFile(configFile)
+		if err != nil {
+			return values, err
+		}
+		values.Merge(fileValues)
+	}
+	for _, override := range opts.Values {
+		key, value, err := ParseValue(override)
+		if err != nil {
+			return values, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// ReadEnvFile reads a .env formatted file into a set of Values.
+func ReadEnvFile(filename string) (Values, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading template config: %w", err)
+	}
+	values, err := ParseEnv(contents)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template config `%v`: %w", filename, err)
+	}
+	return values, nil
+}
+
+// ParseEnv parses .env formatted content as `KEY=value` pairs, one per line.
+// Blank lines and lines starting with `#` are ignored, an optional `export` prefix is dropped,
+// and values may be wrapped in single or double quotes.
+func ParseEnv(contents []byte) (Values, error) {
+	values := Values{}
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, err := ParseValue(line)
+		if err != nil {
+			return values, fmt.Errorf("line %v: %w", lineNumber, err)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// ParseValue parses a single `KEY=value` or `KEY="value"` pair, as produced for the `-s` flag of kubetpl.
+func ParseValue(pair string) (key, value string, err error) {
+	split := strings.SplitN(pair, "=", 2)
+	if len(split) != 2 {
+		return "", "", fmt.Errorf("expecting value as `KEY=value`: got `%v` instead", pair)
+	}
+	key = strings.TrimSpace(split[0])
+	if !isIdentifier(key) {
+		return "", "", fmt.Errorf("invalid variable name `%v`", key)
+	}
+	value, err = unquote(strings.TrimSpace(split[1]))
+	if err != nil {
+		return "", "", fmt.Errorf("value for `%v`: %w", key, err)
+	}
+	return key, value, nil
+}
+
+func unquote(value string) (string, error) {
+	if len(value) < 2 {
+		return value, nil
+	}
+	switch {
+	case value[0] == '"' && value[len(value)-1] == '"':
+		return strconv.Unquote(value)
+	case value[0] == '\'' && value[len(value)-1] == '\'':
+		return value[1 : len(value)-1], nil
+	}
+	return value, nil
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !isIdentifierRune(r, i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentifierRune(r rune, first bool) bool {
+	switch {
+	case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return true
+	case r >= '0' && r <= '9':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+// Package rollout watches applied workloads until their rollouts complete, failing fast when a rollout cannot succeed.
+package rollout
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Status reports whether a workload has finished rolling out, with a message describing its progress.
+// An error is returned when the rollout has failed and will not recover by waiting. Kinds that do not roll out are
+// done as soon as they exist.
+func Status(object *unstructured.Unstructured) (done bool, message string, err error) {
+	generation := object.GetGeneration()
+	observedGeneration, _, _ := unstructured.NestedInt64(object.Object, "status", "observedGeneration")
+	if isWorkload(object) && observedGeneration < generation {
+		return false, "waiting for the rollout to be observed", nil
+	}
+
+	switch object.GroupVersionKind().GroupKind().String() {
+	case "Deployment.apps":
+		return deploymentStatus(object)
+	case "StatefulSet.apps":
+		return statefulSetStatus(object)
+	case "DaemonSet.apps":
+		return daemonSetStatus(object)
+	case "Job.batch":
+		return jobStatus(object)
+	}
+	return true, "", nil
+}
+
+func isWorkload(object *unstructured.Unstructured) bool {
+	switch object.GroupVersionKind().GroupKind().String() {
+	case "Deployment.apps", "StatefulSet.apps", "DaemonSet.apps":
+		return true
+	}
+	return false
+}
+
+// deploymentStatus follows `kubectl rollout status`: all replicas must be updated and available, with no old
+// replicas left terminating
+func deploymentStatus(object *unstructured.Unstructured) (bool, string, error) {
+	if reason, message, found := condition(object, "Progressing", "False"); found && reason == "ProgressDeadlineExceeded" {
+		return false, "", fmt.Errorf("rollout exceeded its progress deadline: %v", message)
+	}
+	replicas := specReplicas(object)
+	statusReplicas, _, _ := unstructured.NestedInt64(object.Object, "status", "replicas")
+	updated, _, _ := unstructured.NestedInt64(object.Object, "status", "updatedReplicas")
+	available, _, _ := unstructured.NestedInt64(object.Object, "status", "availableReplicas")
+	switch {
+	case updated < replicas:
+		return false, fmt.Sprintf("%v of %v replicas updated", updated, replicas), nil
+	case statusReplicas > updated:
+		return false, fmt.Sprintf("%v old replicas pending termination", statusReplicas-updated), nil
+	case available < updated:
+		return false, fmt.Sprintf("%v of %v updated replicas available", available, updated), nil
+	}
+	return true, "", nil
+}
+
+func statefulSetStatus(object *unstructured.Unstructured) (bool, string, error) {
+	replicas := specReplicas(object)
+	ready, _, _ := unstructured.NestedInt64(object.Object, "status", "readyReplicas")
+	if ready < replicas {
+		return false, fmt.Sprintf("%v of %v replicas ready", ready, replicas), nil
+	}
+	strategy, _, _ := unstructured.NestedString(object.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		return true, "", nil
+	}
+	if partition, found, _ := unstructured.NestedInt64(object.Object, "spec", "updateStrategy", "rollingUpdate", "partition"); found && partition > 0 {
+		updated, _, _ := unstructured.NestedInt64(object.Object, "status", "updatedReplicas")
+		if updated < replicas-partition {
+			return false, fmt.Sprintf("%v of %v partitioned replicas updated", updated, replicas-partition), nil
+		}
+		return true, "", nil
+	}
+	current, _, _ := unstructured.NestedString(object.Object, "status", "currentRevision")
+	update, _, _ := unstructured.NestedString(object.Object, "status", "updateRevision")
+	if update != "" && current != update {
+		updated, _, _ := unstructured.NestedInt64(object.Object, "status", "updatedReplicas")
+		return false, fmt.Sprintf("%v of %v replicas updated", updated, replicas), nil
+	}
+	return true, "", nil
+}
+
+func daemonSetStatus(object *unstructured.Unstructured) (bool, string, error) {
+	desired, _, _ := unstructured.NestedInt64(object.Object, "status", "desiredNumberScheduled")
+	updated, _, _ := unstructured.NestedInt64(object.Object, "status", "updatedNumberScheduled")
+	available, _, _ := unstructured.NestedInt64(object.Object, "status", "numberAvailable")
+	switch {
+	case updated < desired:
+		return false, fmt.Sprintf("%v of %v pods updated", updated, desired), nil
+	case available < desired:
+		return false, fmt.Sprintf("%v of %v updated pods available", available, desired), nil
+	}
+	return true, "", nil
+}
+
+func jobStatus(object *unstructured.Unstructured) (bool, string, error) {
+	if reason, message, found := condition(object, "Failed", "True"); found {
+		return false, "", fmt.Errorf("job failed (%v): %v", reason, message)
+	}
+	if _, _, found := condition(object, "Complete", "True"); found {
+		return true, "", nil
+	}
+	completions, found, _ := unstructured.NestedInt64(object.Object, "spec", "completions")
+	if !found {
+		completions = 1
+	}
+	succeeded, _, _ := unstructured.NestedInt64(object.Object, "status", "succeeded")
+	if succeeded >= completions {
+		return true, "", nil
+	}
+	return false, fmt.Sprintf("%v of %v completions succeeded", succeeded, completions), nil
+}
+
+func specReplicas(object *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(object.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
+
+// condition finds a status condition of the given type and status, returning its reason and message
+func condition(object *unstructured.Unstructured, conditionType, status string) (reason, message string, found bool) {
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, c := range conditions {
+		fields, ok := c.(map[string]interface{})
+		if !ok || fields["type"] != conditionType || fields["status"] != status {
+			continue
+		}
+		reason, _ = fields["reason"].(string)
+		message, _ = fields["message"].(string)
+		return reason, message, true
+	}
+	return "", "", false
+}
@@ -0,0 +1,75 @@
+package rollout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func workload(kind string, generation int64, spec, status map[string]interface{}) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec":   spec,
+		"status": status,
+	}}
+	object.SetAPIVersion("apps/v1")
+	if kind == "Job" {
+		object.SetAPIVersion("batch/v1")
+	}
+	if kind == "ConfigMap" {
+		object.SetAPIVersion("v1")
+	}
+	object.SetKind(kind)
+	object.SetName("app")
+	object.SetNamespace("testns")
+	object.SetGeneration(generation)
+	return object
+}
+
+func TestStatus(t *testing.T) {
+	progressDeadlineExceeded := map[string]interface{}{
+		"observedGeneration": int64(1),
+		"conditions": []interface{}{map[string]interface{}{
+			"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded", "message": `ReplicaSet "app-5d4" has timed out progressing.`,
+		}},
+	}
+	jobFailed := map[string]interface{}{
+		"conditions": []interface{}{map[string]interface{}{
+			"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded", "message": "Job has reached the specified backoff limit",
+		}},
+	}
+
+	tests := []struct {
+		name    string
+		object  *unstructured.Unstructured
+		done    bool
+		message string
+		err     string
+	}{
+		{"deployment rolled out", workload("Deployment", 2, map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)}), true, "", ""},
+		{"deployment generation not observed", workload("Deployment", 3, map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{"observedGeneration": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)}), false, "waiting for the rollout to be observed", ""},
+		{"deployment default replicas unavailable", workload("Deployment", 1, map[string]interface{}{}, map[string]interface{}{"observedGeneration": int64(1), "replicas": int64(1), "updatedReplicas": int64(1)}), false, "0 of 1 updated replicas available", ""},
+		{"deployment with old replicas", workload("Deployment", 2, map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(3), "updatedReplicas": int64(2), "availableReplicas": int64(3)}), false, "1 old replicas pending termination", ""},
+		{"deployment progress deadline exceeded", workload("Deployment", 1, map[string]interface{}{}, progressDeadlineExceeded), false, "", `rollout exceeded its progress deadline: ReplicaSet "app-5d4" has timed out progressing.`},
+		{"statefulset ready", workload("StatefulSet", 1, map[string]interface{}{"replicas": int64(3)}, map[string]interface{}{"observedGeneration": int64(1), "readyReplicas": int64(3), "currentRevision": "app-1", "updateRevision": "app-1"}), true, "", ""},
+		{"statefulset updating", workload("StatefulSet", 1, map[string]interface{}{"replicas": int64(3)}, map[string]interface{}{"observedGeneration": int64(1), "readyReplicas": int64(3), "updatedReplicas": int64(1), "currentRevision": "app-1", "updateRevision": "app-2"}), false, "1 of 3 replicas updated", ""},
+		{"daemonset not ready", workload("DaemonSet", 1, map[string]interface{}{}, map[string]interface{}{"observedGeneration": int64(1), "desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(2)}), false, "2 of 3 updated pods available", ""},
+		{"job complete", workload("Job", 1, map[string]interface{}{}, map[string]interface{}{"succeeded": int64(1)}), true, "", ""},
+		{"job running", workload("Job", 1, map[string]interface{}{"completions": int64(2)}, map[string]interface{}{"succeeded": int64(1)}), false, "1 of 2 completions succeeded", ""},
+		{"job failed", workload("Job", 1, map[string]interface{}{}, jobFailed), false, "", "job failed (BackoffLimitExceeded): Job has reached the specified backoff limit"},
+		{"configmap", workload("ConfigMap", 1, nil, nil), true, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done, message, err := Status(tt.object)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+			assert.Equal(t, tt.done, done)
+			assert.Equal(t, tt.message, message)
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/altiscope/platform-stack/pkg/apply"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+var (
+	podsResource                = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	replicaSetsResource         = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}
+	controllerRevisionsResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "controllerrevisions"}
+)
+
+const (
+	// deploymentRevisionAnnotation numbers the revisions of a Deployment and of its ReplicaSets
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	// controllerRevisionHashLabel names the revision of the StatefulSet or DaemonSet a pod was created from
+	controllerRevisionHashLabel = "controller-revision-hash"
+)
+
+// Waiter watches applied objects through the applier's client until their rollouts complete.
+type Waiter struct {
+	Applier *apply.Applier
+	// Out receives progress messages, which may be written from several goroutines at once.
+	Out io.Writer
+
+	mu sync.Mutex
+}
+
+// Wait watches each workload among the objects until it has rolled out, or ctx is done, returning the first failure.
+// The pods of each workload are watched as well, so that a crash looping container fails the wait straight away.
+func (w *Waiter) Wait(ctx context.Context, objects []*unstructured.Unstructured) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var workloads []*unstructured.Unstructured
+	for _, object := range objects {
+		if rollsOut(object) {
+			workloads = append(workloads, object)
+		}
+	}
+
+	errs := make(chan error, len(workloads))
+	for _, object := range workloads {
+		go func(object *unstructured.Unstructured) {
+			errs <- w.waitFor(ctx, object)
+		}(object)
+	}
+	var firstErr error
+	for range workloads {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	return firstErr
+}
+
+func rollsOut(object *unstructured.Unstructured) bool {
+	switch object.GroupVersionKind().GroupKind().String() {
+	case "Deployment.apps", "StatefulSet.apps", "DaemonSet.apps", "Job.batch":
+		return true
+	}
+	return false
+}
+
+func (w *Waiter) waitFor(ctx context.Context, object *unstructured.Unstructured) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ref := apply.Reference(object)
+	resource, err := w.Applier.ResourceFor(object)
+	if err != nil {
+		return err
+	}
+	live, err := resource.Get(ctx, object.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("%v: %w", ref, err)
+	}
+	selector, err := podSelector(live)
+	if err != nil {
+		return fmt.Errorf("%v: %w", ref, err)
+	}
+
+	podErr := make(chan error, 1)
+	go func() {
+		if selector == nil {
+			podErr <- nil
+			return
+		}
+		current := func(pod *unstructured.Unstructured) (bool, error) {
+			return w.currentPod(ctx, resource, object.GetName(), pod)
+		}
+		podErr <- w.watchPods(ctx, live.GetNamespace(), selector, current, ref)
+	}()
+	workloadErr := make(chan error, 1)
+	go func() {
+		workloadErr <- w.watchWorkload(ctx, resource, object.GetName(), ref)
+	}()
+
+	select {
+	case err := <-workloadErr:
+		return err
+	case err := <-podErr:
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		return <-workloadErr
+	}
+}
+
+// watchWorkload waits for the named workload to finish rolling out, reporting progress as it changes
+func (w *Waiter) watchWorkload(ctx context.Context, resource dynamic.ResourceInterface, name, ref string) error {
+	var last string
+	lw := listWatch(ctx, resource, metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String()})
+	_, err := watchtools.UntilWithSync(ctx, lw, &unstructured.Unstructured{}, nil, func(event watch.Event) (bool, error) {
+		live, ok := event.Object.(*unstructured.Unstructured)
+		if !ok || live.GetName() != name {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("%v was deleted while rolling out", ref)
+		}
+		done, message, err := Status(live)
+		if err != nil {
+			return false, fmt.Errorf("%v: %w", ref, err)
+		}
+		if done {
+			w.printf("%v rolled out\n", ref)
+			return true, nil
+		}
+		if message != last {
+			last = message
+			w.printf("Waiting for %v: %v\n", ref, message)
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		if last != "" {
+			return fmt.Errorf("timed out waiting for %v: %v", ref, last)
+		}
+		return fmt.Errorf("timed out waiting for %v to roll out", ref)
+	}
+	return err
+}
+
+// watchPods returns an error as soon as a selected pod of the current revision fails in a way that waiting will not
+// fix, and otherwise watches until ctx is done
+func (w *Waiter) watchPods(ctx context.Context, namespace string, selector labels.Selector, current func(*unstructured.Unstructured) (bool, error), ref string) error {
+	pods := w.Applier.Client.Resource(podsResource).Namespace(namespace)
+	lw := listWatch(ctx, pods, metav1.ListOptions{LabelSelector: selector.String()})
+	_, err := watchtools.UntilWithSync(ctx, lw, &unstructured.Unstructured{}, nil, func(event watch.Event) (bool, error) {
+		pod, ok := event.Object.(*unstructured.Unstructured)
+		if !ok || event.Type == watch.Deleted || !selector.Matches(labels.Set(pod.GetLabels())) {
+			return false, nil
+		}
+		failure := PodFailure(pod)
+		if failure == nil {
+			return false, nil
+		}
+		// the pods of earlier revisions are being replaced, and may be failing because of what the rollout fixes
+		if isCurrent, err := current(pod); err != nil || !isCurrent {
+			if err != nil {
+				return false, fmt.Errorf("%v: %w", ref, err)
+			}
+			return false, nil
+		}
+		return false, fmt.Errorf("%v: %w", ref, failure)
+	})
+	return err
+}
+
+// currentPod reports whether a pod was created from the current revision of the named workload. Until the workload's
+// controller has observed its latest spec, no pod is current. Pods whose revision cannot be told, such as those of
+// Jobs, are taken to be current.
+func (w *Waiter) currentPod(ctx context.Context, resource dynamic.ResourceInterface, name string, pod *unstructured.Unstructured) (bool, error) {
+	live, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	observed, found, _ := unstructured.NestedInt64(live.Object, "status", "observedGeneration")
+	if found && observed < live.GetGeneration() {
+		return false, nil
+	}
+
+	switch live.GetKind() {
+	case "Deployment":
+		owner := metav1.GetControllerOf(pod)
+		if owner == nil || owner.Kind != "ReplicaSet" {
+			return true, nil
+		}
+		replicaSet, err := w.Applier.Client.Resource(replicaSetsResource).Namespace(pod.GetNamespace()).Get(ctx, owner.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		revision := live.GetAnnotations()[deploymentRevisionAnnotation]
+		return revision == "" || replicaSet.GetAnnotations()[deploymentRevisionAnnotation] == revision, nil
+	case "StatefulSet":
+		revision, _, _ := unstructured.NestedString(live.Object, "status", "updateRevision")
+		hash := pod.GetLabels()[controllerRevisionHashLabel]
+		return revision == "" || hash == "" || hash == revision, nil
+	case "DaemonSet":
+		hash, err := w.daemonSetRevisionHash(ctx, live)
+		if err != nil {
+			return false, err
+		}
+		podHash := pod.GetLabels()[controllerRevisionHashLabel]
+		return hash == "" || podHash == "" || podHash == hash, nil
+	}
+	return true, nil
+}
+
+// daemonSetRevisionHash returns the hash of the latest ControllerRevision of a DaemonSet, as its pods are labelled
+func (w *Waiter) daemonSetRevisionHash(ctx context.Context, daemonSet *unstructured.Unstructured) (string, error) {
+	revisions, err := w.Applier.Client.Resource(controllerRevisionsResource).Namespace(daemonSet.GetNamespace()).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	var hash string
+	var latest int64
+	for _, revision := range revisions.Items {
+		owner := metav1.GetControllerOf(&revision)
+		if owner == nil || owner.UID != daemonSet.GetUID() {
+			continue
+		}
+		if number, _, _ := unstructured.NestedInt64(revision.Object, "revision"); number >= latest {
+			latest = number
+			hash = revision.GetLabels()[controllerRevisionHashLabel]
+		}
+	}
+	return hash, nil
+}
+
+// PodFailure returns an error describing a container of the pod that is crash looping.
+func PodFailure(pod *unstructured.Unstructured) error {
+	for _, field := range []string{"initContainerStatuses", "containerStatuses"} {
+		statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", field)
+		for _, s := range statuses {
+			status, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			reason, _, _ := unstructured.NestedString(status, "state", "waiting", "reason")
+			if reason != "CrashLoopBackOff" {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(status, "name")
+			err := fmt.Errorf("container `%v` of pod `%v` is in CrashLoopBackOff", name, pod.GetName())
+			if terminated, found, _ := unstructured.NestedMap(status, "lastState", "terminated"); found {
+				exitCode, _, _ := unstructured.NestedInt64(terminated, "exitCode")
+				lastReason, _, _ := unstructured.NestedString(terminated, "reason")
+				err = fmt.Errorf("%v, last terminated with exit code %v (%v)", err, exitCode, lastReason)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// podSelector returns the selector of the pods managed by a workload, or nil if it has none
+func podSelector(object *unstructured.Unstructured) (labels.Selector, error) {
+	raw, found, err := unstructured.NestedMap(object.Object, "spec", "selector")
+	if err != nil || !found {
+		return nil, err
+	}
+	selector := &metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, selector); err != nil {
+		return nil, err
+	}
+	return metav1.LabelSelectorAsSelector(selector)
+}
+
+func listWatch(ctx context.Context, resource dynamic.ResourceInterface, selectors metav1.ListOptions) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selectors.LabelSelector
+			options.FieldSelector = selectors.FieldSelector
+			return resource.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selectors.LabelSelector
+			options.FieldSelector = selectors.FieldSelector
+			return resource.Watch(ctx, options)
+		},
+	}
+}
+
+func (w *Waiter) printf(format string, args ...interface{}) {
+	if w.Out == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, _ = fmt.Fprintf(w.Out, format, args...)
+}
@@ -0,0 +1,155 @@
+package rollout
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/altiscope/platform-stack/pkg/apply"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+var deploymentsResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+func fakeWaiter(objects ...runtime.Object) (*Waiter, *fake.FakeDynamicClient, *bytes.Buffer) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	var out bytes.Buffer
+	return &Waiter{Applier: &apply.Applier{Client: client, Mapper: mapper, Namespace: "testns"}, Out: &out}, client, &out
+}
+
+func deployment(status map[string]interface{}) *unstructured.Unstructured {
+	object := workload("Deployment", 1, map[string]interface{}{
+		"replicas": int64(1),
+		"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "app"}},
+	}, status)
+	return object
+}
+
+func pod(containerStatus map[string]interface{}) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{"containerStatuses": []interface{}{containerStatus}},
+	}}
+	object.SetAPIVersion("v1")
+	object.SetKind("Pod")
+	object.SetName("app-5d4-x7k")
+	object.SetNamespace("testns")
+	object.SetLabels(map[string]string{"app": "app"})
+	return object
+}
+
+func TestWaitForRollout(t *testing.T) {
+	rollingOut := deployment(map[string]interface{}{"observedGeneration": int64(1), "replicas": int64(1), "updatedReplicas": int64(1)})
+	waiter, client, out := fakeWaiter(rollingOut.DeepCopy(), workload("ConfigMap", 1, nil, nil))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rolledOut := rollingOut.DeepCopy()
+		_ = unstructured.SetNestedField(rolledOut.Object, int64(1), "status", "availableReplicas")
+		_, _ = client.Resource(deploymentsResource).Namespace("testns").Update(context.Background(), rolledOut, metav1.UpdateOptions{})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := waiter.Wait(ctx, []*unstructured.Unstructured{workload("ConfigMap", 1, nil, nil), rollingOut})
+	assert.NoError(t, err)
+	assert.Equal(t, "Waiting for deployment.apps/app: 0 of 1 updated replicas available\ndeployment.apps/app rolled out\n", out.String())
+}
+
+func TestWaitFailsOnCrashLoop(t *testing.T) {
+	rollingOut := deployment(map[string]interface{}{"observedGeneration": int64(1), "replicas": int64(1), "updatedReplicas": int64(1)})
+	crashing := pod(map[string]interface{}{
+		"name":      "app",
+		"state":     map[string]interface{}{"waiting": map[string]interface{}{"reason": "CrashLoopBackOff"}},
+		"lastState": map[string]interface{}{"terminated": map[string]interface{}{"exitCode": int64(1), "reason": "Error"}},
+	})
+	waiter, _, _ := fakeWaiter(rollingOut.DeepCopy(), crashing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := waiter.Wait(ctx, []*unstructured.Unstructured{rollingOut})
+	assert.EqualError(t, err, "deployment.apps/app: container `app` of pod `app-5d4-x7k` is in CrashLoopBackOff, last terminated with exit code 1 (Error)")
+}
+
+func replicaSet(name, revision string) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion("apps/v1")
+	object.SetKind("ReplicaSet")
+	object.SetName(name)
+	object.SetNamespace("testns")
+	object.SetAnnotations(map[string]string{"deployment.kubernetes.io/revision": revision})
+	return object
+}
+
+func TestWaitIgnoresPodsOfEarlierRevisions(t *testing.T) {
+	rollingOut := deployment(map[string]interface{}{"observedGeneration": int64(1), "replicas": int64(1), "updatedReplicas": int64(1)})
+	rollingOut.SetAnnotations(map[string]string{"deployment.kubernetes.io/revision": "2"})
+	controller := true
+	ownedBy := func(pod *unstructured.Unstructured, name, hash string) *unstructured.Unstructured {
+		pod.SetName(name + "-x7k")
+		pod.SetLabels(map[string]string{"app": "app", "pod-template-hash": hash})
+		pod.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: name, Controller: &controller}})
+		return pod
+	}
+	crashing := ownedBy(pod(map[string]interface{}{
+		"name":      "app",
+		"state":     map[string]interface{}{"waiting": map[string]interface{}{"reason": "CrashLoopBackOff"}},
+		"lastState": map[string]interface{}{"terminated": map[string]interface{}{"exitCode": int64(1), "reason": "Error"}},
+	}), "app-5d4", "5d4")
+	healthy := ownedBy(pod(map[string]interface{}{
+		"name":  "app",
+		"state": map[string]interface{}{"running": map[string]interface{}{}},
+	}), "app-7f9", "7f9")
+	waiter, client, out := fakeWaiter(rollingOut.DeepCopy(), replicaSet("app-5d4", "1"), replicaSet("app-7f9", "2"), crashing, healthy)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rolledOut := rollingOut.DeepCopy()
+		_ = unstructured.SetNestedField(rolledOut.Object, int64(1), "status", "availableReplicas")
+		_, _ = client.Resource(deploymentsResource).Namespace("testns").Update(context.Background(), rolledOut, metav1.UpdateOptions{})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := waiter.Wait(ctx, []*unstructured.Unstructured{rollingOut})
+	assert.NoError(t, err, "the crash-looping pod belongs to the ReplicaSet being replaced")
+	assert.Equal(t, "Waiting for deployment.apps/app: 0 of 1 updated replicas available\ndeployment.apps/app rolled out\n", out.String())
+
+	crashing.SetOwnerReferences(healthy.GetOwnerReferences())
+	waiter, _, _ = fakeWaiter(rollingOut.DeepCopy(), replicaSet("app-7f9", "2"), crashing)
+	err = waiter.Wait(ctx, []*unstructured.Unstructured{rollingOut})
+	assert.EqualError(t, err, "deployment.apps/app: container `app` of pod `app-5d4-x7k` is in CrashLoopBackOff, last terminated with exit code 1 (Error)")
+}
+
+func TestWaitTimeout(t *testing.T) {
+	rollingOut := deployment(map[string]interface{}{"observedGeneration": int64(1), "replicas": int64(1), "updatedReplicas": int64(0)})
+	waiter, _, _ := fakeWaiter(rollingOut.DeepCopy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := waiter.Wait(ctx, []*unstructured.Unstructured{rollingOut})
+	assert.EqualError(t, err, "timed out waiting for deployment.apps/app: 0 of 1 replicas updated")
+}
+
+func TestCurrentPodOfStatefulSet(t *testing.T) {
+	statefulSet := workload("StatefulSet", 2, nil, map[string]interface{}{"observedGeneration": int64(2), "updateRevision": "app-7f9"})
+	waiter, _, _ := fakeWaiter(statefulSet)
+	resource := waiter.Applier.Client.Resource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}).Namespace("testns")
+
+	for hash, want := range map[string]bool{"app-7f9": true, "app-5d4": false, "": true} {
+		crashing := pod(nil)
+		crashing.SetLabels(map[string]string{"app": "app", "controller-revision-hash": hash})
+		current, err := waiter.currentPod(context.Background(), resource, "app", crashing)
+		assert.NoError(t, err)
+		assert.Equal(t, want, current, hash)
+	}
+}
@@ -0,0 +1,93 @@
+package sbom
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type cycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Licenses   []cycloneDXLicenses `json:"licenses,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXLicenses struct {
+	Expression string            `json:"expression,omitempty"`
+	License    *cycloneDXLicense `json:"license,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// encodeCycloneDX describes an image as a CycloneDX 1.4 JSON document
+func encodeCycloneDX(image Image, inventory Inventory, metadata Metadata) ([]byte, error) {
+	document := cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + documentID(FormatCycloneDX, image, metadata),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: metadata.Created.UTC().Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: metadata.Tool, Version: metadata.Version}},
+			Component: cycloneDXComponent{BOMRef: image.ID, Type: "container", Name: image.Name, Version: image.ID},
+		},
+		Components: []cycloneDXComponent{},
+	}
+	if inventory.Distro.ID != "" {
+		document.Components = append(document.Components, cycloneDXComponent{
+			BOMRef:  "os:" + inventory.Distro.ID,
+			Type:    "operating-system",
+			Name:    inventory.Distro.ID,
+			Version: inventory.Distro.VersionID,
+		})
+	}
+	for _, pkg := range inventory.Packages {
+		purl := pkg.PURL(inventory.Distro)
+		component := cycloneDXComponent{
+			BOMRef:     purl + "#" + pkg.Location,
+			Type:       "library",
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			PURL:       purl,
+			Properties: []cycloneDXProperty{{Name: "stack:location", Value: pkg.Location}},
+		}
+		switch {
+		case spdxLicense.MatchString(pkg.License):
+			component.Licenses = []cycloneDXLicenses{{Expression: pkg.License}}
+		case pkg.License != "":
+			component.Licenses = []cycloneDXLicenses{{License: &cycloneDXLicense{Name: pkg.License}}}
+		}
+		document.Components = append(document.Components, component)
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
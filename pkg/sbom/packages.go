@@ -0,0 +1,233 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Package types, as used in package URLs.
+const (
+	TypeDeb  = "deb"
+	TypeApk  = "apk"
+	TypePyPI = "pypi"
+	TypeNpm  = "npm"
+)
+
+// Package is a package installed in an image.
+type Package struct {
+	Name    string
+	Version string
+	// Type is the kind of package, e.g. `deb` or `npm`.
+	Type string
+	// License is the declared license, as written by the package, if any.
+	License string
+	// Location is the path of the database or manifest the package was found in.
+	Location string
+}
+
+// Distro identifies the operating system of an image, from its os-release file.
+type Distro struct {
+	ID         string
+	VersionID  string
+	PrettyName string
+}
+
+// Inventory is the content of an image.
+type Inventory struct {
+	Distro   Distro
+	Packages []Package
+}
+
+// isPackageDatabase reports whether a file of an image describes installed packages or the operating system
+func isPackageDatabase(name string) bool {
+	switch {
+	case name == "etc/os-release" || name == "usr/lib/os-release":
+		return true
+	case name == "var/lib/dpkg/status" || path.Dir(name) == "var/lib/dpkg/status.d":
+		return true
+	case name == "lib/apk/db/installed":
+		return true
+	case path.Base(name) == "METADATA" && strings.HasSuffix(path.Dir(name), ".dist-info"):
+		return true
+	case path.Base(name) == "package.json":
+		return isNodeModule(path.Dir(name))
+	}
+	return false
+}
+
+// isNodeModule reports whether a directory is an installed npm package, e.g. `node_modules/@scope/name`
+func isNodeModule(directory string) bool {
+	parent := path.Dir(directory)
+	if strings.HasPrefix(path.Base(parent), "@") {
+		parent = path.Dir(parent)
+	}
+	return path.Base(parent) == "node_modules"
+}
+
+// inventory parses the package databases of a filesystem
+func inventory(filesystem map[string][]byte) Inventory {
+	var result Inventory
+	if release, ok := filesystem["etc/os-release"]; ok {
+		result.Distro = parseOSRelease(release)
+	} else if release, ok := filesystem["usr/lib/os-release"]; ok {
+		result.Distro = parseOSRelease(release)
+	}
+	for _, name := range sortedNames(filesystem) {
+		var packages []Package
+		switch {
+		case name == "var/lib/dpkg/status" || path.Dir(name) == "var/lib/dpkg/status.d":
+			packages = parseDpkgStatus(filesystem[name])
+		case name == "lib/apk/db/installed":
+			packages = parseApkInstalled(filesystem[name])
+		case path.Base(name) == "METADATA":
+			packages = parsePythonMetadata(filesystem[name])
+		case path.Base(name) == "package.json":
+			packages = parsePackageJSON(filesystem[name])
+		}
+		for _, pkg := range packages {
+			pkg.Location = "/" + name
+			result.Packages = append(result.Packages, pkg)
+		}
+	}
+	sort.SliceStable(result.Packages, func(i, j int) bool {
+		a, b := result.Packages[i], result.Packages[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	return result
+}
+
+// parseOSRelease reads the identity of the operating system from an os-release file
+func parseOSRelease(content []byte) Distro {
+	var distro Distro
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(parts[1], `"'`)
+		switch parts[0] {
+		case "ID":
+			distro.ID = value
+		case "VERSION_ID":
+			distro.VersionID = value
+		case "PRETTY_NAME":
+			distro.PrettyName = value
+		}
+	}
+	return distro
+}
+
+// parseDpkgStatus reads the installed packages of a dpkg status file, whose paragraphs of `Field: value` lines
+// describe a package each
+func parseDpkgStatus(content []byte) []Package {
+	var packages []Package
+	for _, paragraph := range paragraphs(content) {
+		fields := headerFields(paragraph)
+		status := fields["Status"]
+		if fields["Package"] == "" || (status != "" && !strings.HasSuffix(status, " installed")) {
+			continue
+		}
+		packages = append(packages, Package{Name: fields["Package"], Version: fields["Version"], Type: TypeDeb})
+	}
+	return packages
+}
+
+// parseApkInstalled reads the packages of an apk database, whose paragraphs of `K:value` lines describe a package each
+func parseApkInstalled(content []byte) []Package {
+	var packages []Package
+	for _, paragraph := range paragraphs(content) {
+		var pkg Package
+		for _, line := range strings.Split(paragraph, "\n") {
+			if len(line) < 2 || line[1] != ':' {
+				continue
+			}
+			switch line[0] {
+			case 'P':
+				pkg.Name = line[2:]
+			case 'V':
+				pkg.Version = line[2:]
+			case 'L':
+				pkg.License = line[2:]
+			}
+		}
+		if pkg.Name != "" {
+			pkg.Type = TypeApk
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+// parsePythonMetadata reads the package a dist-info METADATA file describes
+func parsePythonMetadata(content []byte) []Package {
+	header := paragraphs(content)
+	if len(header) == 0 {
+		return nil
+	}
+	fields := headerFields(header[0])
+	if fields["Name"] == "" {
+		return nil
+	}
+	return []Package{{Name: fields["Name"], Version: fields["Version"], Type: TypePyPI, License: fields["License"]}}
+}
+
+// parsePackageJSON reads the package an installed npm package.json describes, skipping manifests that are not valid,
+// such as the templates of scaffolding packages
+func parsePackageJSON(content []byte) []Package {
+	var manifest struct {
+		Name    string          `json:"name"`
+		Version string          `json:"version"`
+		License json.RawMessage `json:"license"`
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil || manifest.Name == "" {
+		return nil
+	}
+	// licenses are usually SPDX expressions, but older packages use a {"type": ...} object
+	var license string
+	if err := json.Unmarshal(manifest.License, &license); err != nil {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(manifest.License, &typed)
+		license = typed.Type
+	}
+	return []Package{{Name: manifest.Name, Version: manifest.Version, Type: TypeNpm, License: license}}
+}
+
+// paragraphs splits content at blank lines
+func paragraphs(content []byte) []string {
+	var result []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.Trim(paragraph, "\n"); paragraph != "" {
+			result = append(result, paragraph)
+		}
+	}
+	return result
+}
+
+// headerFields reads the `Field: value` lines of a paragraph, skipping continuation lines
+func headerFields(paragraph string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(paragraph, "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		if parts := strings.SplitN(line, ":", 2); len(parts) == 2 {
+			if _, seen := fields[parts[0]]; !seen {
+				fields[parts[0]] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,44 @@
+package sbom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseApkInstalled(t *testing.T) {
+	installed := "C:Q1abc=\nP:musl\nV:1.2.3-r4\nA:x86_64\nL:MIT\n\nC:Q1def=\nP:busybox\nV:1.35.0-r17\nL:GPL-2.0-only\n"
+	assert.Equal(t, []Package{
+		{Name: "musl", Version: "1.2.3-r4", Type: TypeApk, License: "MIT"},
+		{Name: "busybox", Version: "1.35.0-r17", Type: TypeApk, License: "GPL-2.0-only"},
+	}, parseApkInstalled([]byte(installed)))
+}
+
+func TestParseDpkgStatus(t *testing.T) {
+	// distroless images list a package per file of status.d, without a Status field
+	status := "Package: libc6\nVersion: 2.31-13\nDescription: GNU C Library\n Package: not-a-field\n"
+	assert.Equal(t, []Package{{Name: "libc6", Version: "2.31-13", Type: TypeDeb}}, parseDpkgStatus([]byte(status)))
+}
+
+func TestParsePackageJSON(t *testing.T) {
+	assert.Equal(t, []Package{{Name: "old", Version: "0.1.0", Type: TypeNpm, License: "BSD"}}, parsePackageJSON([]byte(`{"name":"old","version":"0.1.0","license":{"type":"BSD"}}`)))
+	assert.Empty(t, parsePackageJSON([]byte(`{"name": {{ name }}}`)))
+}
+
+func TestIsPackageDatabase(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"etc/os-release":             true,
+		"var/lib/dpkg/status":        true,
+		"var/lib/dpkg/status.d/base": true,
+		"var/lib/dpkg/status-old":    false,
+		"lib/apk/db/installed":       true,
+		"usr/lib/python3.9/dist-packages/six-1.16.0.dist-info/METADATA": true,
+		"usr/lib/python3.9/METADATA":                                    false,
+		"node_modules/express/package.json":                             true,
+		"node_modules/@babel/core/package.json":                         true,
+		"node_modules/express/lib/package.json":                         false,
+		"app/package.json":                                              false,
+	} {
+		assert.Equal(t, expected, isPackageDatabase(name), name)
+	}
+}
@@ -0,0 +1,111 @@
+package sbom
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Formats of software bills of materials.
+const (
+	FormatSPDX      = "spdx"
+	FormatCycloneDX = "cyclonedx"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{FormatSPDX, FormatCycloneDX}
+
+// spdxLicense matches licenses that are SPDX license expressions, e.g. `MIT` or `GPL-2.0-only OR BSD-3-Clause`
+var spdxLicense = regexp.MustCompile(`^[A-Za-z0-9.+-]+( (AND|OR|WITH) [A-Za-z0-9.+-]+)*$`)
+
+// Image identifies the image a bill of materials describes.
+type Image struct {
+	// Name is the reference the image was built as, e.g. `localhost:5000/app:v1`.
+	Name string
+	// ID is the digest of the image configuration.
+	ID string
+}
+
+// Metadata describes the generation of a bill of materials.
+type Metadata struct {
+	// Tool names the generating tool, with its version.
+	Tool    string
+	Version string
+	Created time.Time
+}
+
+// Encode describes the inventory of an image as a JSON bill of materials in the given format.
+func Encode(format string, image Image, inventory Inventory, metadata Metadata) ([]byte, error) {
+	switch format {
+	case FormatSPDX:
+		return encodeSPDX(image, inventory, metadata)
+	case FormatCycloneDX:
+		return encodeCycloneDX(image, inventory, metadata)
+	}
+	return nil, fmt.Errorf("unknown SBOM format `%v`, expected one of %v", format, strings.Join(Formats, ", "))
+}
+
+// Extension returns the file extension of documents in the given format.
+func Extension(format string) string {
+	if format == FormatCycloneDX {
+		return ".cdx.json"
+	}
+	return ".spdx.json"
+}
+
+// PURL returns the package URL identifying a package, e.g. `pkg:deb/debian/bash@5.1-2?distro=debian-11`.
+func (p Package) PURL(distro Distro) string {
+	namespace := ""
+	var qualifiers []string
+	switch p.Type {
+	case TypeDeb, TypeApk:
+		namespace = distro.ID
+		if namespace == "" && p.Type == TypeApk {
+			namespace = "alpine"
+		} else if namespace == "" {
+			namespace = "debian"
+		}
+		if distro.VersionID != "" {
+			qualifiers = append(qualifiers, "distro="+purlEscape(distro.ID+"-"+distro.VersionID))
+		}
+	}
+	name := p.Name
+	if p.Type == TypePyPI {
+		name = strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	}
+	if p.Type == TypeNpm && strings.HasPrefix(name, "@") {
+		if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+			namespace, name = parts[0], parts[1]
+		}
+	}
+
+	purl := "pkg:" + p.Type + "/"
+	if namespace != "" {
+		purl += purlEscape(namespace) + "/"
+	}
+	purl += purlEscape(name)
+	if p.Version != "" {
+		purl += "@" + purlEscape(p.Version)
+	}
+	if len(qualifiers) > 0 {
+		purl += "?" + strings.Join(qualifiers, "&")
+	}
+	return purl
+}
+
+// purlEscape percent-encodes a package URL component
+func purlEscape(component string) string {
+	return strings.NewReplacer("@", "%40", ":", "%3A", "+", "%2B").Replace(url.PathEscape(component))
+}
+
+// documentID derives a stable UUID for a document from the image it describes and when it was generated
+func documentID(format string, image Image, metadata Metadata) string {
+	sum := sha256.Sum256([]byte(format + "\x00" + image.Name + "\x00" + image.ID + "\x00" + metadata.Created.UTC().Format(time.RFC3339Nano)))
+	// version 4 and variant bits, as expected of a random UUID
+	sum[6] = sum[6]&0x0f | 0x40
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,88 @@
+package sbom
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testImage     = Image{Name: "localhost:5000/app:v1", ID: "sha256:4d2a"}
+	testInventory = Inventory{
+		Distro: Distro{ID: "alpine", VersionID: "3.16.2"},
+		Packages: []Package{
+			{Name: "musl", Version: "1.2.3-r0", Type: TypeApk, License: "MIT", Location: "/lib/apk/db/installed"},
+			{Name: "@types/node", Version: "18.0.0", Type: TypeNpm, License: "Custom License", Location: "/app/node_modules/@types/node/package.json"},
+		},
+	}
+	testMetadata = Metadata{Tool: "stack", Version: "1.0.0", Created: time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)}
+)
+
+func TestPURL(t *testing.T) {
+	debian := Distro{ID: "debian", VersionID: "11"}
+	for expected, pkg := range map[string]Package{
+		"pkg:deb/debian/bash@5.1-2%2Bdeb11u1?distro=debian-11": {Name: "bash", Version: "5.1-2+deb11u1", Type: TypeDeb},
+		"pkg:deb/debian/libc6@1%3A2.31-13?distro=debian-11":    {Name: "libc6", Version: "1:2.31-13", Type: TypeDeb},
+		"pkg:pypi/typing-extensions@4.3.0":                     {Name: "Typing_Extensions", Version: "4.3.0", Type: TypePyPI},
+		"pkg:npm/%40babel/core@7.19.0":                         {Name: "@babel/core", Version: "7.19.0", Type: TypeNpm},
+	} {
+		assert.Equal(t, expected, pkg.PURL(debian))
+	}
+	assert.Equal(t, "pkg:apk/alpine/musl@1.2.3-r0", Package{Name: "musl", Version: "1.2.3-r0", Type: TypeApk}.PURL(Distro{}))
+}
+
+func TestEncodeSPDX(t *testing.T) {
+	encoded, err := Encode(FormatSPDX, testImage, testInventory, testMetadata)
+	assert.NoError(t, err)
+	var document spdxDocument
+	assert.NoError(t, json.Unmarshal(encoded, &document))
+
+	assert.Equal(t, "SPDX-2.3", document.SPDXVersion)
+	assert.Equal(t, "localhost:5000/app:v1", document.Name)
+	assert.Equal(t, spdxCreationInfo{Created: "2022-09-01T12:00:00Z", Creators: []string{"Tool: stack-1.0.0"}}, document.CreationInfo)
+	assert.Len(t, document.Packages, 3)
+	assert.Equal(t, spdxPackage{
+		SPDXID:           "SPDXRef-Package-apk-1",
+		Name:             "musl",
+		VersionInfo:      "1.2.3-r0",
+		DownloadLocation: "NOASSERTION",
+		LicenseConcluded: "NOASSERTION",
+		LicenseDeclared:  "MIT",
+		CopyrightText:    "NOASSERTION",
+		SourceInfo:       "acquired package info from /lib/apk/db/installed",
+		ExternalRefs:     []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: "pkg:apk/alpine/musl@1.2.3-r0?distro=alpine-3.16.2"}},
+	}, document.Packages[1])
+	assert.Equal(t, "NOASSERTION", document.Packages[2].LicenseDeclared)
+	assert.Equal(t, []spdxRelationship{
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Image"},
+		{SPDXElementID: "SPDXRef-Image", RelationshipType: "CONTAINS", RelatedSPDXElement: "SPDXRef-Package-apk-1"},
+		{SPDXElementID: "SPDXRef-Image", RelationshipType: "CONTAINS", RelatedSPDXElement: "SPDXRef-Package-npm-2"},
+	}, document.Relationships)
+
+	again, err := Encode(FormatSPDX, testImage, testInventory, testMetadata)
+	assert.NoError(t, err)
+	assert.Equal(t, string(encoded), string(again))
+}
+
+func TestEncodeCycloneDX(t *testing.T) {
+	encoded, err := Encode(FormatCycloneDX, testImage, testInventory, testMetadata)
+	assert.NoError(t, err)
+	var document cycloneDXDocument
+	assert.NoError(t, json.Unmarshal(encoded, &document))
+
+	assert.Equal(t, "CycloneDX", document.BOMFormat)
+	assert.Regexp(t, `^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, document.SerialNumber)
+	assert.Equal(t, cycloneDXComponent{BOMRef: "sha256:4d2a", Type: "container", Name: "localhost:5000/app:v1", Version: "sha256:4d2a"}, document.Metadata.Component)
+	assert.Len(t, document.Components, 3)
+	assert.Equal(t, cycloneDXComponent{BOMRef: "os:alpine", Type: "operating-system", Name: "alpine", Version: "3.16.2"}, document.Components[0])
+	assert.Equal(t, []cycloneDXLicenses{{Expression: "MIT"}}, document.Components[1].Licenses)
+	assert.Equal(t, []cycloneDXLicenses{{License: &cycloneDXLicense{Name: "Custom License"}}}, document.Components[2].Licenses)
+	assert.Equal(t, "pkg:npm/%40types/node@18.0.0", document.Components[2].PURL)
+}
+
+func TestEncodeUnknownFormat(t *testing.T) {
+	_, err := Encode("swid", testImage, testInventory, testMetadata)
+	assert.EqualError(t, err, "unknown SBOM format `swid`, expected one of spdx, cyclonedx")
+}
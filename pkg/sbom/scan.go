@@ -0,0 +1,150 @@
+// Package sbom lists the packages installed in a container image by reading the package databases of its filesystem
+// layers, and describes them as an SPDX or CycloneDX software bill of materials. It works offline, from the archive
+// `docker save` produces.
+package sbom
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxDatabaseSize bounds the size of a package database read into memory
+const maxDatabaseSize = 64 * 1024 * 1024
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// layer holds the package databases found in a filesystem layer, along with the paths the layer deletes
+type layer struct {
+	files     map[string][]byte
+	whiteouts []string
+	opaque    []string
+}
+
+// Scan reads a `docker save` archive of a single image, returning the packages installed in its filesystem.
+func Scan(archive io.Reader) (Inventory, error) {
+	layers := map[string]layer{}
+	var manifest []struct {
+		Layers []string `json:"Layers"`
+	}
+
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Inventory{}, fmt.Errorf("reading image archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(header.Name)
+		switch {
+		case name == "manifest.json":
+			if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+				return Inventory{}, fmt.Errorf("reading image archive manifest: %w", err)
+			}
+		case path.Base(name) == "layer.tar" || strings.HasPrefix(name, "blobs/"):
+			// blobs of OCI archives are configs and manifests as well as layers, which scanLayer tells apart
+			if scanned, ok := scanLayer(reader); ok {
+				layers[name] = scanned
+			}
+		}
+	}
+	if len(manifest) != 1 {
+		return Inventory{}, fmt.Errorf("image archive describes %v images, expected 1", len(manifest))
+	}
+
+	filesystem := map[string][]byte{}
+	for _, name := range manifest[0].Layers {
+		scanned, ok := layers[path.Clean(name)]
+		if !ok {
+			return Inventory{}, fmt.Errorf("image archive is missing layer `%v`", name)
+		}
+		for _, directory := range scanned.opaque {
+			removeTree(filesystem, directory, false)
+		}
+		for _, whiteout := range scanned.whiteouts {
+			removeTree(filesystem, whiteout, true)
+		}
+		for name, content := range scanned.files {
+			filesystem[name] = content
+		}
+	}
+	return inventory(filesystem), nil
+}
+
+// scanLayer reads the package databases and whiteouts of a layer tarball, which may be compressed. It reports false
+// for content that is not a tarball.
+func scanLayer(content io.Reader) (layer, bool) {
+	buffered := bufio.NewReader(content)
+	if magic, err := buffered.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return layer{}, false
+		}
+		defer decompressed.Close()
+		content = decompressed
+	} else {
+		content = buffered
+	}
+
+	scanned := layer{files: map[string][]byte{}}
+	reader := tar.NewReader(content)
+	for entries := 0; ; entries++ {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return scanned, true
+		}
+		if err != nil {
+			// a config or manifest blob fails on its first header, a truncated layer later on
+			return scanned, entries > 0
+		}
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		base := path.Base(name)
+		switch {
+		case base == opaqueWhiteout:
+			scanned.opaque = append(scanned.opaque, path.Dir(name))
+		case strings.HasPrefix(base, whiteoutPrefix):
+			scanned.whiteouts = append(scanned.whiteouts, path.Join(path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix)))
+		case header.Typeflag == tar.TypeReg && isPackageDatabase(name) && header.Size <= maxDatabaseSize:
+			file, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return scanned, true
+			}
+			scanned.files[name] = file
+		}
+	}
+}
+
+// removeTree deletes the files below a directory of the filesystem, and the directory itself when inclusive
+func removeTree(filesystem map[string][]byte, directory string, inclusive bool) {
+	for name := range filesystem {
+		if (inclusive && name == directory) || strings.HasPrefix(name, directory+"/") || directory == "." {
+			delete(filesystem, name)
+		}
+	}
+}
+
+// sortedNames returns the file names of a filesystem in order
+func sortedNames(filesystem map[string][]byte) []string {
+	names := make([]string, 0, len(filesystem))
+	for name := range filesystem {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
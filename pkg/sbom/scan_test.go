@@ -0,0 +1,92 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tarball archives files, named in order, with directories ending in a slash
+func tarball(t *testing.T, files ...[2]string) []byte {
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	for _, file := range files {
+		header := &tar.Header{Name: file[0], Mode: 0644, Size: int64(len(file[1])), Typeflag: tar.TypeReg}
+		if file[0][len(file[0])-1] == '/' {
+			header = &tar.Header{Name: file[0], Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		assert.NoError(t, writer.WriteHeader(header))
+		_, err := writer.Write([]byte(file[1]))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+	return archive.Bytes()
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write(content)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return compressed.Bytes()
+}
+
+func TestScan(t *testing.T) {
+	base := tarball(t,
+		[2]string{"etc/", ""},
+		[2]string{"etc/os-release", "ID=debian\nVERSION_ID=\"11\"\nPRETTY_NAME=\"Debian GNU/Linux 11 (bullseye)\"\n"},
+		[2]string{"var/lib/dpkg/status", "Package: bash\nStatus: install ok installed\nVersion: 5.1-2+deb11u1\n\nPackage: removed\nStatus: deinstall ok config-files\nVersion: 1.0\n"},
+		[2]string{"app/node_modules/left-pad/package.json", `{"name":"left-pad","version":"1.3.0","license":"WTFPL"}`},
+		[2]string{"app/node_modules/@types/node/package.json", `{"name":"@types/node","version":"18.0.0","license":"MIT"}`},
+		[2]string{"app/node_modules/left-pad/test/package.json", `{"name":"fixture"}`},
+		[2]string{"tmp/node_modules/cache/package.json", `{"name":"cache","version":"1.0.0"}`},
+	)
+	app := tarball(t,
+		[2]string{"./usr/lib/python3/site-packages/requests-2.28.1.dist-info/METADATA", "Metadata-Version: 2.1\nName: requests\nVersion: 2.28.1\nLicense: Apache 2.0\n\nRequests is an HTTP library.\n"},
+		[2]string{"tmp/.wh..wh..opq", ""},
+		[2]string{"app/node_modules/.wh.left-pad", ""},
+	)
+	config := `{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"}}`
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"docker", tarball(t,
+			[2]string{"manifest.json", `[{"Config":"c0nf1g.json","RepoTags":["app:v1"],"Layers":["b4se/layer.tar","4pp/layer.tar"]}]`},
+			[2]string{"c0nf1g.json", config},
+			[2]string{"b4se/layer.tar", string(base)},
+			[2]string{"4pp/layer.tar", string(app)},
+		)},
+		{"oci", tarball(t,
+			[2]string{"blobs/sha256/c0nf1g", config},
+			[2]string{"blobs/sha256/4pp", string(gzipped(t, app))},
+			[2]string{"blobs/sha256/b4se", string(base)},
+			[2]string{"manifest.json", `[{"Config":"blobs/sha256/c0nf1g","Layers":["blobs/sha256/b4se","blobs/sha256/4pp"]}]`},
+		)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inventory, err := Scan(bytes.NewReader(tt.archive))
+			assert.NoError(t, err)
+			assert.Equal(t, Distro{ID: "debian", VersionID: "11", PrettyName: "Debian GNU/Linux 11 (bullseye)"}, inventory.Distro)
+			assert.Equal(t, []Package{
+				{Name: "bash", Version: "5.1-2+deb11u1", Type: TypeDeb, Location: "/var/lib/dpkg/status"},
+				{Name: "@types/node", Version: "18.0.0", Type: TypeNpm, License: "MIT", Location: "/app/node_modules/@types/node/package.json"},
+				{Name: "requests", Version: "2.28.1", Type: TypePyPI, License: "Apache 2.0", Location: "/usr/lib/python3/site-packages/requests-2.28.1.dist-info/METADATA"},
+			}, inventory.Packages)
+		})
+	}
+}
+
+func TestScanInvalidArchive(t *testing.T) {
+	_, err := Scan(bytes.NewReader(tarball(t, [2]string{"manifest.json", `[{"Layers":["missing/layer.tar"]}]`})))
+	assert.EqualError(t, err, "image archive is missing layer `missing/layer.tar`")
+
+	_, err = Scan(bytes.NewReader(tarball(t, [2]string{"index.json", `{}`})))
+	assert.EqualError(t, err, "image archive describes 0 images, expected 1")
+}
@@ -0,0 +1,101 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const noAssertion = "NOASSERTION"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// encodeSPDX describes an image as an SPDX 2.3 JSON document
+func encodeSPDX(image Image, inventory Inventory, metadata Metadata) ([]byte, error) {
+	document := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              image.Name,
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%v-%v", metadata.Tool, documentID(FormatSPDX, image, metadata)),
+		CreationInfo: spdxCreationInfo{
+			Created:  metadata.Created.UTC().Format(time.RFC3339),
+			Creators: []string{fmt.Sprintf("Tool: %v-%v", metadata.Tool, metadata.Version)},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:           "SPDXRef-Image",
+			Name:             image.Name,
+			VersionInfo:      image.ID,
+			DownloadLocation: noAssertion,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+			PrimaryPurpose:   "CONTAINER",
+		}},
+		Relationships: []spdxRelationship{{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Image"}},
+	}
+	for i, pkg := range inventory.Packages {
+		license := noAssertion
+		if spdxLicense.MatchString(pkg.License) {
+			license = pkg.License
+		}
+		id := fmt.Sprintf("SPDXRef-Package-%v-%v", pkg.Type, i+1)
+		document.Packages = append(document.Packages, spdxPackage{
+			SPDXID:           id,
+			Name:             pkg.Name,
+			VersionInfo:      pkg.Version,
+			DownloadLocation: noAssertion,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  license,
+			CopyrightText:    noAssertion,
+			SourceInfo:       "acquired package info from " + pkg.Location,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  pkg.PURL(inventory.Distro),
+			}},
+		})
+		document.Relationships = append(document.Relationships, spdxRelationship{SPDXElementID: "SPDXRef-Image", RelationshipType: "CONTAINS", RelatedSPDXElement: id})
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
@@ -4,7 +4,7 @@ import (
 	"github.com/altiscope/platform-stack/pkg/schema/util"
 )
 
-const Version string = "stack/v1alpha1"
+const Version string = "stack/v1alpha2"
 
 func NewStackConfig() util.VersionedConfig {
 	return new(StackConfig)
@@ -19,12 +19,144 @@ type StackConfig struct {
 	Components   []ComponentDescription   `yaml:"components" json:"components"`
 	Environments []EnvironmentDescription `yaml:"environments" json:"environments"`
 	Stack        StackDescription         `yaml:"stack" json:"stack"`
+	Registry     RegistryDescription      `yaml:"registry" json:"registry"`
+	TagPolicy    TagPolicyDescription     `yaml:"tagPolicy" json:"tagPolicy"`
+	Secrets      SecretsDescription       `yaml:"secrets" json:"secrets"`
 }
 
 type StackDescription struct {
 	Name string `yaml:"name" json:"name"`
 }
 
+// RegistryDescription names the registry server images are tagged for and pushed to, e.g. `localhost:5000`,
+// with overrides for particular environments
+type RegistryDescription struct {
+	Default      string            `yaml:"default" json:"default"`
+	Environments map[string]string `yaml:"environments" json:"environments"`
+}
+
+// SecretsDescription configures the secrets `stack secrets` distributes to the cluster
+type SecretsDescription struct {
+	Registries []RegistrySecretDescription `yaml:"registries" json:"registries"`
+	// Backends are the secret stores the values of component secrets are read from. The first backend applying to an
+	// environment is used, and values are decrypted from the environment's `secrets-<env>.enc.yaml` when none does.
+	Backends []SecretBackendDescription `yaml:"backends" json:"backends"`
+}
+
+// SecretBackendDescription is the secret store of some environments. At most one store may be set, and values are
+// decrypted from the environment's `secrets-<env>.enc.yaml` when none is.
+type SecretBackendDescription struct {
+	// Environments limits the backend to the given environments, when any are given.
+	Environments []string `yaml:"environments" json:"environments"`
+
+	GSM   *GSMBackendDescription   `yaml:"gsm,omitempty" json:"gsm,omitempty"`
+	Vault *VaultBackendDescription `yaml:"vault,omitempty" json:"vault,omitempty"`
+}
+
+// GSMBackendDescription reads secrets from GCP Secret Manager.
+type GSMBackendDescription struct {
+	Project string `yaml:"project" json:"project"`
+	// KeyFile is the path of the key of the service account secrets are read with, relative to the stack directory and
+	// templated from environment variables. Secrets are read with the application default credentials when not given.
+	KeyFile string `yaml:"keyFile" json:"keyFile"`
+}
+
+// VaultBackendDescription reads secrets from the KV secrets engines of HashiCorp Vault.
+type VaultBackendDescription struct {
+	// Address defaults to VAULT_ADDR.
+	Address string `yaml:"address" json:"address"`
+	// Auth is the method Vault is logged in to with: token (the default), approle or kubernetes.
+	Auth string `yaml:"auth" json:"auth"`
+	// Role is the role of the kubernetes auth method, or the role ID of the approle method, defaulting to VAULT_ROLE_ID.
+	Role string `yaml:"role" json:"role"`
+	// AuthPath is the path the auth method is mounted at, defaulting to its name.
+	AuthPath string `yaml:"authPath" json:"authPath"`
+	// KVVersion is the version of the KV engines, looked up for each engine when not given.
+	KVVersion int `yaml:"kvVersion" json:"kvVersion"`
+}
+
+// RegistrySecretDescription is a `kubernetes.io/dockerconfigjson` secret holding the credentials of a registry, for
+// imagePullSecrets. Exactly one of the credential providers must be set, and their values are templated from
+// environment variables.
+type RegistrySecretDescription struct {
+	// Name is the name of the secret.
+	Name string `yaml:"name" json:"name"`
+	// Server is the registry server, defaulting to the registry configured for the current environment.
+	Server string `yaml:"server" json:"server"`
+	// Environments limits the secret to the given environments, when any are given.
+	Environments []string `yaml:"environments" json:"environments"`
+
+	UsernamePassword *UsernamePasswordCredentials `yaml:"usernamePassword,omitempty" json:"usernamePassword,omitempty"`
+	JSONKey          *JSONKeyCredentials          `yaml:"jsonKey,omitempty" json:"jsonKey,omitempty"`
+	ECR              *ECRCredentials              `yaml:"ecr,omitempty" json:"ecr,omitempty"`
+	DockerConfig     *DockerConfigCredentials     `yaml:"dockerConfig,omitempty" json:"dockerConfig,omitempty"`
+}
+
+// UsernamePasswordCredentials are a fixed username and password, such as those of an Azure service principal.
+type UsernamePasswordCredentials struct {
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+	Email    string `yaml:"email" json:"email"`
+}
+
+// JSONKeyCredentials are a Google service account JSON key, for Google Container Registry and Artifact Registry.
+type JSONKeyCredentials struct {
+	// KeyFile is the path of the key, relative to the stack directory.
+	KeyFile string `yaml:"keyFile" json:"keyFile"`
+	// Key is the key itself, for keys kept in environment variables.
+	Key string `yaml:"key" json:"key"`
+}
+
+// ECRCredentials are the login tokens of Amazon ECR, given by the AWS CLI.
+type ECRCredentials struct {
+	// Region defaults to the region of the registry server.
+	Region  string `yaml:"region" json:"region"`
+	Profile string `yaml:"profile" json:"profile"`
+}
+
+// DockerConfigCredentials are the credentials stored by `docker login`.
+type DockerConfigCredentials struct {
+	// Path is the docker config.json to read, defaulting to the one in DOCKER_CONFIG or ~/.docker.
+	Path string `yaml:"path" json:"path"`
+}
+
+// TagPolicyDescription chooses how images are tagged when no tag is given on the command line. At most one of the
+// strategies may be set, and images are tagged `latest` when none is.
+type TagPolicyDescription struct {
+	GitCommit   *GitCommitTagger   `yaml:"gitCommit,omitempty" json:"gitCommit,omitempty"`
+	GitTag      *GitTagTagger      `yaml:"gitTag,omitempty" json:"gitTag,omitempty"`
+	DateTime    *DateTimeTagger    `yaml:"dateTime,omitempty" json:"dateTime,omitempty"`
+	EnvTemplate *EnvTemplateTagger `yaml:"envTemplate,omitempty" json:"envTemplate,omitempty"`
+	// DirtyMarker appends `-dirty` to the tag when the stack's git working tree has uncommitted changes.
+	DirtyMarker bool `yaml:"dirtyMarker" json:"dirtyMarker"`
+}
+
+// GitCommitTagger tags images with the commit checked out in the stack directory.
+type GitCommitTagger struct {
+	Prefix string `yaml:"prefix" json:"prefix"`
+	// Full uses the full commit hash rather than the abbreviated one.
+	Full bool `yaml:"full" json:"full"`
+}
+
+// GitTagTagger tags images with `git describe --tags`: the latest tag, followed by the number of commits since and
+// the abbreviated commit when the checked out commit is not tagged itself.
+type GitTagTagger struct {
+	Prefix string `yaml:"prefix" json:"prefix"`
+}
+
+// DateTimeTagger tags images with the time of the build.
+type DateTimeTagger struct {
+	// Format is a Go time layout, defaulting to `2006-01-02_15-04-05`.
+	Format string `yaml:"format" json:"format"`
+	// TimeZone is an IANA time zone name such as `UTC`, defaulting to the local time zone.
+	TimeZone string `yaml:"timezone" json:"timezone"`
+}
+
+// EnvTemplateTagger tags images with a Go template executed over the environment, e.g. `{{ .RELEASE }}`.
+type EnvTemplateTagger struct {
+	Template string `yaml:"template" json:"template"`
+}
+
 type ActivationDescription struct {
 	ConfirmWithUser bool   `yaml:"confirmWithUser" json:"confirmWithUser"`
 	Env             string `yaml:"env" json:"env"`
@@ -34,6 +166,8 @@ type ActivationDescription struct {
 type EnvironmentDescription struct {
 	Name       string                `yaml:"name" json:"name"`
 	Activation ActivationDescription `yaml:"activation" json:"activation"`
+	// Local marks environments whose cluster runs on the host, so that built images are loaded into it.
+	Local bool `yaml:"local" json:"local"`
 }
 
 type ComponentDescription struct {
@@ -44,6 +178,22 @@ type ComponentDescription struct {
 	Containers        []ContainerDescription `yaml:"containers" json:"containers"`
 	Manifests         []string               `yaml:"manifests" json:"manifests"`
 	TemplateConfig    []string               `yaml:"templateConfig" json:"templateConfig"`
+	DependsOn         []string               `yaml:"dependsOn" json:"dependsOn"`
+	// Secrets are created in the cluster from the stack's secret backend before the component's manifests are applied.
+	Secrets []ComponentSecretDescription `yaml:"secrets" json:"secrets"`
+}
+
+// ComponentSecretDescription is a Kubernetes Secret holding values read from the stack's secret backend.
+type ComponentSecretDescription struct {
+	// Name is the name of the secret.
+	Name string `yaml:"name" json:"name"`
+	// Type is the type of the secret, defaulting to `Opaque`.
+	Type string `yaml:"type" json:"type"`
+	// Keys maps each key of the secret to the backend ID its value is read from, templated from environment variables,
+	// e.g. `API_KEY: platform-weather-API_KEY`.
+	Keys map[string]string `yaml:"keys" json:"keys"`
+	// Environments limits the secret to the given environments, when any are given.
+	Environments []string `yaml:"environments" json:"environments"`
 }
 
 type ContainerDescription struct {
@@ -51,6 +201,28 @@ type ContainerDescription struct {
 	Context      string   `yaml:"context" json:"context"`
 	Image        string   `yaml:"image" json:"image"`
 	Environments []string `yaml:"environments" json:"environments"`
+	// Platforms the image is built for, e.g. `linux/amd64`, defaulting to the platform of the builder.
+	Platforms []string `yaml:"platforms" json:"platforms"`
+	// BuildArgs are passed to the Dockerfile's ARG instructions. Values are templated from environment variables,
+	// e.g. `{{ .GIT_TOKEN }}`.
+	BuildArgs map[string]string `yaml:"buildArgs" json:"buildArgs"`
+	// Target is the stage of a multi-stage Dockerfile to build, defaulting to the last stage.
+	Target string `yaml:"target" json:"target"`
+	// Secrets are mounted by `RUN --mount=type=secret` instructions through BuildKit, without being stored in the image.
+	Secrets []BuildSecretDescription `yaml:"secrets" json:"secrets"`
+	// CacheFrom are images whose layers may be reused as build cache, templated from environment variables.
+	CacheFrom []string `yaml:"cacheFrom" json:"cacheFrom"`
+}
+
+// BuildSecretDescription is a build secret read from either a file or an environment variable.
+type BuildSecretDescription struct {
+	// ID is the id the Dockerfile mounts the secret by.
+	ID string `yaml:"id" json:"id"`
+	// Src is the path of a file holding the secret, relative to the stack directory and templated from environment
+	// variables.
+	Src string `yaml:"src" json:"src"`
+	// Env is the name of an environment variable holding the secret.
+	Env string `yaml:"env" json:"env"`
 }
 
 type ManifestDescription struct {
@@ -63,4 +235,6 @@ type Config struct {
 	Components   []ComponentDescription   `yaml:"components" json:"components"`
 	Environments []EnvironmentDescription `yaml:"environments" json:"environments"`
 	Stack        StackDescription         `yaml:"stack" json:"stack"`
+	Registry     RegistryDescription      `yaml:"registry" json:"registry"`
+	TagPolicy    TagPolicyDescription     `yaml:"tagPolicy" json:"tagPolicy"`
 }
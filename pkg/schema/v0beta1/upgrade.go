@@ -4,7 +4,7 @@ import (
 	skaffoldUtil "github.com/GoogleContainerTools/skaffold/pkg/skaffold/util"
 	"github.com/altiscope/platform-stack/pkg/schema/util"
 
-	next "github.com/altiscope/platform-stack/pkg/schema/latest"
+	next "github.com/altiscope/platform-stack/pkg/schema/v1alpha1"
 )
 
 // Upgrade upgrades a configuration to the next version.
@@ -3,7 +3,7 @@ package v0beta1
 import (
 	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/yaml"
 	"github.com/GoogleContainerTools/skaffold/testutil"
-	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	next "github.com/altiscope/platform-stack/pkg/schema/v1alpha1"
 	"testing"
 )
 
@@ -81,7 +81,7 @@ func verifyUpgrade(t *testing.T, input, output string) {
 	upgraded, err := config.Upgrade()
 	testutil.CheckError(t, false, err)
 
-	expected := latest.NewStackConfig()
+	expected := next.NewStackConfig()
 	err = yaml.UnmarshalStrict([]byte(output), expected)
 
 	testutil.CheckErrorAndDeepEqual(t, false, err, expected, upgraded)
@@ -0,0 +1,36 @@
+package v1alpha1
+
+import (
+	skaffoldUtil "github.com/GoogleContainerTools/skaffold/pkg/skaffold/util"
+	"github.com/altiscope/platform-stack/pkg/schema/util"
+
+	next "github.com/altiscope/platform-stack/pkg/schema/latest"
+)
+
+// Upgrade upgrades a configuration to the next version.
+// 1. Additions
+//  - DependsOn list added to ComponentDescription
+//  - Registry section added to StackConfig
+//  - TagPolicy section added to StackConfig
+//  - Local flag added to EnvironmentDescription
+//  - Platforms list added to ContainerDescription
+//  - BuildArgs, Target, Secrets and CacheFrom added to ContainerDescription
+//  - Secrets section added to StackConfig
+//  - Secrets list added to ComponentDescription
+// 2. No removal
+// 3. No Updates
+func (config *StackConfig) Upgrade() (util.VersionedConfig, error) {
+	var newComps []next.ComponentDescription
+	skaffoldUtil.CloneThroughYAML(config.Components, &newComps)
+	var newEnvs []next.EnvironmentDescription
+	skaffoldUtil.CloneThroughYAML(config.Environments, &newEnvs)
+	var newStack next.StackDescription
+	skaffoldUtil.CloneThroughYAML(config.Stack, &newStack)
+	nextConfig := &next.StackConfig{
+		ApiVersion:   next.Version,
+		Components:   newComps,
+		Environments: newEnvs,
+		Stack:        newStack,
+	}
+	return nextConfig, nil
+}
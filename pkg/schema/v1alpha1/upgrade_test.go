@@ -0,0 +1,82 @@
+package v1alpha1
+
+import (
+	"github.com/GoogleContainerTools/skaffold/pkg/skaffold/yaml"
+	"github.com/GoogleContainerTools/skaffold/testutil"
+	next "github.com/altiscope/platform-stack/pkg/schema/latest"
+	"testing"
+)
+
+func TestUpgrade_local(t *testing.T) {
+	yaml := `apiVersion: stack/v1alpha1
+stack:
+  name: app
+environments:
+  - name: local
+    activation:
+      env: ENV=local
+      context: docker-desktop || minikube || microk8s
+components:
+  - name: config
+    requiredVariables:
+      - ENV
+    manifests:
+      - ./deployments/config.yaml
+  - name: app
+    exposable: true
+    environments:
+      - local
+    containers:
+      - dockerfile: ./containers/app/Dockerfile
+        context: ./containers/app
+        image: stack-app
+    manifests:
+      - ./deployments/app.yaml
+`
+	expected := `apiVersion: stack/v1alpha2
+stack:
+  name: app
+environments:
+  - name: local
+    activation:
+      env: ENV=local
+      context: docker-desktop || minikube || microk8s
+components:
+  - name: config
+    requiredVariables:
+      - ENV
+    manifests:
+      - ./deployments/config.yaml
+    environments: []
+    containers: []
+    templateConfig: []
+  - name: app
+    exposable: true
+    environments:
+      - local
+    containers:
+      - dockerfile: ./containers/app/Dockerfile
+        context: ./containers/app
+        image: stack-app
+        environments: []
+    manifests:
+      - ./deployments/app.yaml
+    requiredVariables: []
+    templateConfig: []
+`
+	verifyUpgrade(t, yaml, expected)
+}
+
+func verifyUpgrade(t *testing.T, input, output string) {
+	config := NewStackConfig()
+	err := yaml.UnmarshalStrict([]byte(input), config)
+	testutil.CheckErrorAndDeepEqual(t, false, err, Version, config.GetVersion())
+
+	upgraded, err := config.Upgrade()
+	testutil.CheckError(t, false, err)
+
+	expected := next.NewStackConfig()
+	err = yaml.UnmarshalStrict([]byte(output), expected)
+
+	testutil.CheckErrorAndDeepEqual(t, false, err, expected, upgraded)
+}
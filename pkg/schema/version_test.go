@@ -170,6 +170,7 @@ func withBasicComponent(ops ...func(stackConfig *latest.EnvironmentDescription))
 						Dockerfile:   "./containers/app/Dockerfile",
 						Context:      "./containers/app",
 						Image:        "stack-app",
+						Environments: []string{},
 					},
 				},
 				Manifests: []string{"./deployments/app.yaml"},
@@ -19,6 +19,7 @@ import (
 	"github.com/altiscope/platform-stack/pkg/schema/util"
 	stackUtils "github.com/altiscope/platform-stack/pkg/schema/util"
 	"github.com/altiscope/platform-stack/pkg/schema/v0beta1"
+	"github.com/altiscope/platform-stack/pkg/schema/v1alpha1"
 	"github.com/blang/semver"
 	"gopkg.in/yaml.v2"
 	"regexp"
@@ -31,6 +32,7 @@ type APIVersion struct {
 
 var VersionList = Versions{
 	{v0beta1.Version, v0beta1.NewStackConfig},
+	{v1alpha1.Version, v1alpha1.NewStackConfig},
 	{latest.Version, latest.NewStackConfig},
 }
 
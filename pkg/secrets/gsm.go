@@ -0,0 +1,107 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gsmEndpoint        = "https://secretmanager.googleapis.com/v1/"
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// GSM reads secrets from GCP Secret Manager through its REST API.
+type GSM struct {
+	// Project is the project of secrets given by name alone.
+	Project string
+	// Client is an HTTP client authorized for Secret Manager.
+	Client *http.Client
+	// Endpoint is the base URL of the API, defaulting to the public one.
+	Endpoint string
+}
+
+// NewGSM returns a Secret Manager backend for a project, authenticated with a service account JSON key held in memory,
+// or with the application default credentials, such as those of `gcloud auth application-default login` or of the
+// workload's service account, when no key is given.
+func NewGSM(ctx context.Context, project string, key []byte) (*GSM, error) {
+	var (
+		credentials *google.Credentials
+		err         error
+	)
+	if key != nil {
+		credentials, err = google.CredentialsFromJSON(ctx, key, cloudPlatformScope)
+	} else {
+		credentials, err = google.FindDefaultCredentials(ctx, cloudPlatformScope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading GCP credentials: %w", err)
+	}
+	return &GSM{Project: project, Client: oauth2.NewClient(ctx, credentials.TokenSource)}, nil
+}
+
+// Secret accesses a version of a secret. IDs are the names of secrets in the project, whose latest version is read,
+// or the full resource names of secrets or their versions, such as `projects/p/secrets/s/versions/2`.
+func (g *GSM) Secret(ctx context.Context, id string) ([]byte, error) {
+	name := id
+	if !strings.HasPrefix(name, "projects/") {
+		if g.Project == "" {
+			return nil, fmt.Errorf("no GCP project given for secret `%v`", id)
+		}
+		name = fmt.Sprintf("projects/%v/secrets/%v", g.Project, name)
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = gsmEndpoint
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+name+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("accessing secret `%v`: %w", id, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("accessing secret `%v`: %w", id, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+				Status  string `json:"status"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &failure) == nil && failure.Error.Message != "" {
+			return nil, fmt.Errorf("accessing secret `%v`: %v (%v)", id, failure.Error.Message, failure.Error.Status)
+		}
+		return nil, fmt.Errorf("accessing secret `%v`: %v", id, resp.Status)
+	}
+
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &version); err != nil {
+		return nil, fmt.Errorf("accessing secret `%v`: %w", id, err)
+	}
+	value, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("accessing secret `%v`: %w", id, err)
+	}
+	return value, nil
+}
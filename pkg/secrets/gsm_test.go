@@ -0,0 +1,52 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGSMSecret(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/v1/projects/utmgsmdev/secrets/platform-api-key/versions/latest:access",
+			"/v1/projects/other/secrets/platform-api-key/versions/3:access":
+			// a2V5 is key
+			_, _ = w.Write([]byte(`{"name": "projects/1/secrets/platform-api-key/versions/3", "payload": {"data": "a2V5"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": {"code": 404, "message": "Secret [platform-token] not found or has no versions.", "status": "NOT_FOUND"}}`))
+		}
+	}))
+	defer server.Close()
+
+	gsm := &GSM{Project: "utmgsmdev", Client: server.Client(), Endpoint: server.URL + "/v1/"}
+	value, err := gsm.Secret(context.Background(), "platform-api-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "key", string(value))
+
+	value, err = gsm.Secret(context.Background(), "projects/other/secrets/platform-api-key/versions/3")
+	assert.NoError(t, err)
+	assert.Equal(t, "key", string(value))
+
+	_, err = gsm.Secret(context.Background(), "platform-token")
+	assert.EqualError(t, err, "accessing secret `platform-token`: Secret [platform-token] not found or has no versions. (NOT_FOUND)")
+	assert.Equal(t, "/v1/projects/utmgsmdev/secrets/platform-token/versions/latest:access", paths[2])
+
+	_, err = (&GSM{Client: server.Client()}).Secret(context.Background(), "platform-api-key")
+	assert.EqualError(t, err, "no GCP project given for secret `platform-api-key`")
+}
+
+func TestNewGSM(t *testing.T) {
+	_, err := NewGSM(context.Background(), "utmgsmdev", []byte("not a key"))
+	assert.Error(t, err)
+
+	gsm, err := NewGSM(context.Background(), "utmgsmdev", []byte(`{"type": "service_account", "client_email": "reader@utmgsmdev.iam.gserviceaccount.com", "private_key": "", "token_uri": "https://oauth2.googleapis.com/token"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "utmgsmdev", gsm.Project)
+}
@@ -0,0 +1,103 @@
+// Package secrets reads application secrets from secret stores, such as GCP Secret Manager, for the variables of a
+// stack's manifests.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Backend reads secrets from a secret store by their ID.
+type Backend interface {
+	Secret(ctx context.Context, id string) ([]byte, error)
+}
+
+// Fetch reads the secret of each variable from a backend, given a map of variable names to secret IDs, such as
+// `{"API_KEY": "platform-api-key"}`.
+func Fetch(ctx context.Context, backend Backend, ids map[string]string) (map[string]string, error) {
+	names := make([]string, 0, len(ids))
+	for name := range ids {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make(map[string]string, len(ids))
+	for _, name := range names {
+		value, err := backend.Secret(ctx, ids[name])
+		if err != nil {
+			return nil, fmt.Errorf("fetching `%v`: %w", name, err)
+		}
+		values[name] = string(value)
+	}
+	return values, nil
+}
+
+// ReadIDs reads a JSON file mapping variable names to secret IDs.
+func ReadIDs(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading secret IDs: %w", err)
+	}
+	var ids map[string]string
+	if err := json.Unmarshal(content, &ids); err != nil {
+		return nil, fmt.Errorf("reading secret IDs `%v`: %w", path, err)
+	}
+	return ids, nil
+}
+
+// ReadValues reads a JSON file mapping variable names to values, as written by WriteValues.
+func ReadValues(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets: %w", err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("reading secrets `%v`: %w", path, err)
+	}
+	return values, nil
+}
+
+// WriteValues writes the values of secrets to a JSON file mapping variable names to values, readable only by the
+// current user. The values are written to a new file that replaces the existing one, so they are never written to a file
+// with a looser mode.
+func WriteValues(path string, values map[string]string) error {
+	content, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	// TempFile creates files readable only by the current user
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return fmt.Errorf("writing secrets: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(append(content, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing secrets: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("writing secrets: %w", err)
+	}
+	return nil
+}
+
+// Fake is a backend holding secrets in memory, keyed by ID, for tests.
+type Fake map[string]string
+
+// Secret returns the secret with the given ID.
+func (f Fake) Secret(ctx context.Context, id string) ([]byte, error) {
+	value, ok := f[id]
+	if !ok {
+		return nil, fmt.Errorf("secret `%v` not found", id)
+	}
+	return []byte(value), nil
+}
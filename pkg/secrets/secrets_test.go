@@ -0,0 +1,60 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch(t *testing.T) {
+	backend := Fake{"platform-api-key": "key", "platform-db-password": "password"}
+	values, err := Fetch(context.Background(), backend, map[string]string{"API_KEY": "platform-api-key", "DB_PASSWORD": "platform-db-password"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"API_KEY": "key", "DB_PASSWORD": "password"}, values)
+
+	_, err = Fetch(context.Background(), backend, map[string]string{"API_KEY": "platform-api-key", "TOKEN": "platform-token"})
+	assert.EqualError(t, err, "fetching `TOKEN`: secret `platform-token` not found")
+}
+
+func TestReadWriteFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack-secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret-ids-ci.json"), []byte(`{"API_KEY": "platform-api-key"}`), 0644))
+	ids, err := ReadIDs(filepath.Join(dir, "secret-ids-ci.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"API_KEY": "platform-api-key"}, ids)
+
+	_, err = ReadIDs(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+
+	// existing files are replaced rather than written to, so values are never readable by others
+	path := filepath.Join(dir, "secrets-ci.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{}"), 0644))
+	assert.NoError(t, os.Link(path, filepath.Join(dir, "secrets-ci.json.link")))
+	assert.NoError(t, WriteValues(path, map[string]string{"API_KEY": "key"}))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	linked, err := ioutil.ReadFile(filepath.Join(dir, "secrets-ci.json.link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(linked), "the 0644 file is left unchanged")
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3, "no temporary files are left behind")
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n  \"API_KEY\": \"key\"\n}\n", string(content))
+	values, err := ReadValues(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"API_KEY": "key"}, values)
+
+	_, err = ReadValues(filepath.Join(dir, "missing.json"))
+	assert.True(t, os.IsNotExist(errors.Unwrap(err)))
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// SOPS reads secrets from a YAML or JSON file encrypted with sops, such as a `secrets-local.enc.yaml` committed beside
+// a stack. Files are decrypted with the `sops` CLI, which finds age keys in SOPS_AGE_KEY_FILE, or else
+// `~/.config/sops/age/keys.txt`. Secret IDs are the top level keys of the file.
+type SOPS struct {
+	Path string
+	// AgeKeyFile is the file of the age keys to decrypt with, overriding the one sops finds.
+	AgeKeyFile string
+
+	run    command
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// command runs a command with additional environment variables and the given standard streams
+type command func(ctx context.Context, env []string, stdin io.Reader, stdout, stderr io.Writer, name string, args ...string) error
+
+// runCommand runs a command with the environment of the current process
+func runCommand(ctx context.Context, env []string, stdin io.Reader, stdout, stderr io.Writer, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// Secret returns the value of a top level key of the file.
+func (s *SOPS) Secret(ctx context.Context, id string) ([]byte, error) {
+	values, err := s.Values(ctx)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := values[id]
+	if !ok {
+		return nil, fmt.Errorf("secret `%v` not found in `%v`", id, s.Path)
+	}
+	return []byte(value), nil
+}
+
+// Values decrypts the file, returning the value of each of its top level keys. Values that are not strings are given
+// in their JSON form. The file is only decrypted once.
+func (s *SOPS) Values(ctx context.Context) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values != nil {
+		return s.values, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := s.runner()(ctx, s.env(), nil, &stdout, &stderr, "sops", "--decrypt", "--output-type", "json", s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting `%v`: %v: %v", s.Path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	decoder := json.NewDecoder(&stdout)
+	decoder.UseNumber()
+	var decrypted map[string]interface{}
+	if err := decoder.Decode(&decrypted); err != nil {
+		return nil, fmt.Errorf("decrypting `%v`: expected a map of secrets: %w", s.Path, err)
+	}
+	values := make(map[string]string, len(decrypted))
+	for key, value := range decrypted {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case json.Number:
+			values[key] = v.String()
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = string(encoded)
+		}
+	}
+	s.values = values
+	return values, nil
+}
+
+// Edit opens the decrypted file in $EDITOR, encrypting it again once the editor exits with changes. Files that do not
+// exist yet are created, encrypted for the given age recipients, or for those of the `.sops.yaml` creation rules when
+// none are given.
+func (s *SOPS) Edit(ctx context.Context, recipients []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := []string{s.Path}
+	if len(recipients) > 0 {
+		args = []string{"--age", strings.Join(recipients, ","), s.Path}
+	}
+	if err := s.runner()(ctx, s.env(), stdin, stdout, stderr, "sops", args...); err != nil {
+		// sops exits with 200 when the file was left unchanged
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 200 {
+			return nil
+		}
+		return fmt.Errorf("editing `%v`: %w", s.Path, err)
+	}
+	s.mu.Lock()
+	s.values = nil
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *SOPS) runner() command {
+	if s.run == nil {
+		return runCommand
+	}
+	return s.run
+}
+
+func (s *SOPS) env() []string {
+	if s.AgeKeyFile == "" {
+		return nil
+	}
+	return []string{"SOPS_AGE_KEY_FILE=" + s.AgeKeyFile}
+}
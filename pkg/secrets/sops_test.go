@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSOPS decrypts to the given JSON, recording the environment and arguments of each run
+func fakeSOPS(decrypted string, runs *[]string) command {
+	return func(ctx context.Context, env []string, stdin io.Reader, stdout, stderr io.Writer, name string, args ...string) error {
+		*runs = append(*runs, strings.TrimSpace(strings.Join(env, " ")+" "+name+" "+strings.Join(args, " ")))
+		if args[0] != "--decrypt" {
+			return nil
+		}
+		if decrypted == "" {
+			_, _ = fmt.Fprint(stderr, "Failed to get the data key required to decrypt the SOPS file.")
+			return fmt.Errorf("exit status 128")
+		}
+		_, _ = fmt.Fprint(stdout, decrypted)
+		return nil
+	}
+}
+
+func TestSOPSSecret(t *testing.T) {
+	var runs []string
+	sops := &SOPS{
+		Path:       "secrets-local.enc.yaml",
+		AgeKeyFile: "keys.txt",
+		run:        fakeSOPS(`{"API_KEY": "weather-key", "REPLICAS": 3, "LIMITS": {"daily": 100}}`, &runs),
+	}
+
+	value, err := sops.Secret(context.Background(), "API_KEY")
+	assert.NoError(t, err)
+	assert.Equal(t, "weather-key", string(value))
+	value, err = sops.Secret(context.Background(), "REPLICAS")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", string(value))
+	value, err = sops.Secret(context.Background(), "LIMITS")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"daily":100}`, string(value))
+	_, err = sops.Secret(context.Background(), "MISSING")
+	assert.EqualError(t, err, "secret `MISSING` not found in `secrets-local.enc.yaml`")
+
+	assert.Equal(t, []string{"SOPS_AGE_KEY_FILE=keys.txt sops --decrypt --output-type json secrets-local.enc.yaml"}, runs, "the file is decrypted once")
+
+	sops = &SOPS{Path: "secrets-ci.enc.yaml", run: fakeSOPS("", &runs)}
+	_, err = sops.Secret(context.Background(), "API_KEY")
+	assert.EqualError(t, err, "decrypting `secrets-ci.enc.yaml`: exit status 128: Failed to get the data key required to decrypt the SOPS file.")
+}
+
+func TestSOPSEdit(t *testing.T) {
+	var runs []string
+	sops := &SOPS{Path: "secrets-local.enc.yaml", run: fakeSOPS(`{"API_KEY": "weather-key"}`, &runs)}
+	_, err := sops.Values(context.Background())
+	assert.NoError(t, err)
+
+	assert.NoError(t, sops.Edit(context.Background(), nil, nil, nil, nil))
+	assert.NoError(t, sops.Edit(context.Background(), []string{"age1first", "age1second"}, nil, nil, nil))
+	_, err = sops.Values(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"sops --decrypt --output-type json secrets-local.enc.yaml",
+		"sops secrets-local.enc.yaml",
+		"sops --age age1first,age1second secrets-local.enc.yaml",
+		"sops --decrypt --output-type json secrets-local.enc.yaml",
+	}, runs, "edited files are decrypted again")
+}
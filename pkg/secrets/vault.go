@@ -0,0 +1,284 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// kubernetesTokenFile is where pods find the token of their service account
+const kubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Vault reads secrets from the KV secrets engines of HashiCorp Vault through its HTTP API. Secret IDs are the path of a
+// secret and the key of the value to read, such as `secret/platform/weather#API_KEY`. The key may be left out of
+// secrets holding a single value.
+type Vault struct {
+	// Address is the address of the Vault server, such as `https://vault.example.com:8200`.
+	Address string
+	// Token is the client token requests are made with, as set by Login.
+	Token string
+	// Namespace is the Vault Enterprise namespace of the secrets, if any.
+	Namespace string
+	// KVVersion is the version of the KV engines, 1 or 2. When 0, the version of each engine is looked up.
+	KVVersion int
+	Client    *http.Client
+
+	mu     sync.Mutex
+	mounts map[string]vaultMount
+}
+
+// vaultMount is a KV secrets engine
+type vaultMount struct {
+	path    string
+	version int
+}
+
+// VaultAuth logs in to Vault, returning a client token.
+type VaultAuth interface {
+	Login(ctx context.Context, vault *Vault) (string, error)
+}
+
+// VaultToken authenticates with an existing token, defaulting to VAULT_TOKEN or the token saved by `vault login`.
+type VaultToken string
+
+// Login returns the token.
+func (t VaultToken) Login(ctx context.Context, vault *Vault) (string, error) {
+	if t != "" {
+		return string(t), nil
+	}
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		if token, err := ioutil.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			return strings.TrimSpace(string(token)), nil
+		}
+	}
+	return "", fmt.Errorf("no Vault token found - set VAULT_TOKEN or run `vault login`")
+}
+
+// VaultAppRole authenticates with the role ID and secret ID of an AppRole.
+type VaultAppRole struct {
+	// Mount is the path of the auth method, defaulting to `approle`.
+	Mount    string
+	RoleID   string
+	SecretID string
+}
+
+// Login logs in with the AppRole.
+func (a VaultAppRole) Login(ctx context.Context, vault *Vault) (string, error) {
+	if a.RoleID == "" || a.SecretID == "" {
+		return "", fmt.Errorf("a role ID and secret ID are required to log in to Vault with AppRole")
+	}
+	return vault.login(ctx, mountOrDefault(a.Mount, "approle"), map[string]string{"role_id": a.RoleID, "secret_id": a.SecretID})
+}
+
+// VaultKubernetes authenticates with the token of a Kubernetes service account, as pods running in the cluster do.
+type VaultKubernetes struct {
+	// Mount is the path of the auth method, defaulting to `kubernetes`.
+	Mount string
+	Role  string
+	// JWT is the service account token, defaulting to the one mounted into pods.
+	JWT string
+}
+
+// Login logs in with the service account token.
+func (k VaultKubernetes) Login(ctx context.Context, vault *Vault) (string, error) {
+	if k.Role == "" {
+		return "", fmt.Errorf("a role is required to log in to Vault with Kubernetes auth")
+	}
+	jwt := k.JWT
+	if jwt == "" {
+		token, err := ioutil.ReadFile(kubernetesTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading the service account token for Vault: %w", err)
+		}
+		jwt = strings.TrimSpace(string(token))
+	}
+	return vault.login(ctx, mountOrDefault(k.Mount, "kubernetes"), map[string]string{"role": k.Role, "jwt": jwt})
+}
+
+func mountOrDefault(mount, defaultMount string) string {
+	if mount == "" {
+		return defaultMount
+	}
+	return strings.Trim(mount, "/")
+}
+
+// Login logs in with an auth method, keeping the token for the requests that follow.
+func (v *Vault) Login(ctx context.Context, auth VaultAuth) error {
+	token, err := auth.Login(ctx, v)
+	if err != nil {
+		return err
+	}
+	v.Token = token
+	return nil
+}
+
+// login logs in to an auth method mounted at mount
+func (v *Vault) login(ctx context.Context, mount string, credentials map[string]string) (string, error) {
+	body, err := json.Marshal(credentials)
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if found, err := v.request(ctx, http.MethodPost, "auth/"+mount+"/login", bytes.NewReader(body), &response); err != nil || !found {
+		if err == nil {
+			err = fmt.Errorf("no auth method mounted at `%v`", mount)
+		}
+		return "", fmt.Errorf("logging in to Vault: %w", err)
+	}
+	return response.Auth.ClientToken, nil
+}
+
+// Secret reads a value of a secret from its KV engine.
+func (v *Vault) Secret(ctx context.Context, id string) ([]byte, error) {
+	path, key := id, ""
+	if i := strings.LastIndex(id, "#"); i >= 0 {
+		path, key = id[:i], id[i+1:]
+	}
+	path = strings.Trim(path, "/")
+	mount, err := v.mount(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("reading secret `%v`: %w", id, err)
+	}
+
+	var data map[string]interface{}
+	var found bool
+	if mount.version == 2 {
+		var response struct {
+			Data struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"data"`
+		}
+		found, err = v.request(ctx, http.MethodGet, mount.path+"data/"+strings.TrimPrefix(path, mount.path), nil, &response)
+		data = response.Data.Data
+	} else {
+		var response struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		found, err = v.request(ctx, http.MethodGet, path, nil, &response)
+		data = response.Data
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading secret `%v`: %w", id, err)
+	}
+	if !found || data == nil {
+		return nil, fmt.Errorf("secret `%v` not found", path)
+	}
+
+	if key == "" {
+		if len(data) != 1 {
+			return nil, fmt.Errorf("secret `%v` holds %v values, name one as `%v#<key>`", path, len(data), path)
+		}
+		for k := range data {
+			key = k
+		}
+	}
+	value, ok := data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret `%v` has no key `%v`", path, key)
+	}
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(value)
+}
+
+// mount returns the KV engine holding a secret, looking up its version unless one was given
+func (v *Vault) mount(ctx context.Context, path string) (vaultMount, error) {
+	if v.KVVersion != 0 {
+		return vaultMount{path: strings.SplitN(path, "/", 2)[0] + "/", version: v.KVVersion}, nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for prefix, mount := range v.mounts {
+		if strings.HasPrefix(path+"/", prefix) {
+			return mount, nil
+		}
+	}
+
+	var response struct {
+		Data struct {
+			Path    string            `json:"path"`
+			Type    string            `json:"type"`
+			Options map[string]string `json:"options"`
+		} `json:"data"`
+	}
+	found, err := v.request(ctx, http.MethodGet, "sys/internal/ui/mounts/"+path, nil, &response)
+	if err != nil {
+		return vaultMount{}, err
+	}
+	if !found || response.Data.Path == "" {
+		return vaultMount{}, fmt.Errorf("no secrets engine is mounted at `%v`", path)
+	}
+	if response.Data.Type != "kv" && response.Data.Type != "generic" {
+		return vaultMount{}, fmt.Errorf("the secrets engine at `%v` is a `%v` engine, not a KV engine", response.Data.Path, response.Data.Type)
+	}
+	mount := vaultMount{path: response.Data.Path, version: 1}
+	if response.Data.Options["version"] == "2" {
+		mount.version = 2
+	}
+	if v.mounts == nil {
+		v.mounts = map[string]vaultMount{}
+	}
+	v.mounts[mount.path] = mount
+	return mount, nil
+}
+
+// request makes a request of the Vault API, decoding its response into out. Paths that are not found are reported
+// as such rather than as errors.
+func (v *Vault) request(ctx context.Context, method, path string, body io.Reader, out interface{}) (bool, error) {
+	if v.Address == "" {
+		return false, fmt.Errorf("no Vault address given - set VAULT_ADDR")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(v.Address, "/")+"/v1/"+path, body)
+	if err != nil {
+		return false, err
+	}
+	if v.Token != "" {
+		req.Header.Set("X-Vault-Token", v.Token)
+	}
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(content, &failure) == nil && len(failure.Errors) > 0 {
+			return false, fmt.Errorf("%v: %v", resp.Status, strings.Join(failure.Errors, ", "))
+		}
+		return false, fmt.Errorf("%v", resp.Status)
+	}
+	return true, json.Unmarshal(content, out)
+}
@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVault serves a KV v2 engine at `secret/` and a KV v1 engine at `kv/`, and the logins of the given tokens
+func fakeVault(t *testing.T, logins map[string]string) *httptest.Server {
+	mounts := map[string]string{"secret/": "2", "kv/": "1"}
+	secrets := map[string]string{
+		"/v1/secret/data/platform/weather": `{"data": {"data": {"API_KEY": "weather-key", "LIMITS": {"daily": 100}}, "metadata": {"version": 3}}}`,
+		"/v1/kv/platform/db":               `{"data": {"password": "db-password"}}`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/login") {
+			var credentials map[string]string
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&credentials))
+			token, ok := logins[r.URL.Path+" "+credentials["role_id"]+credentials["role"]]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors": ["invalid role ID"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth": {"client_token": "` + token + `"}}`))
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		if path := strings.TrimPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/"); path != r.URL.Path {
+			for mount, version := range mounts {
+				if strings.HasPrefix(path, mount) {
+					_, _ = w.Write([]byte(`{"data": {"path": "` + mount + `", "type": "kv", "options": {"version": "` + version + `"}}}`))
+					return
+				}
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors": ["no handler for route"]}`))
+			return
+		}
+		secret, ok := secrets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors": []}`))
+			return
+		}
+		_, _ = w.Write([]byte(secret))
+	}))
+}
+
+func TestVaultSecret(t *testing.T) {
+	server := fakeVault(t, nil)
+	defer server.Close()
+	vault := &Vault{Address: server.URL, Token: "root"}
+
+	values, err := Fetch(context.Background(), vault, map[string]string{
+		"WEATHER_API_KEY": "secret/platform/weather#API_KEY",
+		"WEATHER_LIMITS":  "secret/platform/weather#LIMITS",
+		"DB_PASSWORD":     "kv/platform/db",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"WEATHER_API_KEY": "weather-key", "WEATHER_LIMITS": `{"daily":100}`, "DB_PASSWORD": "db-password"}, values)
+
+	_, err = vault.Secret(context.Background(), "secret/platform/weather")
+	assert.EqualError(t, err, "secret `secret/platform/weather` holds 2 values, name one as `secret/platform/weather#<key>`")
+	_, err = vault.Secret(context.Background(), "secret/platform/weather#TOKEN")
+	assert.EqualError(t, err, "secret `secret/platform/weather` has no key `TOKEN`")
+	_, err = vault.Secret(context.Background(), "kv/platform/missing#password")
+	assert.EqualError(t, err, "secret `kv/platform/missing` not found")
+
+	// the engine version may be given rather than looked up
+	vault = &Vault{Address: server.URL, Token: "root", KVVersion: 1}
+	value, err := vault.Secret(context.Background(), "kv/platform/db#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "db-password", string(value))
+
+	vault = &Vault{Address: server.URL, Token: "expired"}
+	_, err = vault.Secret(context.Background(), "kv/platform/db#password")
+	assert.EqualError(t, err, "reading secret `kv/platform/db#password`: 403 Forbidden: permission denied")
+}
+
+func TestVaultLogin(t *testing.T) {
+	server := fakeVault(t, map[string]string{
+		"/v1/auth/approle/login stack-ci":         "root",
+		"/v1/auth/k8s-staging/login stack-reader": "root",
+	})
+	defer server.Close()
+
+	vault := &Vault{Address: server.URL}
+	assert.NoError(t, vault.Login(context.Background(), VaultAppRole{RoleID: "stack-ci", SecretID: "secret-id"}))
+	assert.Equal(t, "root", vault.Token)
+
+	vault = &Vault{Address: server.URL}
+	assert.NoError(t, vault.Login(context.Background(), VaultKubernetes{Mount: "k8s-staging", Role: "stack-reader", JWT: "jwt"}))
+	assert.Equal(t, "root", vault.Token)
+
+	err := vault.Login(context.Background(), VaultAppRole{RoleID: "unknown", SecretID: "secret-id"})
+	assert.EqualError(t, err, "logging in to Vault: 400 Bad Request: invalid role ID")
+	err = vault.Login(context.Background(), VaultAppRole{RoleID: "stack-ci"})
+	assert.EqualError(t, err, "a role ID and secret ID are required to log in to Vault with AppRole")
+
+	_ = os.Setenv("VAULT_TOKEN", "from-env")
+	defer os.Unsetenv("VAULT_TOKEN")
+	assert.NoError(t, vault.Login(context.Background(), VaultToken("")))
+	assert.Equal(t, "from-env", vault.Token)
+	assert.NoError(t, vault.Login(context.Background(), VaultToken("given")))
+	assert.Equal(t, "given", vault.Token)
+}
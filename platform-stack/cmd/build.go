@@ -1,26 +1,26 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/altiscope/platform-stack/pkg/sbom"
 	"github.com/altiscope/platform-stack/pkg/schema/latest"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
-const dockerBuildTemplate = `DOCKER_BUILDKIT=1 docker build {{if .NoCache}} --no-cache {{end}} --build-arg GIT_TOKEN="$GIT_TOKEN" {{if .GitHash}}--build-arg GIT_COMMIT=$(git rev-parse HEAD){{end}} -t {{.Tag}} -f {{.Dockerfile}} {{.Context}}`
-
 var noCache bool
 var gitHash bool
 
-type DockerBuildRequest struct {
-	Dockerfile string
-	Tag        string
-	Context    string
-	NoCache    bool
-	GitHash    bool
-}
+// newBuilder returns the builder images are built with: a BuildKit daemon when BUILDKIT_HOST is set, otherwise the
+// Docker Engine at DOCKER_HOST. It is replaced in tests.
+var newBuilder = build.FromEnvironment
 
 // buildCmd represents the build command
 var buildCmd = &cobra.Command{
@@ -29,13 +29,56 @@ var buildCmd = &cobra.Command{
 	Short: "Builds images for the given component using containers defined in config.",
 	Long: `Builds images for the given component using containers defined in config.
 This command can also be used to build a specific container for a specific component instead of building and tagging them all at once.
-An optional tag can be provided as a flag, or 'latest' will be used.
+An optional tag can be provided as a flag, or the stack's tagPolicy decides it, defaulting to 'latest'.
+Images are named for the registry configured for the current environment, if any, and pushed there with --push.
+
+Containers may declare buildArgs, a target stage, secrets mounted by RUN --mount=type=secret, and cacheFrom images.
+Build arg values, secret files and cacheFrom images are templated from environment variables, e.g. {{ .GIT_TOKEN }},
+and the build fails when a variable they use is not set. Secrets are built through buildx, or BuildKit when
+BUILDKIT_HOST is set.
+
+Images are built for the platforms configured for their container, or given with --platform. Images for several
+platforms are built as a multi-platform image through buildx, or BuildKit when BUILDKIT_HOST is set, and must be
+pushed with --push when built through buildx.
+
+With --load, or when the current environment is marked local, built images are loaded into the cluster of the current
+kube context: with 'kind load' for kind clusters, 'minikube image load' for minikube and 'microk8s ctr image import'
+for microk8s. docker-desktop clusters use the host's images as they are. Images the Docker Engine does not hold, as
+when they are built through BUILDKIT_HOST or found up to date in the registry only, are not loaded.
+
+Each image is labelled with a hash of its Dockerfile, the files of its context that are not ignored by .dockerignore,
+and its build args. Builds are skipped when an image with the same hash already exists locally or in the registry,
+unless --force or --noCache is given.
+
+With --sbom, an SPDX (--sbom=spdx, the default) or CycloneDX (--sbom=cyclonedx) bill of materials is written for each
+image into build-reports/<component>/, listing the deb, apk, Python and npm packages found in the image's layers.
+build-reports/sbom-summary.json summarizes the SBOMs of all images. SBOMs are read from the docker engine offline.
+
+With --report build.json, a JSON report of every image is written once the builds end: its component, reference, tag,
+digest, build duration, result (built, pushed, skipped, failed or cancelled) and environment. 'stack up --images
+build.json' deploys exactly the images of the report.
+
+Images are built with BuildKit through the Docker Engine API, or by the BuildKit daemon at BUILDKIT_HOST when it is
+set, which needs buildctl on the PATH.
+Build progress is printed per image, prefixed with the image name.
 
 For example:
 
 	stack build app -t v0.1.0-alpha		# builds the images for all the containers defined by the app component in the project's config' with the tag v0.1.0-alpha
 
 	stack build app app-image			# build the image 'app:latest' for the container 'app' defined by the component 'app'
+
+	stack build app --push				# build the app component's images and push them to the configured registry
+
+	stack build app --push --platform linux/amd64,linux/arm64	# build and push multi-platform images of the app component
+
+	stack build app --sbom=cyclonedx		# build the app component's images and write CycloneDX SBOMs of them
+
+	stack build app --push --report build.json	# build and push the app component's images, and report their digests
+
+	stack build app --load				# build the app component's images and load them into the local cluster
+
+	stack build app --build-arg VERSION=1.2 --target release	# set the ARG VERSION and build the 'release' stage of each Dockerfile
 `,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		return configPreRunnerE(cmd, args)
@@ -62,13 +105,26 @@ func buildForCurrentEnvironment(cd latest.ContainerDescription, currentEnvName s
 }
 
 func runBuildComponent(cmd *cobra.Command, args []string) (err error) {
+	format, err := sbomFormat(cmd)
+	if err != nil {
+		return err
+	}
+	builder, err := newBuilder()
+	if err != nil {
+		return err
+	}
+	exporter, err := sbomExporter(format, builder)
+	if err != nil {
+		return err
+	}
+	env, err := getBuildEnvironment()
+	if err != nil {
+		return err
+	}
+	var jobs []buildJob
 	for _, component := range config.Components {
 		if args[0] == component.Name {
 			for _, container := range component.Containers {
-				env, err := getBuildEnvironment()
-				if err != nil {
-					return err
-				}
 				environmentEnabled := buildForCurrentEnvironment(container, env.Name)
 				if !environmentEnabled {
 					continue
@@ -81,50 +137,284 @@ func runBuildComponent(cmd *cobra.Command, args []string) (err error) {
 
 				tag, _ := cmd.Flags().GetString("tag")
 				if tag == "" {
-					imageTag, _ := cmd.Flags().GetString("imageTag")
-					if imageTag == "" {
-						imageTag = "latest"
+					resolved, err := imageTag(cmd)
+					if err != nil {
+						return err
 					}
-					tag = fmt.Sprintf("%v:%v", container.Image, imageTag)
-				}
-				err = buildComponent(container.Context, container.Dockerfile, tag)
-				if err != nil {
-					return err
+					tag = imageReference(container.Image, resolved, env.Name)
 				}
+				jobs = append(jobs, buildJob{component: component.Name, container: container, tag: tag})
 			}
 		}
 	}
+
+	kubeContext, load := loadContext(cmd, env)
+	outcomes := runBuildJobs(context.Background(), jobs, 1, false, func(ctx context.Context, job buildJob) (builtImage, error) {
+		image, err := buildComponent(ctx, cmd, builder, job.container, job.tag, os.Stdout)
+		if err == nil && exporter != nil {
+			image.sbom, err = writeSBOM(ctx, exporter, format, job.component, job.container.Image, job.tag, image, os.Stdout)
+		}
+		if err == nil && load {
+			err = loadBuiltImage(ctx, builder, job.container.Image, job.tag, kubeContext, os.Stdout)
+		}
+		return image, err
+	})
+	if err := recordBuilds(cmd, outcomes, env.Name); err != nil {
+		return err
+	}
+	for _, outcome := range outcomes {
+		if outcome.err != nil {
+			return outcome.err
+		}
+	}
 	return nil
 }
 
-func buildComponent(context, dockerfile, tag string) (err error) {
+// recordBuilds marks the outcomes of pushed builds, and records the outcomes in the SBOM summary and build report
+// when they were requested
+func recordBuilds(cmd *cobra.Command, outcomes []buildOutcome, env string) error {
+	push, _ := cmd.Flags().GetBool("push")
+	var reports []sbomReport
+	for i, outcome := range outcomes {
+		outcomes[i].pushed = push && outcome.err == nil
+		if outcome.err == nil && outcome.result.sbom != nil {
+			reports = append(reports, *outcome.result.sbom)
+		}
+	}
+	if err := writeSBOMSummary(reports); err != nil {
+		return err
+	}
+	reportPath, _ := cmd.Flags().GetString("report")
+	return writeBuildReport(reportPath, outcomes, env)
+}
+
+// builtImage is an image built by buildComponent, or found to be up to date
+type builtImage struct {
+	build.Result
+	skipped bool
+	// sbom summarizes the SBOM written for the image, when requested
+	sbom *sbomReport
+}
+
+// buildComponent builds the image of a container with the given tag, printing its progress to out. The build is skipped
+// when an image built from the same content hash already exists, unless the force or noCache flag is set.
+func buildComponent(ctx context.Context, cmd *cobra.Command, builder build.Builder, container latest.ContainerDescription, tag string, out io.Writer) (builtImage, error) {
 	configDirectory, _ := filepath.Abs(viper.GetString("stack_directory"))
-	contextPath := filepath.Join(configDirectory, context)
-	dockerfilePath := filepath.Join(configDirectory, dockerfile)
+	opts, err := buildOptions(cmd, container, configDirectory, tag)
+	if err != nil {
+		return builtImage{}, err
+	}
+	hash, err := build.ContentHash(opts)
+	if err != nil {
+		return builtImage{}, fmt.Errorf("hashing the build of image `%v`: %w", container.Image, err)
+	}
+	opts.Labels = map[string]string{build.ContentHashLabel: hash}
 
-	dockerBuildCommand, err := GenerateCommand(dockerBuildTemplate, DockerBuildRequest{
-		Dockerfile: dockerfilePath,
-		Tag:        tag,
-		Context:    contextPath,
-		NoCache:    noCache,
-		GitHash:    gitHash,
-	})
+	// a build without cache is asked for to rebuild images whose content did not change, e.g. to update their packages
+	if force, _ := cmd.Flags().GetBool("force"); !force && !noCache {
+		info, found, err := upToDateImage(ctx, builder, tag, hash, opts.Push, out)
+		if err != nil {
+			return builtImage{}, err
+		}
+		if found {
+			_, _ = fmt.Fprintf(out, "[%v] Skipped %v: up to date with content hash %.12v\n", container.Image, tag, hash)
+			return builtImage{Result: build.Result{ImageID: info.ID, Digest: info.Digest, Platforms: info.Platforms}, skipped: true}, nil
+		}
+	}
+
+	result, err := build.ForOptions(builder, opts).Build(ctx, opts, printBuildEvent(container.Image, out))
 	if err != nil {
-		return err
+		return builtImage{Result: result}, fmt.Errorf("building image `%v`: %w", container.Image, err)
+	}
+	if !opts.Push {
+		_, _ = fmt.Fprintf(out, "[%v] Built %v (%v)\n", container.Image, tag, imageDigest(result))
+		return builtImage{Result: result}, nil
+	}
+	_, _ = fmt.Fprintf(out, "[%v] Pushed %v@%v\n", container.Image, tag, result.Digest)
+	if len(opts.Platforms) > 1 && len(result.Platforms) == 0 {
+		// builders report the digest of the manifest list only, the registry knows those of each platform
+		if info, found, err := registryImages.Inspect(ctx, tag); err == nil && found {
+			result.Platforms = info.Platforms
+		}
+	}
+	for _, platform := range sortedPlatforms(result.Platforms) {
+		_, _ = fmt.Fprintf(out, "[%v]   %v: %v\n", container.Image, platform, result.Platforms[platform])
 	}
+	return builtImage{Result: result}, nil
+}
 
-	dockerBuildCommand.Stdout = os.Stdout
-	dockerBuildCommand.Stderr = os.Stderr
-	if err := dockerBuildCommand.Run(); err != nil {
-		return err
+// sortedPlatforms returns the platforms of a platform digest map in order
+func sortedPlatforms(platforms map[string]string) []string {
+	names := make([]string, 0, len(platforms))
+	for platform := range platforms {
+		names = append(names, platform)
 	}
-	return nil
+	sort.Strings(names)
+	return names
+}
+
+// registryImages looks up images in their registries, and is replaced in tests
+var registryImages build.Inspector = build.NewRegistryClient()
+
+// upToDateImage looks for an image tagged with the reference that was built from the given content hash, first among
+// the builder's local images and then in the image's registry. Only the registry is considered when the image is
+// to be pushed, as a local image would still need pushing.
+func upToDateImage(ctx context.Context, builder build.Builder, reference, hash string, push bool, out io.Writer) (build.ImageInfo, bool, error) {
+	if inspector, ok := builder.(build.Inspector); ok && !push {
+		info, found, err := inspector.Inspect(ctx, reference)
+		if err != nil {
+			return info, false, err
+		}
+		if found && info.Labels[build.ContentHashLabel] == hash {
+			return info, true, nil
+		}
+	}
+	if !build.NamesRegistry(reference) {
+		return build.ImageInfo{}, false, nil
+	}
+	info, found, err := registryImages.Inspect(ctx, reference)
+	if err != nil {
+		// the build itself does not need the registry, so being unable to reach it only means building again
+		_, _ = fmt.Fprintf(out, "[%v] Unable to check the registry for an up to date image: %v\n", reference, err)
+		return info, false, nil
+	}
+	return info, found && info.Labels[build.ContentHashLabel] == hash, nil
+}
+
+// buildOptions describes the build of a container's image from the build flags
+func buildOptions(cmd *cobra.Command, container latest.ContainerDescription, configDirectory, tag string) (build.Options, error) {
+	environ := os.Environ()
+	buildArgs := map[string]string{}
+	for _, key := range sortedMapKeys(container.BuildArgs) {
+		value, err := executeEnvTemplate(fmt.Sprintf("build arg `%v` of image `%v`", key, container.Image), container.BuildArgs[key], environ)
+		if err != nil {
+			return build.Options{}, err
+		}
+		buildArgs[key] = value
+	}
+	if gitHash {
+		commit := gitCommit()
+		if commit == "" {
+			return build.Options{}, fmt.Errorf("unable to determine the git commit of `%v`", configDirectory)
+		}
+		buildArgs["GIT_COMMIT"] = commit
+	}
+	flagArgs, _ := cmd.Flags().GetStringArray("build-arg")
+	for _, arg := range flagArgs {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) == 1 {
+			// like docker, a bare name takes its value from the environment
+			value, ok := os.LookupEnv(parts[0])
+			if !ok {
+				continue
+			}
+			parts = append(parts, value)
+		}
+		buildArgs[parts[0]] = parts[1]
+	}
+
+	var secrets []build.Secret
+	for _, secret := range container.Secrets {
+		switch {
+		case secret.ID == "" || (secret.Src == "") == (secret.Env == ""):
+			return build.Options{}, fmt.Errorf("secrets of image `%v` must have an id, and one of src or env", container.Image)
+		case secret.Env != "":
+			if _, ok := os.LookupEnv(secret.Env); !ok {
+				return build.Options{}, fmt.Errorf("secret `%v` of image `%v` requires the environment variable `%v`, which is not set", secret.ID, container.Image, secret.Env)
+			}
+			secrets = append(secrets, build.Secret{ID: secret.ID, Env: secret.Env})
+		default:
+			src, err := executeEnvTemplate(fmt.Sprintf("src of secret `%v` of image `%v`", secret.ID, container.Image), secret.Src, environ)
+			if err != nil {
+				return build.Options{}, err
+			}
+			if !filepath.IsAbs(src) {
+				src = filepath.Join(configDirectory, src)
+			}
+			secrets = append(secrets, build.Secret{ID: secret.ID, Src: src})
+		}
+	}
+	var cacheFrom []string
+	for _, ref := range container.CacheFrom {
+		ref, err := executeEnvTemplate(fmt.Sprintf("cacheFrom `%v` of image `%v`", ref, container.Image), ref, environ)
+		if err != nil {
+			return build.Options{}, err
+		}
+		cacheFrom = append(cacheFrom, ref)
+	}
+
+	target, _ := cmd.Flags().GetString("target")
+	if target == "" {
+		target = container.Target
+	}
+	push, _ := cmd.Flags().GetBool("push")
+	platforms, _ := cmd.Flags().GetStringSlice("platform")
+	if len(platforms) == 0 {
+		platforms = container.Platforms
+	}
+
+	return build.Options{
+		ContextDir: filepath.Join(configDirectory, container.Context),
+		Dockerfile: filepath.Join(configDirectory, container.Dockerfile),
+		Tags:       []string{tag},
+		BuildArgs:  buildArgs,
+		Target:     target,
+		NoCache:    noCache,
+		Push:       push,
+		Platforms:  platforms,
+		Secrets:    secrets,
+		CacheFrom:  cacheFrom,
+	}, nil
+}
+
+// sortedMapKeys returns the keys of a string map in order, so that map driven errors and output are deterministic
+func sortedMapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printBuildEvent returns a progress function printing the steps and output of an image build, prefixed by the image
+// name. Status events, such as layer download progress, are too chatty to print.
+func printBuildEvent(image string, out io.Writer) func(build.Event) {
+	return func(event build.Event) {
+		switch event.Type {
+		case build.EventStep:
+			if event.Cached {
+				_, _ = fmt.Fprintf(out, "[%v] %v (cached)\n", image, event.Message)
+				return
+			}
+			_, _ = fmt.Fprintf(out, "[%v] %v\n", image, event.Message)
+		case build.EventLog:
+			_, _ = fmt.Fprintf(out, "[%v] %v\n", image, event.Message)
+		}
+	}
+}
+
+// imageDigest returns the manifest digest of a built image when the builder reported one, or else its ID
+func imageDigest(result build.Result) string {
+	if result.Digest != "" {
+		return result.Digest
+	}
+	return result.ImageID
 }
 
 func init() {
 	rootCmd.AddCommand(buildCmd)
 	buildCmd.PersistentFlags().StringP("tag", "t", "", "Name and optionally a tag in the 'name:tag' format (same as docker flag). Defaults to image:latest based on stack config.")
-	buildCmd.PersistentFlags().StringP("imageTag", "i", "", "Set the tag only of the 'name:tag' format and use the stack configured image name as the name.")
-	buildCmd.PersistentFlags().BoolVar(&noCache, "noCache", false, "Build images without cache")
+	buildCmd.PersistentFlags().StringP("imageTag", "i", "", "Set the tag only of the 'name:tag' format and use the stack configured image name as the name. Defaults to the tag resolved by the stack's tagPolicy.")
+	buildCmd.PersistentFlags().BoolVar(&noCache, "noCache", false, "Build images without cache, even when an image with the same content hash already exists")
 	buildCmd.PersistentFlags().BoolVar(&gitHash, "gitHash", false, "Build image with build arg GIT_COMMIT set to git hash")
+	buildCmd.PersistentFlags().StringArray("build-arg", []string{}, "Set a build-time variable in the 'KEY=VALUE' format, or 'KEY' to take the value from the environment, overriding the container's buildArgs")
+	buildCmd.PersistentFlags().String("target", "", "Build the given stage of multi-stage Dockerfiles, rather than the container's target")
+	buildCmd.PersistentFlags().Bool("force", false, "Build images even when an image with the same content hash already exists")
+	buildCmd.PersistentFlags().StringSlice("platform", []string{}, "Build for the given platforms, e.g. linux/amd64,linux/arm64, rather than those configured for each container")
+	buildCmd.PersistentFlags().String("sbom", "", "Write an SBOM of each image into build-reports/, in the spdx or cyclonedx format")
+	buildCmd.PersistentFlags().Lookup("sbom").NoOptDefVal = sbom.FormatSPDX
+	buildCmd.PersistentFlags().String("report", "", "Write a JSON report of the built images to the given file, for 'stack up --images'")
+	buildCmd.PersistentFlags().Bool("load", false, "Load the built images into the cluster of the current kube context: kind, minikube or microk8s")
+	buildCmd.PersistentFlags().Bool("push", false, "Push the built images to their registry, printing the pushed digests")
 }
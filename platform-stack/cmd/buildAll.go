@@ -1,55 +1,254 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
 	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"sync"
+	"time"
 )
 
 // buildAllCmd represents the buildAll command
 var buildAllCmd = &cobra.Command{
 	Use:   "all",
 	Short: "Builds all containers for all components of the stack.",
-	Long:  `Builds all containers for all components of the stack.`,
-	RunE:  buildAllComponents,
+	Long: `Builds all containers for all components of the stack.
+
+Containers are independent of each other, and up to --parallel of them are built at once. The output of each build
+is prefixed with its image name, and a summary of every build is printed at the end, listing the digest of each
+platform of multi-platform images.
+The first failed build cancels those still running unless --keep-going is given.
+
+For example:
+
+	stack build all --parallel 4				# build four images at a time
+
+	stack build all --parallel 4 --keep-going	# build every image that can be built, even when some fail
+`,
+	RunE: buildAllComponents,
+}
+
+// buildJob is the build of a single container's image
+type buildJob struct {
+	component string
+	container latest.ContainerDescription
+	tag       string
+}
+
+// buildOutcome describes how a build job ended
+type buildOutcome struct {
+	job       buildJob
+	duration  time.Duration
+	result    builtImage
+	pushed    bool
+	err       error
+	cancelled bool
+}
+
+func (o buildOutcome) status() string {
+	switch {
+	case o.cancelled:
+		return "cancelled"
+	case o.err != nil:
+		return fmt.Sprintf("failed: %v", o.err)
+	case o.result.skipped:
+		return "skipped: up to date"
+	case o.pushed:
+		return fmt.Sprintf("pushed %v", o.result.Digest)
+	}
+	return "built"
 }
 
 func buildAllComponents(cmd *cobra.Command, args []string) (err error) {
 	if len(config.Components) == 0 {
 		return fmt.Errorf("no components found - double check you are in a configured stack directory")
 	}
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	if parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1, got %v", parallel)
+	}
+	keepGoing, _ := cmd.Flags().GetBool("keep-going")
+
+	jobs, err := buildAllJobs(cmd)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	format, err := sbomFormat(cmd)
+	if err != nil {
+		return err
+	}
+	builder, err := newBuilder()
+	if err != nil {
+		return err
+	}
+	exporter, err := sbomExporter(format, builder)
+	if err != nil {
+		return err
+	}
+	env, err := getEnvironment()
+	if err != nil {
+		return err
+	}
+	kubeContext, load := loadContext(cmd, env)
+
 	// todo: confirmWithUser that they are going to build multiple components, multiple containers with the same tag
-	for i, component := range config.Components {
+	out := &lockedWriter{out: os.Stdout}
+	outcomes := runBuildJobs(context.Background(), jobs, parallel, keepGoing, func(ctx context.Context, job buildJob) (builtImage, error) {
+		_, _ = fmt.Fprintf(out, "[%v] Building %v for component `%v`\n", job.container.Image, job.tag, job.component)
+		result, err := buildComponent(ctx, cmd, builder, job.container, job.tag, out)
+		if err == nil && exporter != nil {
+			result.sbom, err = writeSBOM(ctx, exporter, format, job.component, job.container.Image, job.tag, result, out)
+		}
+		if err == nil && load {
+			err = loadBuiltImage(ctx, builder, job.container.Image, job.tag, kubeContext, out)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "[%v] %v\n", job.container.Image, err)
+		}
+		return result, err
+	})
+
+	if err := recordBuilds(cmd, outcomes, env.Name); err != nil {
+		return err
+	}
+	fmt.Println("")
+	printBuildSummary(outcomes, os.Stdout)
+
+	failed := 0
+	for _, outcome := range outcomes {
+		if outcome.err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v images were not built", failed, len(outcomes))
+	}
+	return nil
+}
+
+// buildAllJobs lists the containers of every component that are built in the current environment
+func buildAllJobs(cmd *cobra.Command) ([]buildJob, error) {
+	var jobs []buildJob
+	for _, component := range config.Components {
 		if len(component.Containers) == 0 {
-			fmt.Printf("No images to build for component `%v` - skipping\n\n", component.Name)
+			fmt.Printf("No images to build for component `%v` - skipping\n", component.Name)
 			continue
 		}
-		fmt.Printf("Building all containers for component `%v`:\n", component.Name)
 		for _, container := range component.Containers {
 			env, err := getEnvironment()
 			if err != nil {
-				return err
+				return nil, err
 			}
 			environmentEnabled := buildForCurrentEnvironment(container, env.Name)
 			if !environmentEnabled {
 				continue
 			}
-			fmt.Printf("Building image `%v`:\n", container.Image)
 			tag, _ := cmd.Flags().GetString("tag")
 			if tag == "" {
-				tag = fmt.Sprintf("%v:%v", container.Image, "latest")
+				resolved, err := imageTag(cmd)
+				if err != nil {
+					return nil, err
+				}
+				tag = imageReference(container.Image, resolved, env.Name)
 			}
-			err = buildComponent(container.Context, container.Dockerfile, tag)
-			if err != nil {
-				return err
+			jobs = append(jobs, buildJob{component: component.Name, container: container, tag: tag})
+		}
+	}
+	return jobs, nil
+}
+
+// runBuildJobs runs up to parallel of the jobs at once, returning their outcomes in the order of the jobs. Unless
+// keepGoing is set, the first failure cancels the running jobs and no further jobs are started.
+func runBuildJobs(ctx context.Context, jobs []buildJob, parallel int, keepGoing bool, fn func(ctx context.Context, job buildJob) (builtImage, error)) []buildOutcome {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, parallel)
+	)
+	outcomes := make([]buildOutcome, len(jobs))
+	for i, job := range jobs {
+		outcomes[i].job = job
+		wg.Add(1)
+		go func(outcome *buildOutcome) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				outcome.err, outcome.cancelled = ctx.Err(), true
+				return
+			}
+
+			start := time.Now()
+			result, err := fn(ctx, outcome.job)
+			outcome.duration = time.Since(start)
+			if err == nil {
+				outcome.result = result
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			outcome.err = err
+			// a build interrupted by an earlier failure did not fail in its own right
+			outcome.cancelled = ctx.Err() != nil
+			if !keepGoing {
+				cancel()
 			}
+		}(&outcomes[i])
+	}
+	wg.Wait()
+	return outcomes
+}
+
+func printBuildSummary(outcomes []buildOutcome, out io.Writer) {
+	columnsTemplate := "%-30v%-20v%-12v%v\n"
+	_, _ = fmt.Fprintf(out, columnsTemplate, "IMAGE", "TAG", "DURATION", "RESULT")
+	for _, outcome := range outcomes {
+		duration := "-"
+		if outcome.duration > 0 {
+			duration = outcome.duration.Round(100 * time.Millisecond).String()
 		}
-		if i < len(config.Components)-1 {
-			fmt.Println("")
+		_, _ = fmt.Fprintf(out, columnsTemplate, outcome.job.container.Image, imageTagOf(outcome.job.tag), duration, outcome.status())
+		if outcome.err == nil {
+			for _, platform := range sortedPlatforms(outcome.result.Platforms) {
+				_, _ = fmt.Fprintf(out, columnsTemplate, "  "+platform, "", "", outcome.result.Platforms[platform])
+			}
 		}
 	}
-	return nil
+}
+
+// imageTagOf returns the tag of an image reference in the 'name:tag' format, or 'latest' when it has none
+func imageTagOf(reference string) string {
+	_, tag := build.SplitReference(reference)
+	return tag
+}
+
+// lockedWriter serializes the writes of concurrent builds, so that their lines are not interleaved mid-line
+type lockedWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
 }
 
 func init() {
 	buildCmd.AddCommand(buildAllCmd)
+	buildAllCmd.Flags().Int("parallel", 1, "Build up to the given number of images at once")
+	buildAllCmd.Flags().Bool("keep-going", false, "Keep building the remaining images after a build fails")
 }
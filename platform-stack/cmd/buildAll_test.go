@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/stretchr/testify/assert"
 	"gotest.tools/v3/golden"
 	"gotest.tools/v3/icmd"
 	"os/exec"
 	"path"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestBuildAllIntegration(t *testing.T) {
@@ -38,3 +46,85 @@ func TestBuildAllIntegration(t *testing.T) {
 		})
 	}
 }
+
+func buildJobsFor(images ...string) (jobs []buildJob) {
+	for _, image := range images {
+		jobs = append(jobs, buildJob{component: "app", container: latest.ContainerDescription{Image: image}, tag: image + ":latest"})
+	}
+	return jobs
+}
+
+func TestRunBuildJobsParallel(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	outcomes := runBuildJobs(context.Background(), buildJobsFor("a", "b", "c", "d", "e"), 2, false, func(ctx context.Context, job buildJob) (builtImage, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return builtImage{Result: build.Result{ImageID: "sha256:" + job.container.Image}}, nil
+	})
+
+	assert.Equal(t, 2, maxRunning)
+	for i, image := range []string{"a", "b", "c", "d", "e"} {
+		assert.Equal(t, image, outcomes[i].job.container.Image)
+		assert.Equal(t, "built", outcomes[i].status())
+		assert.Equal(t, "sha256:"+image, outcomes[i].result.ImageID)
+	}
+}
+
+func TestRunBuildJobsFailure(t *testing.T) {
+	outcomes := runBuildJobs(context.Background(), buildJobsFor("a", "b", "c"), 2, false, func(ctx context.Context, job buildJob) (builtImage, error) {
+		if job.container.Image == "a" {
+			return builtImage{}, fmt.Errorf("exit code: 1")
+		}
+		// b waits for a to fail, so it is running when the failure cancels it
+		<-ctx.Done()
+		return builtImage{}, ctx.Err()
+	})
+	assert.Equal(t, "failed: exit code: 1", outcomes[0].status())
+	assert.Equal(t, "cancelled", outcomes[1].status())
+	assert.Equal(t, "cancelled", outcomes[2].status())
+
+	var started []string
+	var mu sync.Mutex
+	outcomes = runBuildJobs(context.Background(), buildJobsFor("a", "b", "c"), 1, true, func(ctx context.Context, job buildJob) (builtImage, error) {
+		mu.Lock()
+		started = append(started, job.container.Image)
+		mu.Unlock()
+		if job.container.Image == "b" {
+			return builtImage{}, fmt.Errorf("exit code: 2")
+		}
+		return builtImage{}, nil
+	})
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, started)
+	assert.Equal(t, "built", outcomes[0].status())
+	assert.Equal(t, "failed: exit code: 2", outcomes[1].status())
+	assert.Equal(t, "built", outcomes[2].status())
+}
+
+func TestPrintBuildSummary(t *testing.T) {
+	var out bytes.Buffer
+	printBuildSummary([]buildOutcome{
+		{job: buildJob{container: latest.ContainerDescription{Image: "app"}, tag: "app:v1"}, duration: 83*time.Second + 420*time.Millisecond},
+		{job: buildJob{container: latest.ContainerDescription{Image: "api"}, tag: "localhost:5000/api:v1"}, duration: 2 * time.Second, result: builtImage{Result: build.Result{Digest: "sha256:9a83", Platforms: map[string]string{"linux/arm64": "sha256:41c7", "linux/amd64": "sha256:e3b0"}}}, pushed: true},
+		{job: buildJob{container: latest.ContainerDescription{Image: "docs"}, tag: "docs:latest"}, duration: 100 * time.Millisecond, result: builtImage{skipped: true}},
+		{job: buildJob{container: latest.ContainerDescription{Image: "worker"}, tag: "localhost:5000/worker"}, duration: time.Second, err: fmt.Errorf("exit code: 1")},
+		{job: buildJob{container: latest.ContainerDescription{Image: "web"}, tag: "web:latest"}, err: context.Canceled, cancelled: true},
+	}, &out)
+	assert.Equal(t, `IMAGE                         TAG                 DURATION    RESULT
+app                           v1                  1m23.4s     built
+api                           v1                  2s          pushed sha256:9a83
+  linux/amd64                                                 sha256:e3b0
+  linux/arm64                                                 sha256:41c7
+docs                          latest              100ms       skipped: up to date
+worker                        latest              1s          failed: exit code: 1
+web                           latest              -           cancelled
+`, out.String())
+}
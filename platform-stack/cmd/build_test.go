@@ -1,12 +1,21 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/build"
 	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"gotest.tools/v3/golden"
 	"gotest.tools/v3/icmd"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"testing"
 )
 
@@ -71,3 +80,242 @@ func TestBuildForCurrentEnvironment(t *testing.T) {
 		})
 	}
 }
+
+// fakeImages is an image store for tests, keyed by image reference
+type fakeImages map[string]build.ImageInfo
+
+func (f fakeImages) Inspect(ctx context.Context, reference string) (build.ImageInfo, bool, error) {
+	info, found := f[reference]
+	return info, found, nil
+}
+
+// fakeBuilder records the builds it is asked for and replays the given events
+type fakeBuilder struct {
+	fakeImages
+	events []build.Event
+	result build.Result
+	err    error
+	builds []build.Options
+}
+
+func (f *fakeBuilder) Build(ctx context.Context, opts build.Options, progress func(build.Event)) (build.Result, error) {
+	f.builds = append(f.builds, opts)
+	for _, event := range f.events {
+		progress(event)
+	}
+	return f.result, f.err
+}
+
+// buildTestStack creates a stack directory containing the app container, and makes it the stack directory
+func buildTestStack(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "stack-build")
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "app"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app", "Dockerfile"), []byte("FROM alpine\n"), 0644))
+	viper.Set("stack_directory", dir)
+	t.Cleanup(func() {
+		viper.Set("stack_directory", nil)
+		_ = os.RemoveAll(dir)
+	})
+	return dir
+}
+
+// buildTestCommand returns a command with the build flags set by args
+func buildTestCommand(t *testing.T, args ...string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringArray("build-arg", []string{}, "")
+	cmd.Flags().String("target", "", "")
+	cmd.Flags().Bool("force", false, "")
+	cmd.Flags().BoolVar(&noCache, "noCache", false, "")
+	cmd.Flags().Bool("push", false, "")
+	cmd.Flags().StringSlice("platform", []string{}, "")
+	cmd.Flags().String("sbom", "", "")
+	cmd.Flags().String("report", "", "")
+	cmd.Flags().Lookup("sbom").NoOptDefVal = "spdx"
+	assert.NoError(t, cmd.Flags().Parse(args))
+	return cmd
+}
+
+func TestBuildComponent(t *testing.T) {
+	dir := buildTestStack(t)
+	for key, value := range map[string]string{"GIT_TOKEN": "token", "FROM_ENV": "env-value"} {
+		_ = os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+	cmd := buildTestCommand(t, "--build-arg", "VERSION=1.2", "--build-arg", "FROM_ENV", "--build-arg", "UNSET", "--target", "release")
+
+	builder := &fakeBuilder{
+		events: []build.Event{
+			{Type: build.EventStep, Step: "[1/2] FROM alpine", Message: "[1/2] FROM alpine", Cached: true},
+			{Type: build.EventStatus, Step: "[1/2] FROM alpine", Message: "extracting 1/2"},
+			{Type: build.EventStep, Step: "[2/2] RUN make", Message: "[2/2] RUN make"},
+			{Type: build.EventLog, Step: "[2/2] RUN make", Message: "cc -o app"},
+		},
+		result: build.Result{ImageID: "sha256:config", Digest: "sha256:manifest"},
+	}
+	container := latest.ContainerDescription{
+		Image:      "app",
+		Context:    "app",
+		Dockerfile: "app/Dockerfile",
+		BuildArgs:  map[string]string{"GIT_TOKEN": "{{ .GIT_TOKEN }}", "VERSION": "1.0"},
+	}
+
+	var out bytes.Buffer
+	image, err := buildComponent(context.Background(), cmd, builder, container, "app:latest", &out)
+	assert.NoError(t, err)
+	assert.Equal(t, builtImage{Result: builder.result}, image)
+	assert.Len(t, builder.builds, 1)
+	opts := builder.builds[0]
+	assert.Len(t, opts.Labels[build.ContentHashLabel], 64)
+	opts.Labels = nil
+	assert.Equal(t, build.Options{
+		ContextDir: filepath.Join(dir, "app"),
+		Dockerfile: filepath.Join(dir, "app", "Dockerfile"),
+		Tags:       []string{"app:latest"},
+		BuildArgs:  map[string]string{"GIT_TOKEN": "token", "VERSION": "1.2", "FROM_ENV": "env-value"},
+		Target:     "release",
+	}, opts)
+	assert.Equal(t, `[app] [1/2] FROM alpine (cached)
+[app] [2/2] RUN make
+[app] cc -o app
+[app] Built app:latest (sha256:manifest)
+`, out.String())
+
+	builder.err = fmt.Errorf("exit code: 2")
+	_, err = buildComponent(context.Background(), cmd, builder, container, "app:latest", &out)
+	assert.EqualError(t, err, "building image `app`: exit code: 2")
+}
+
+func TestBuildOptions(t *testing.T) {
+	_ = os.Setenv("CACHE_REGISTRY", "localhost:5000")
+	defer os.Unsetenv("CACHE_REGISTRY")
+	_ = os.Setenv("NPM_TOKEN", "token")
+	defer os.Unsetenv("NPM_TOKEN")
+	container := latest.ContainerDescription{
+		Image:      "app",
+		Context:    "app",
+		Dockerfile: "app/Dockerfile",
+		Target:     "release",
+		Secrets: []latest.BuildSecretDescription{
+			{ID: "npmrc", Src: "secrets/.npmrc"},
+			{ID: "token", Env: "NPM_TOKEN"},
+		},
+		CacheFrom: []string{"{{ .CACHE_REGISTRY }}/app:cache"},
+	}
+
+	opts, err := buildOptions(buildTestCommand(t), container, "/src", "app:latest")
+	assert.NoError(t, err)
+	assert.Equal(t, "release", opts.Target)
+	assert.Equal(t, []build.Secret{{ID: "npmrc", Src: "/src/secrets/.npmrc"}, {ID: "token", Env: "NPM_TOKEN"}}, opts.Secrets)
+	assert.Equal(t, []string{"localhost:5000/app:cache"}, opts.CacheFrom)
+
+	opts, err = buildOptions(buildTestCommand(t, "--target", "debug"), container, "/src", "app:latest")
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", opts.Target)
+
+	tests := []struct {
+		name      string
+		container latest.ContainerDescription
+		err       string
+	}{
+		{
+			"unset build arg variable",
+			latest.ContainerDescription{Image: "app", BuildArgs: map[string]string{"TOKEN": "{{ .UNSET_TOKEN }}"}},
+			"build arg `TOKEN` of image `app` requires the environment variable `UNSET_TOKEN`, which is not set",
+		},
+		{
+			"unset secret variable",
+			latest.ContainerDescription{Image: "app", Secrets: []latest.BuildSecretDescription{{ID: "token", Env: "UNSET_TOKEN"}}},
+			"secret `token` of image `app` requires the environment variable `UNSET_TOKEN`, which is not set",
+		},
+		{
+			"secret without source",
+			latest.ContainerDescription{Image: "app", Secrets: []latest.BuildSecretDescription{{ID: "token"}}},
+			"secrets of image `app` must have an id, and one of src or env",
+		},
+		{
+			"unset cacheFrom variable",
+			latest.ContainerDescription{Image: "app", CacheFrom: []string{"{{ .UNSET_REGISTRY }}/app"}},
+			"cacheFrom `{{ .UNSET_REGISTRY }}/app` of image `app` requires the environment variable `UNSET_REGISTRY`, which is not set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildOptions(buildTestCommand(t), tt.container, "/src", "app:latest")
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestBuildComponentUpToDate(t *testing.T) {
+	dir := buildTestStack(t)
+	container := latest.ContainerDescription{Image: "app", Context: "app", Dockerfile: "app/Dockerfile"}
+	hash, err := build.ContentHash(build.Options{ContextDir: filepath.Join(dir, "app"), Dockerfile: filepath.Join(dir, "app", "Dockerfile")})
+	assert.NoError(t, err)
+	upToDate := build.ImageInfo{ID: "sha256:config", Digest: "sha256:manifest", Labels: map[string]string{build.ContentHashLabel: hash}}
+	stale := build.ImageInfo{ID: "sha256:old", Labels: map[string]string{build.ContentHashLabel: "old"}}
+
+	defer func(i build.Inspector) { registryImages = i }(registryImages)
+	tests := []struct {
+		name     string
+		args     []string
+		local    fakeImages
+		registry fakeImages
+		tag      string
+		skipped  bool
+	}{
+		{"local image up to date", nil, fakeImages{"app:latest": upToDate}, nil, "app:latest", true},
+		{"local image stale", nil, fakeImages{"app:latest": stale}, nil, "app:latest", false},
+		{"forced", []string{"--force"}, fakeImages{"app:latest": upToDate}, nil, "app:latest", false},
+		{"without cache", []string{"--noCache"}, fakeImages{"app:latest": upToDate}, nil, "app:latest", false},
+		{"without cache with registry image up to date", []string{"--noCache"}, nil, fakeImages{"localhost:5000/app:v1": upToDate}, "localhost:5000/app:v1", false},
+		{"registry image up to date", nil, nil, fakeImages{"localhost:5000/app:v1": upToDate}, "localhost:5000/app:v1", true},
+		{"registry image stale", nil, nil, fakeImages{"localhost:5000/app:v1": stale}, "localhost:5000/app:v1", false},
+		{"pushing with local image up to date", []string{"--push"}, fakeImages{"localhost:5000/app:v1": upToDate}, nil, "localhost:5000/app:v1", false},
+		{"pushing with registry image up to date", []string{"--push"}, nil, fakeImages{"localhost:5000/app:v1": upToDate}, "localhost:5000/app:v1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registryImages = tt.registry
+			builder := &fakeBuilder{fakeImages: tt.local, result: build.Result{ImageID: "sha256:new"}}
+			var out bytes.Buffer
+			image, err := buildComponent(context.Background(), buildTestCommand(t, tt.args...), builder, container, tt.tag, &out)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.skipped, image.skipped)
+			if tt.skipped {
+				assert.Empty(t, builder.builds)
+				assert.Equal(t, upToDate.Digest, image.Digest)
+				assert.Equal(t, fmt.Sprintf("[app] Skipped %v: up to date with content hash %v\n", tt.tag, hash[:12]), out.String())
+			} else {
+				assert.Len(t, builder.builds, 1)
+			}
+		})
+	}
+}
+
+func TestBuildComponentPlatforms(t *testing.T) {
+	buildTestStack(t)
+	container := latest.ContainerDescription{Image: "app", Context: "app", Dockerfile: "app/Dockerfile", Platforms: []string{"linux/amd64", "linux/arm64"}}
+
+	defer func(i build.Inspector) { registryImages = i }(registryImages)
+	registryImages = fakeImages{"localhost:5000/app:v1": {
+		Digest:    "sha256:index",
+		Platforms: map[string]string{"linux/arm64": "sha256:arm64", "linux/amd64": "sha256:amd64"},
+	}}
+
+	builder := &fakeBuilder{result: build.Result{Digest: "sha256:index"}}
+	var out bytes.Buffer
+	image, err := buildComponent(context.Background(), buildTestCommand(t, "--push"), builder, container, "localhost:5000/app:v1", &out)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"linux/amd64", "linux/arm64"}, builder.builds[0].Platforms)
+	assert.Equal(t, map[string]string{"linux/amd64": "sha256:amd64", "linux/arm64": "sha256:arm64"}, image.Platforms)
+	assert.Equal(t, `[app] Pushed localhost:5000/app:v1@sha256:index
+[app]   linux/amd64: sha256:amd64
+[app]   linux/arm64: sha256:arm64
+`, out.String())
+
+	builder = &fakeBuilder{result: build.Result{ImageID: "sha256:config"}}
+	_, err = buildComponent(context.Background(), buildTestCommand(t, "--platform", "linux/arm64"), builder, container, "app:v1", &out)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"linux/arm64"}, builder.builds[0].Platforms)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/altiscope/platform-stack/pkg/apply"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [<component>...]",
+	Short: "Shows the changes `up` would make to the cluster.",
+	Long: `Shows the changes ` + "`up`" + ` would make to the cluster.
+
+Manifests for the given components are rendered and compared with the live objects in the cluster using a server-side dry run.
+If no components are provided as arguments, all configured components will be compared.
+Exits with a non-zero status when there are differences, so it can be used as a drift check.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return configPreRunnerE(cmd, args)
+	},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return initK8s("")
+	},
+	RunE: diffComponents,
+}
+
+func diffComponents(cmd *cobra.Command, args []string) (err error) {
+
+	currentEnv, err := getEnvironment()
+	if err != nil {
+		return err
+	}
+	if currentEnv == (latest.EnvironmentDescription{}) {
+		return fmt.Errorf("no active environment detected")
+	}
+
+	diffComponents, err := parseComponentArgs(args, config.Components)
+	if err != nil {
+		return err
+	}
+
+	changed, failed, err := diffComponentList(cmd, diffComponents, currentEnv, stackApplier(), os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	// differences are reported above, so usage would only obscure them
+	cmd.SilenceUsage = true
+	if failed > 0 {
+		return fmt.Errorf("%v objects could not be compared", failed)
+	}
+	if changed > 0 {
+		return fmt.Errorf("%v objects differ from the cluster", changed)
+	}
+	fmt.Println("No differences found")
+	return nil
+}
+
+// diffComponentList renders and compares the manifests of each component active in the given environment
+func diffComponentList(cmd *cobra.Command, components []latest.ComponentDescription, currentEnv latest.EnvironmentDescription, applier *apply.Applier, out io.Writer) (changed, failed int, err error) {
+	images, err := stackImageValues(cmd, currentEnv.Name)
+	if err != nil {
+		return changed, failed, err
+	}
+	for _, component := range components {
+		if !envsApply(component.Environments, currentEnv.Name) {
+			_, _ = fmt.Fprintf(out, "skipping `diff` for component `%v`: not in active environment\n", component.Name)
+			continue
+		}
+		for _, manifest := range component.Manifests {
+			rendered, err := renderManifest(cmd, component, manifest, currentEnv, images)
+			if err != nil {
+				return changed, failed, err
+			}
+			objects, err := apply.Decode(rendered)
+			if err != nil {
+				return changed, failed, err
+			}
+			c, f := apply.PrintDifferences(applier.Diff(context.Background(), objects), out)
+			changed += c
+			failed += f
+		}
+	}
+	return changed, failed, nil
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringSliceP("env", "e", []string{}, "Env variables")
+	diffCmd.Flags().String("images", "", "Compare with the images of a build report written by 'stack build --report'")
+	diffCmd.Flags().String("imageTag", "", "Compare with images of the given tag rather than the one resolved by the stack's tagPolicy")
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/altiscope/platform-stack/pkg/apply"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/golden"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestDiffIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		fixture string
+	}{
+		{"diff help", []string{"help", "diff"}, "stack-diff-help.golden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(path.Join(".", "stack"), tt.args...)
+			result, _ := cmd.CombinedOutput()
+			golden.AssertBytes(t, result, tt.fixture)
+		})
+	}
+}
+
+// fakeApplier returns an Applier backed by a fake dynamic client that answers server-side apply requests
+// with the applied object
+func fakeApplier(objects ...runtime.Object) (*apply.Applier, *fake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		object := &unstructured.Unstructured{}
+		err := object.UnmarshalJSON(patch.GetPatch())
+		return true, object, err
+	})
+	return &apply.Applier{Client: client, Mapper: mapper, FieldManager: "app", Namespace: "testns"}, client
+}
+
+func TestDiffComponentList(t *testing.T) {
+	viper.Set("stack_directory", "../../examples/basic")
+	defer viper.Set("stack_directory", ".")
+	_ = os.Setenv("ENV", "local")
+	defer os.Unsetenv("ENV")
+
+	components := []latest.ComponentDescription{
+		{Name: "config", RequiredVariables: []string{"ENV"}, Manifests: []string{"./deployments/config.yaml"}},
+		{Name: "app", Manifests: []string{"./deployments/app.yaml"}, Environments: []string{"staging"}},
+	}
+	applier, _ := fakeApplier()
+
+	var out bytes.Buffer
+	changed, failed, err := diffComponentList(diffCmd, components, latest.EnvironmentDescription{Name: "local"}, applier, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	assert.Equal(t, 0, failed)
+	assert.Contains(t, out.String(), "+++ merged/configmap/stack-env\n")
+	assert.Contains(t, out.String(), "+  ENV: local\n")
+	assert.Contains(t, out.String(), "skipping `diff` for component `app`: not in active environment\n")
+}
+
+func TestDiffComponentListBadReport(t *testing.T) {
+	viper.Set("stack_directory", "../../examples/basic")
+	defer viper.Set("stack_directory", ".")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().StringSlice("env", []string{}, "")
+	cmd.Flags().String("imageTag", "v1", "")
+	cmd.Flags().String("images", "missing-build.json", "")
+	components := []latest.ComponentDescription{
+		{Name: "config", Manifests: []string{"./deployments/config.yaml"}},
+		{Name: "app", Manifests: []string{"./deployments/app.yaml"}},
+	}
+	applier, _ := fakeApplier()
+
+	var out bytes.Buffer
+	_, _, err := diffComponentList(cmd, components, latest.EnvironmentDescription{Name: "local"}, applier, &out)
+	assert.EqualError(t, err, "reading build report: open missing-build.json: no such file or directory")
+	assert.Empty(t, out.String(), "the report is read once, before any manifest is rendered")
+}
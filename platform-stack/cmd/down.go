@@ -1,32 +1,34 @@
 package cmd
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"path/filepath"
-	"strings"
+	"io"
+	"io/ioutil"
+	"os"
 
+	"github.com/altiscope/platform-stack/pkg/apply"
 	"github.com/altiscope/platform-stack/pkg/schema/latest"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-const kubectlDeleteTemplate = `kubectl delete -f "{{ .YamlFile }}"`
-
-type KubectlDeleteRequest struct {
-	YamlFile string
-}
-
 // downCmd represents the down command
 var downCmd = &cobra.Command{
 	Use:   "down [<component>...]",
 	Short: "Tears down the stack.",
 	Long: `Tears down the stack.
 
-If no arguments are provided, all configured objects will be taken down.`,
+If no arguments are provided, all configured objects will be taken down.
+
+Objects are deleted as recorded in the stack's inventory, so they are found even when the generated manifests are gone.
+Components brought up before the inventory was kept are torn down from their generated manifests.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		return configPreRunnerE(cmd, args)
 	},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return initK8s("")
+	},
 	RunE: downComponents,
 }
 
@@ -50,10 +52,20 @@ func downComponents(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return err
 	}
+	graph, err := newComponentGraph(components, config.Components)
+	if err != nil {
+		return err
+	}
 
-	for _, component := range components {
+	inv, err := loadComponentInventory(context.Background(), stackInventoryStore(), currentEnv)
+	if err != nil {
+		return err
+	}
+
+	// dependents are torn down before the components they depend on
+	for _, component := range graph.reverseTopologicalOrder() {
 		fmt.Printf("Tearing down components at %v...\n", component.Name)
-		err := downComponent(cmd, component)
+		err := downComponent(cmd, component, inv, stackApplier(), os.Stdout)
 		if err != nil {
 			fmt.Printf("`%v` component failed teardown. You may need to delete it manually.\n", component.Name)
 		}
@@ -78,42 +90,74 @@ func downAllComponents(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return err
 	}
+	graph, err := newComponentGraph(components, config.Components)
+	if err != nil {
+		return err
+	}
+
+	inv, err := loadComponentInventory(context.Background(), stackInventoryStore(), currentEnv)
+	if err != nil {
+		return err
+	}
 
-	for _, component := range components {
+	// dependents are torn down before the components they depend on
+	for _, component := range graph.reverseTopologicalOrder() {
 		fmt.Printf("Tearing down components at %v...\n", component.Name)
-		err := downComponent(cmd, component)
+		err := downComponent(cmd, component, inv, stackApplier(), os.Stdout)
 		if err != nil {
 			fmt.Printf("`%v` component failed teardown. You may need to delete it manually.\n", component.Name)
 		}
 	}
+
+	// components removed from the configuration are only known to the inventory
+	for _, name := range unconfiguredComponents(inv, config.Components) {
+		fmt.Printf("Tearing down components at %v...\n", name)
+		err := downComponent(cmd, latest.ComponentDescription{Name: name}, inv, stackApplier(), os.Stdout)
+		if err != nil {
+			fmt.Printf("`%v` component failed teardown. You may need to delete it manually.\n", name)
+		}
+	}
 	return nil
 }
 
-func downComponent(cmd *cobra.Command, component latest.ComponentDescription) (err error) {
-	absoluteProjectDirectory, _ := filepath.Abs(viper.GetString("stack_directory"))
-
-	for _, manifest := range component.Manifests {
+// downComponent deletes the objects recorded in the inventory for the component, falling back to the objects in its
+// generated manifests when it has no inventory
+func downComponent(cmd *cobra.Command, component latest.ComponentDescription, inv *componentInventory, applier *apply.Applier, out io.Writer) (err error) {
+	ctx := context.Background()
+	refs := inv.objects(component.Name)
+	if len(refs) == 0 {
+		objects, err := generatedObjects(component)
+		if err != nil {
+			return err
+		}
+		refs = objectReferences(objects)
+	}
 
-		manifestName := strings.TrimSuffix(filepath.Base(manifest), filepath.Ext(manifest))
-		manifestPath := filepath.Join(absoluteProjectDirectory, manifest)
-		manifestDirectory := filepath.Dir(manifestPath)
-		generatedYamlFile := fmt.Sprintf("%v/%v-generated.yaml", manifestDirectory, manifestName)
+	remaining := deleteInventoryObjects(ctx, applier, refs, out)
+	_, _ = fmt.Fprintln(out)
+	if err := inv.set(ctx, component.Name, remaining); err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("%v objects in `%v` could not be deleted", len(remaining), component.Name)
+	}
+	return nil
+}
 
-		deleteYamlCmd, err := GenerateCommand(kubectlDeleteTemplate, KubectlDeleteRequest{
-			YamlFile: generatedYamlFile,
-		})
+// generatedObjects decodes the manifests last generated for the component by `up`
+func generatedObjects(component latest.ComponentDescription) (objects []*unstructured.Unstructured, err error) {
+	for _, manifest := range component.Manifests {
+		generated, err := ioutil.ReadFile(generatedManifestPath(manifest))
 		if err != nil {
-			return err
+			return nil, err
 		}
-		var stdoutBytes, errorBytes bytes.Buffer
-		deleteYamlCmd.Stdout = &stdoutBytes
-		deleteYamlCmd.Stderr = &errorBytes
-		if err := deleteYamlCmd.Run(); err != nil {
-			return fmt.Errorf(errorBytes.String())
+		decoded, err := apply.Decode(generated)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Println(stdoutBytes.String())
+		objects = append(objects, decoded...)
 	}
-	return nil
+	return objects, nil
 }
 
 func init() {
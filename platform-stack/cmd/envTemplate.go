@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// executeEnvTemplate executes a template over environment variables in `KEY=value` form, failing on variables that
+// are not set. The name describes the template in errors, e.g. "build arg `VERSION` of image `app`".
+func executeEnvTemplate(name, tmpl string, environ []string) (string, error) {
+	parsed, err := template.New("env").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid %v: %w", name, err)
+	}
+	env := map[string]string{}
+	for _, variable := range environ {
+		if parts := strings.SplitN(variable, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	for _, variable := range templateVariables(parsed.Tree.Root, nil) {
+		if _, ok := env[variable]; !ok {
+			return "", fmt.Errorf("%v requires the environment variable `%v`, which is not set", name, variable)
+		}
+	}
+	var executed bytes.Buffer
+	if err := parsed.Execute(&executed, env); err != nil {
+		return "", fmt.Errorf("executing %v: %w", name, err)
+	}
+	return executed.String(), nil
+}
+
+// templateVariables returns the sorted names of the variables a template refers to as fields of its data, e.g. `FOO`
+// for `{{ .FOO }}`
+func templateVariables(node parse.Node, names []string) []string {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return names
+		}
+		for _, child := range node.Nodes {
+			names = templateVariables(child, names)
+		}
+	case *parse.ActionNode:
+		names = templateVariables(node.Pipe, names)
+	case *parse.PipeNode:
+		if node == nil {
+			return names
+		}
+		for _, command := range node.Cmds {
+			names = templateVariables(command, names)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			names = templateVariables(arg, names)
+		}
+	case *parse.FieldNode:
+		if !containsString(names, node.Ident[0]) {
+			names = append(names, node.Ident[0])
+			sort.Strings(names)
+		}
+	case *parse.IfNode:
+		names = templateVariables(node.Pipe, names)
+		names = templateVariables(node.List, names)
+		names = templateVariables(node.ElseList, names)
+	case *parse.RangeNode:
+		// fields within the range refer to its elements rather than to variables
+		names = templateVariables(node.Pipe, names)
+		names = templateVariables(node.ElseList, names)
+	case *parse.WithNode:
+		names = templateVariables(node.Pipe, names)
+		names = templateVariables(node.ElseList, names)
+	}
+	return names
+}
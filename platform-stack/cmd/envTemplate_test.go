@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteEnvTemplate(t *testing.T) {
+	environ := []string{"REGISTRY=localhost:5000", "EMPTY=", "MODE=release"}
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		err      string
+	}{
+		{"variables", "{{ .REGISTRY }}/app:{{ .MODE }}", "localhost:5000/app:release", ""},
+		{"empty variable", "{{ .EMPTY }}", "", ""},
+		{"conditional", `{{ if eq .MODE "release" }}{{ .REGISTRY }}{{ else }}{{ .DEV_REGISTRY }}{{ end }}`, "", "value requires the environment variable `DEV_REGISTRY`, which is not set"},
+		{"unset variables", "{{ .B }}{{ .A }}", "", "value requires the environment variable `A`, which is not set"},
+		{"invalid", "{{ .REGISTRY ", "", "invalid value: template: env:1: unclosed action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := executeEnvTemplate("value", tt.template, environ)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
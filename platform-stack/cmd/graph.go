@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+)
+
+// componentGraph is a directed acyclic graph of components, with edges from each component to the components it dependsOn
+type componentGraph struct {
+	// components are kept in configuration order so that traversal is deterministic
+	components   []latest.ComponentDescription
+	dependencies map[string][]string
+}
+
+// newComponentGraph builds the dependency graph for the given components, validating it against all configured components.
+// Dependencies on configured components that were not selected are dropped, as they are assumed to be up already.
+func newComponentGraph(components, configuredComponents []latest.ComponentDescription) (*componentGraph, error) {
+	if err := validateComponentDependencies(configuredComponents); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]bool, len(components))
+	for _, component := range components {
+		selected[component.Name] = true
+	}
+	graph := &componentGraph{
+		components:   components,
+		dependencies: make(map[string][]string, len(components)),
+	}
+	for _, component := range components {
+		for _, dependency := range component.DependsOn {
+			if selected[dependency] {
+				graph.dependencies[component.Name] = append(graph.dependencies[component.Name], dependency)
+			}
+		}
+	}
+	return graph, nil
+}
+
+// validateComponentDependencies ensures every dependency names a configured component, and that there are no cycles
+func validateComponentDependencies(components []latest.ComponentDescription) error {
+	byName := make(map[string]latest.ComponentDescription, len(components))
+	for _, component := range components {
+		byName[component.Name] = component
+	}
+	for _, component := range components {
+		for _, dependency := range component.DependsOn {
+			if _, ok := byName[dependency]; !ok {
+				return fmt.Errorf("component `%v` depends on unknown component `%v`", component.Name, dependency)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(components))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("component dependency cycle: %v -> %v", strings.Join(path, " -> "), name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dependency := range byName[name].DependsOn {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, component := range components {
+		if err := visit(component.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topologicalOrder returns the components so that each comes after all of its dependencies, otherwise preserving configuration order
+func (g *componentGraph) topologicalOrder() []latest.ComponentDescription {
+	done := make(map[string]bool, len(g.components))
+	ordered := make([]latest.ComponentDescription, 0, len(g.components))
+	for len(ordered) < len(g.components) {
+		for _, component := range g.components {
+			if done[component.Name] || !g.dependenciesDone(component.Name, done) {
+				continue
+			}
+			done[component.Name] = true
+			ordered = append(ordered, component)
+			// restart so that earlier configured components are preferred
+			break
+		}
+	}
+	return ordered
+}
+
+// reverseTopologicalOrder returns the components so that each comes before all of its dependencies
+func (g *componentGraph) reverseTopologicalOrder() []latest.ComponentDescription {
+	ordered := g.topologicalOrder()
+	for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+		ordered[i], ordered[j] = ordered[j], ordered[i]
+	}
+	return ordered
+}
+
+// hasDependents reports whether any component in the graph depends on the named component
+func (g *componentGraph) hasDependents(name string) bool {
+	for _, dependencies := range g.dependencies {
+		if containsString(dependencies, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *componentGraph) dependenciesDone(name string, done map[string]bool) bool {
+	for _, dependency := range g.dependencies[name] {
+		if !done[dependency] {
+			return false
+		}
+	}
+	return true
+}
+
+// walk calls fn for each component once all of its dependencies have completed, running independent components concurrently.
+// After the first failure no further components are started, and the first error is returned once running calls have finished.
+func (g *componentGraph) walk(ctx context.Context, fn func(ctx context.Context, component latest.ComponentDescription) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	completed := make(map[string]chan struct{}, len(g.components))
+	for _, component := range g.components {
+		completed[component.Name] = make(chan struct{})
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for _, component := range g.components {
+		wg.Add(1)
+		go func(component latest.ComponentDescription) {
+			defer wg.Done()
+			for _, dependency := range g.dependencies[component.Name] {
+				select {
+				case <-completed[dependency]:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err := fn(ctx, component); err != nil {
+				fail(err)
+				return
+			}
+			close(completed[component.Name])
+		}(component)
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// orderedOutput buffers output per component and releases it in the given order as components complete,
+// so that concurrently processed components still print deterministically
+type orderedOutput struct {
+	mu       sync.Mutex
+	out      io.Writer
+	order    []string
+	buffers  map[string]*bytes.Buffer
+	finished map[string]bool
+	next     int
+}
+
+func newOrderedOutput(components []latest.ComponentDescription, out io.Writer) *orderedOutput {
+	o := &orderedOutput{
+		out:      out,
+		buffers:  make(map[string]*bytes.Buffer, len(components)),
+		finished: make(map[string]bool, len(components)),
+	}
+	for _, component := range components {
+		o.order = append(o.order, component.Name)
+		o.buffers[component.Name] = &bytes.Buffer{}
+	}
+	return o
+}
+
+// writer returns the buffer for the named component, which must only be written by a single goroutine
+func (o *orderedOutput) writer(name string) io.Writer {
+	return o.buffers[name]
+}
+
+// complete marks the named component as finished, writing out every finished component that is next in order
+func (o *orderedOutput) complete(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished[name] = true
+	for o.next < len(o.order) && o.finished[o.order[o.next]] {
+		_, _ = o.buffers[o.order[o.next]].WriteTo(o.out)
+		o.next++
+	}
+}
+
+// flush writes out any remaining output, such as that of components completed after an earlier failure
+func (o *orderedOutput) flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for ; o.next < len(o.order); o.next++ {
+		_, _ = o.buffers[o.order[o.next]].WriteTo(o.out)
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/stretchr/testify/assert"
+)
+
+var graphComponents = []latest.ComponentDescription{
+	{Name: "frontend", DependsOn: []string{"backend"}},
+	{Name: "backend", DependsOn: []string{"config", "db"}},
+	{Name: "db"},
+	{Name: "config"},
+}
+
+func componentNames(components []latest.ComponentDescription) (names []string) {
+	for _, component := range components {
+		names = append(names, component.Name)
+	}
+	return names
+}
+
+func TestValidateComponentDependencies(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []latest.ComponentDescription
+		err        string
+	}{
+		{"no dependencies", []latest.ComponentDescription{{Name: "app"}, {Name: "config"}}, ""},
+		{"valid dependencies", graphComponents, ""},
+		{"unknown dependency", []latest.ComponentDescription{{Name: "app", DependsOn: []string{"missing"}}}, "component `app` depends on unknown component `missing`"},
+		{"self dependency", []latest.ComponentDescription{{Name: "app", DependsOn: []string{"app"}}}, "component dependency cycle: app -> app"},
+		{"cycle", []latest.ComponentDescription{
+			{Name: "a", DependsOn: []string{"b"}},
+			{Name: "b", DependsOn: []string{"c"}},
+			{Name: "c", DependsOn: []string{"a"}},
+		}, "component dependency cycle: a -> b -> c -> a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateComponentDependencies(tt.components)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	graph, err := newComponentGraph(graphComponents, graphComponents)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db", "config", "backend", "frontend"}, componentNames(graph.topologicalOrder()))
+	assert.Equal(t, []string{"frontend", "backend", "config", "db"}, componentNames(graph.reverseTopologicalOrder()))
+	assert.True(t, graph.hasDependents("config"))
+	assert.False(t, graph.hasDependents("frontend"))
+}
+
+func TestTopologicalOrderOfSelection(t *testing.T) {
+	selected := []latest.ComponentDescription{graphComponents[0], graphComponents[3]}
+	graph, err := newComponentGraph(selected, graphComponents)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"frontend", "config"}, componentNames(graph.topologicalOrder()))
+	assert.False(t, graph.hasDependents("config"))
+}
+
+func TestWalk(t *testing.T) {
+	graph, err := newComponentGraph(graphComponents, graphComponents)
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	var visited []string
+	err = graph.walk(context.Background(), func(ctx context.Context, component latest.ComponentDescription) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, dependency := range component.DependsOn {
+			assert.Contains(t, visited, dependency, "`%v` started before its dependency", component.Name)
+		}
+		visited = append(visited, component.Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"frontend", "backend", "db", "config"}, visited)
+}
+
+func TestWalkStopsDependentsOnFailure(t *testing.T) {
+	graph, err := newComponentGraph(graphComponents, graphComponents)
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	var visited []string
+	err = graph.walk(context.Background(), func(ctx context.Context, component latest.ComponentDescription) error {
+		mu.Lock()
+		visited = append(visited, component.Name)
+		mu.Unlock()
+		if component.Name == "db" {
+			return fmt.Errorf("db failed")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "db failed")
+	assert.NotContains(t, visited, "backend")
+	assert.NotContains(t, visited, "frontend")
+}
+
+func TestOrderedOutput(t *testing.T) {
+	var out bytes.Buffer
+	output := newOrderedOutput(graphComponents[2:], &out)
+
+	_, _ = fmt.Fprintln(output.writer("config"), "config done")
+	output.complete("config")
+	assert.Equal(t, "", out.String())
+
+	_, _ = fmt.Fprintln(output.writer("db"), "db done")
+	output.complete("db")
+	assert.Equal(t, "db done\nconfig done\n", out.String())
+
+	output.flush()
+	assert.Equal(t, "db done\nconfig done\n", out.String())
+}
@@ -3,13 +3,13 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"github.com/cenkalti/backoff/v4"
+	"github.com/altiscope/platform-stack/pkg/rollout"
 	"github.com/spf13/cobra"
 	"io"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/duration"
-	v12 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"os"
 	"strings"
 	"time"
@@ -105,64 +105,13 @@ func printPodListHealth(pods *v1.PodList, out io.Writer) (podsHealthy bool, err
 	return podsHealthy, nil
 }
 
-func waitForStackWithTimeout(api v12.CoreV1Interface, cmd *cobra.Command, timeoutMs time.Duration) (err error, ctx context.Context) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutMs*time.Millisecond)
-	defer cancel() // releases resources if slowOperation completes before timeout elapses
-	err = waitForStack(api, cmd, ctx)
-	return err, ctx
-}
-
-func waitForStack(api v12.CoreV1Interface, cmd *cobra.Command, ctx context.Context) (err error) {
-
-	ns, _ := cmd.Flags().GetString("namespace")
-	label, _ := cmd.Flags().GetStringSlice("label")
-	field, _ := cmd.Flags().GetStringSlice("field")
-
-	backoffConfig := backoff.NewExponentialBackOff()
-
-	backoffConfig.Multiplier = 2
-	backoffConfig.MaxInterval = 10 * time.Second
-	ticker := backoff.NewTicker(backoffConfig)
-	defer ticker.Stop()
-
-	lastPrintTime := time.Now()
-	podList, err := getPodsList(api, ns, label, field)
-	for {
-		select {
-		case <-ctx.Done():
-			_, _ = printPodListHealth(podList, os.Stdout)
-			return ctx.Err()
-		case <-ticker.C:
-			podList, err = getPodsList(api, ns, label, field)
-			if err != nil {
-				return err
-			}
-			null, err := os.Open(os.DevNull) // For read access.
-			if err != nil {
-				return err
-			}
-			var healthy bool
-			var printer io.Writer
-
-			if time.Since(lastPrintTime).Seconds() >= 30 {
-				lastPrintTime = time.Now()
-				printer = os.Stdout
-			} else {
-				printer = null
-			}
-			healthy, err = printPodListHealth(podList, printer)
-			if err != nil {
-				_, _ = printPodListHealth(podList, os.Stderr)
-				return err
-			}
-			if healthy {
-				_, _ = printPodListHealth(podList, os.Stdout)
-				return nil
-			}
-		}
-	}
-
+// waitForRollout watches the given objects until their workloads have rolled out, failing as soon as a rollout cannot
+// succeed, or when the timeout elapses. Objects that are not workloads are ready as soon as they exist.
+func waitForRollout(ctx context.Context, objects []*unstructured.Unstructured, timeout time.Duration, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	waiter := &rollout.Waiter{Applier: stackApplier(), Out: out}
+	return waiter.Wait(ctx, objects)
 }
 
 func translateTimestampSince(timestamp metav1.Time) string {
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/altiscope/platform-stack/pkg/history"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// defaultHistoryMax is the number of revisions kept for each component
+const defaultHistoryMax = 10
+
+const gitCommitTemplate = `git -C "{{ .Directory }}" rev-parse HEAD`
+
+type GitCommitRequest struct {
+	Directory string
+}
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history [component]",
+	Short: "Lists the revisions deployed for components of the stack.",
+	Long: `Lists the revisions deployed for components of the stack.
+
+Every ` + "`up`" + ` records a revision for each component it brings up in the current environment, holding the rendered
+manifests, images, git commit and user. If no component is provided, the revisions of all components are listed.
+See ` + "`stack rollback`" + ` to re-apply an earlier revision.`,
+	Args: cobra.MaximumNArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return configPreRunnerE(cmd, args)
+	},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return initK8s("")
+	},
+	RunE: showHistory,
+}
+
+func showHistory(cmd *cobra.Command, args []string) (err error) {
+
+	currentEnv, err := getEnvironment()
+	if err != nil {
+		return err
+	}
+	if currentEnv == (latest.EnvironmentDescription{}) {
+		return fmt.Errorf("no active environment detected")
+	}
+
+	component := ""
+	if len(args) > 0 {
+		component = args[0]
+	}
+	revisions, err := stackHistoryStore().List(context.Background(), config.Stack.Name, currentEnv.Name, component)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		fmt.Printf("No revisions found in environment `%v`\n", currentEnv.Name)
+		return nil
+	}
+	printRevisions(revisions, os.Stdout)
+	return nil
+}
+
+// printRevisions writes a row per revision
+func printRevisions(revisions []*history.Revision, out io.Writer) {
+	columnsTemplate := "%-16v%-10v%-22v%-12v%-16v%-10v%-40v%v\n"
+	_, _ = fmt.Fprintf(out, columnsTemplate, "COMPONENT", "REVISION", "DEPLOYED", "STATUS", "USER", "COMMIT", "IMAGES", "DESCRIPTION")
+	for _, revision := range revisions {
+		commit := revision.GitCommit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		images := strings.Join(revision.Images, ",")
+		if images == "" {
+			images = "<none>"
+		}
+		_, _ = fmt.Fprintf(out, columnsTemplate,
+			revision.Component,
+			revision.Number,
+			revision.DeployedAt.Local().Format("2006-01-02 15:04:05"),
+			revision.Status,
+			valueOrNone(revision.User),
+			valueOrNone(commit),
+			images,
+			revision.Description,
+		)
+	}
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+// stackHistoryStore returns the store for revisions of the current stack, which are kept in the current namespace
+func stackHistoryStore() *history.Store {
+	namespace := currentNamespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	return &history.Store{Client: clientset.CoreV1(), Namespace: namespace, MaxRevisions: defaultHistoryMax}
+}
+
+// newRevision describes a deployment of a component, which failed if applyErr is set
+func newRevision(component string, env latest.EnvironmentDescription, manifests []history.Manifest, applied []*unstructured.Unstructured, applyErr error) *history.Revision {
+	revision := &history.Revision{
+		Stack:       config.Stack.Name,
+		Environment: env.Name,
+		Component:   component,
+		Status:      history.StatusDeployed,
+		Description: "up",
+		Manifests:   manifests,
+		Images:      history.Images(applied),
+		GitCommit:   gitCommit(),
+		User:        currentUser(),
+		DeployedAt:  time.Now().UTC(),
+	}
+	if applyErr != nil {
+		revision.Status = history.StatusFailed
+		revision.Description = applyErr.Error()
+	}
+	return revision
+}
+
+// recordRevision saves a revision, unless nothing was rendered for it
+func recordRevision(ctx context.Context, store *history.Store, revision *history.Revision) error {
+	if len(revision.Manifests) == 0 {
+		return nil
+	}
+	return store.Record(ctx, revision)
+}
+
+// gitCommit returns the commit checked out in the stack directory, or nothing if it is not a git repository
+func gitCommit() string {
+	directory, _ := filepath.Abs(viper.GetString("stack_directory"))
+	gitCmd, err := GenerateCommand(gitCommitTemplate, GitCommitRequest{Directory: directory})
+	if err != nil {
+		return ""
+	}
+	var stdoutBytes bytes.Buffer
+	gitCmd.Stdout = &stdoutBytes
+	if err := gitCmd.Run(); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdoutBytes.String())
+}
+
+// currentUser returns the name of the user running stack
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+}
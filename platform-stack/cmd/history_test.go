@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/altiscope/platform-stack/pkg/history"
+	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestHistoryIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		fixture string
+	}{
+		{"history help", []string{"help", "history"}, "stack-history-help.golden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(path.Join(".", "stack"), tt.args...)
+			result, _ := cmd.CombinedOutput()
+			golden.AssertBytes(t, result, tt.fixture)
+		})
+	}
+}
+
+func TestPrintRevisions(t *testing.T) {
+	deployedAt := time.Date(2021, 3, 1, 12, 0, 0, 0, time.Local)
+	revisions := []*history.Revision{
+		{Component: "app", Number: 1, Status: history.StatusSuperseded, Description: "up", User: "dev",
+			GitCommit: "0123456789abcdef", Images: []string{"stack-app:1"}, DeployedAt: deployedAt},
+		{Component: "app", Number: 2, Status: history.StatusDeployed, Description: "rollback to 1", DeployedAt: deployedAt},
+	}
+
+	var out bytes.Buffer
+	printRevisions(revisions, &out)
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "app             1         2021-03-01 12:00:00   superseded  dev             0123456   stack-app:1                             up", string(lines[1]))
+	assert.Contains(t, string(lines[2]), "<none>                                  rollback to 1")
+}
@@ -46,23 +46,6 @@ var StackCLIDependencies = map[string]DependencyDescription{
 			"darwin": []string{"xcode-select --install"},
 		},
 	},
-	"gsm-buddy": {
-		os:      []string{"darwin", "linux"},
-		version: "v0.1.1",
-		test:    "gsm-buddy",
-		install: map[string][]string{
-			"darwin": []string{
-				`curl -sSL https://github.com/yamaszone/gcp-secret-manager-buddy/releases/download/{{ .Version }}/gcp-secret-manager-buddy-{{ .Version }}-darwin-amd64 -o gsm-buddy`,
-				"chmod a+x gsm-buddy",
-				"sudo mv gsm-buddy /usr/local/bin/",
-			},
-			"linux": []string{
-				`curl -sSL https://github.com/yamaszone/gcp-secret-manager-buddy/releases/download/{{ .Version }}/gcp-secret-manager-buddy-{{ .Version }}-linux-amd64 -o gsm-buddy`,
-				"chmod a+x gsm-buddy",
-				"sudo mv gsm-buddy /usr/local/bin/",
-			},
-		},
-	},
 	"kubectl": {
 		os:      []string{"darwin", "linux"},
 		test:    "kubectl",
@@ -77,33 +60,42 @@ var StackCLIDependencies = map[string]DependencyDescription{
 			},
 		},
 	},
-	"kubetpl": {
+	"minikube": {
+		os:      []string{"darwin", "linux"},
+		test:    "minikube",
+		version: getEnv("MINIKUBE_VERSION", "v1.22.0"),
+		install: map[string][]string{
+			"darwin": []string{
+				"curl -Lo minikube https://storage.googleapis.com/minikube/releases/{{ .Version }}/minikube-darwin-amd64 && chmod +x minikube && sudo cp minikube /usr/local/bin/ && rm minikube",
+			},
+			"linux": []string{
+				"curl -Lo minikube https://storage.googleapis.com/minikube/releases/{{ .Version }}/minikube-linux-amd64 && chmod +x minikube && sudo cp minikube /usr/local/bin/ && rm minikube",
+			},
+		},
+	},
+	"sops": {
 		os:      []string{"darwin", "linux"},
-		version: "0.9.0",
-		test:    "kubetpl",
+		test:    "sops --version",
+		version: getEnv("SOPS_VERSION", "v3.9.1"),
 		install: map[string][]string{
 			"darwin": []string{
-				`curl -sSL https://github.com/shyiko/kubetpl/releases/download/{{ .Version }}/kubetpl-{{ .Version }}-darwin-amd64 -o kubetpl`,
-				"chmod a+x kubetpl",
-				"sudo mv kubetpl /usr/local/bin/",
+				"curl -Lo sops https://github.com/getsops/sops/releases/download/{{ .Version }}/sops-{{ .Version }}.darwin.amd64 && chmod +x sops && sudo mv sops /usr/local/bin/sops",
 			},
 			"linux": []string{
-				`curl -sSL https://github.com/shyiko/kubetpl/releases/download/{{ .Version }}/kubetpl-{{ .Version }}-linux-amd64 -o kubetpl`,
-				"chmod a+x kubetpl",
-				"sudo mv kubetpl /usr/local/bin/",
+				"curl -Lo sops https://github.com/getsops/sops/releases/download/{{ .Version }}/sops-{{ .Version }}.linux.amd64 && chmod +x sops && sudo mv sops /usr/local/bin/sops",
 			},
 		},
 	},
-	"minikube": {
+	"age": {
 		os:      []string{"darwin", "linux"},
-		test:    "minikube",
-		version: getEnv("MINIKUBE_VERSION", "v1.22.0"),
+		test:    "age --version",
+		version: getEnv("AGE_VERSION", "v1.1.1"),
 		install: map[string][]string{
 			"darwin": []string{
-				"curl -Lo minikube https://storage.googleapis.com/minikube/releases/{{ .Version }}/minikube-darwin-amd64 && chmod +x minikube && sudo cp minikube /usr/local/bin/ && rm minikube",
+				"curl -L https://github.com/FiloSottile/age/releases/download/{{ .Version }}/age-{{ .Version }}-darwin-amd64.tar.gz | tar xz && sudo mv age/age age/age-keygen /usr/local/bin/ && rm -rf age",
 			},
 			"linux": []string{
-				"curl -Lo minikube https://storage.googleapis.com/minikube/releases/{{ .Version }}/minikube-linux-amd64 && chmod +x minikube && sudo cp minikube /usr/local/bin/ && rm minikube",
+				"curl -L https://github.com/FiloSottile/age/releases/download/{{ .Version }}/age-{{ .Version }}-linux-amd64.tar.gz | tar xz && sudo mv age/age age/age-keygen /usr/local/bin/ && rm -rf age",
 			},
 		},
 	},
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/altiscope/platform-stack/pkg/apply"
+	"github.com/altiscope/platform-stack/pkg/inventory"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// componentInventory guards the stack inventory of the current environment, saving it on every change so that it
+// stays accurate even when components are brought up concurrently or a run is interrupted
+type componentInventory struct {
+	mu    sync.Mutex
+	store *inventory.Store
+	inv   *inventory.Inventory
+}
+
+// stackInventoryStore returns the store for inventories of the current stack, which are kept in the current namespace
+func stackInventoryStore() *inventory.Store {
+	namespace := currentNamespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	return &inventory.Store{Client: clientset.CoreV1(), Namespace: namespace}
+}
+
+func loadComponentInventory(ctx context.Context, store *inventory.Store, env latest.EnvironmentDescription) (*componentInventory, error) {
+	inv, err := store.Load(ctx, config.Stack.Name, env.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &componentInventory{store: store, inv: inv}, nil
+}
+
+// objects returns the objects recorded for the named component
+func (c *componentInventory) objects(component string) []inventory.ObjectReference {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inv.Components[component]
+}
+
+// componentNames returns the names of all components with recorded objects
+func (c *componentInventory) componentNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inv.ComponentNames()
+}
+
+// add records objects applied for a component alongside those already recorded
+func (c *componentInventory) add(ctx context.Context, component string, objects []inventory.ObjectReference) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inv.Add(component, objects)
+	return c.store.Save(ctx, c.inv)
+}
+
+// set replaces the objects recorded for a component, forgetting the component if there are none
+func (c *componentInventory) set(ctx context.Context, component string, objects []inventory.ObjectReference) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inv.Set(component, objects)
+	return c.store.Save(ctx, c.inv)
+}
+
+// objectReferences returns inventory references for the given objects
+func objectReferences(objects []*unstructured.Unstructured) []inventory.ObjectReference {
+	refs := make([]inventory.ObjectReference, 0, len(objects))
+	for _, object := range objects {
+		refs = append(refs, inventory.NewObjectReference(object))
+	}
+	return refs
+}
+
+// deleteInventoryObjects deletes the referenced objects, returning those that could not be deleted
+func deleteInventoryObjects(ctx context.Context, applier *apply.Applier, refs []inventory.ObjectReference, out io.Writer) (remaining []inventory.ObjectReference) {
+	objects := make([]*unstructured.Unstructured, 0, len(refs))
+	for _, ref := range refs {
+		objects = append(objects, ref.Unstructured())
+	}
+	results := applier.Delete(ctx, objects)
+	apply.PrintDeleted(results, out)
+	for i, result := range results {
+		if result.Err != nil && !errors.IsNotFound(result.Err) {
+			remaining = append(remaining, refs[i])
+		}
+	}
+	return remaining
+}
+
+// recordComponent records the objects applied for a component. When pruning, objects recorded by an earlier run that
+// were not applied this time are deleted, otherwise they are kept in the inventory so that a later prune or `down` finds them.
+func recordComponent(ctx context.Context, inv *componentInventory, applier *apply.Applier, component string, applied []*unstructured.Unstructured, prune bool, out io.Writer) error {
+	refs := objectReferences(applied)
+	if !prune {
+		return inv.add(ctx, component, refs)
+	}
+	stale := inventory.Difference(inv.objects(component), refs)
+	if len(stale) > 0 {
+		_, _ = fmt.Fprintf(out, "Pruning %v objects from `%v`\n", len(stale), component)
+	}
+	remaining := deleteInventoryObjects(ctx, applier, stale, out)
+	if err := inv.set(ctx, component, inventory.Union(refs, remaining)); err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("%v objects in `%v` could not be pruned", len(remaining), component)
+	}
+	return nil
+}
+
+// pruneComponent deletes every object recorded for a component that is no longer part of the stack
+func pruneComponent(ctx context.Context, inv *componentInventory, applier *apply.Applier, component string, out io.Writer) error {
+	refs := inv.objects(component)
+	if len(refs) == 0 {
+		return nil
+	}
+	_, _ = fmt.Fprintf(out, "Pruning %v objects from `%v`\n", len(refs), component)
+	remaining := deleteInventoryObjects(ctx, applier, refs, out)
+	if err := inv.set(ctx, component, remaining); err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("%v objects in `%v` could not be pruned", len(remaining), component)
+	}
+	return nil
+}
+
+// unconfiguredComponents returns the names of inventoried components that are no longer in the configuration
+func unconfiguredComponents(inv *componentInventory, configuredComponents []latest.ComponentDescription) (names []string) {
+	configured := make(map[string]bool, len(configuredComponents))
+	for _, component := range configuredComponents {
+		configured[component.Name] = true
+	}
+	for _, name := range inv.componentNames() {
+		if !configured[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
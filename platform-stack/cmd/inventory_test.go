@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/altiscope/platform-stack/pkg/inventory"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func inventoryObject(apiVersion, kind, name string) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion(apiVersion)
+	object.SetKind(kind)
+	object.SetNamespace("testns")
+	object.SetName(name)
+	return object
+}
+
+func fakeComponentInventory() *componentInventory {
+	store := &inventory.Store{Client: k8sfake.NewSimpleClientset().CoreV1(), Namespace: "testns"}
+	return &componentInventory{store: store, inv: inventory.New("app", "local")}
+}
+
+func TestRecordComponentPrune(t *testing.T) {
+	ctx := context.Background()
+	deployment := inventoryObject("apps/v1", "Deployment", "app")
+	service := inventoryObject("v1", "Service", "app")
+	applier, client := fakeApplier(deployment.DeepCopy(), service.DeepCopy())
+	inv := fakeComponentInventory()
+
+	var out bytes.Buffer
+	assert.NoError(t, recordComponent(ctx, inv, applier, "app", []*unstructured.Unstructured{deployment, service}, false, &out))
+	assert.Len(t, inv.objects("app"), 2)
+
+	// without pruning, objects that are no longer applied stay in the inventory
+	assert.NoError(t, recordComponent(ctx, inv, applier, "app", []*unstructured.Unstructured{deployment}, false, &out))
+	assert.Len(t, inv.objects("app"), 2)
+	assert.Equal(t, "", out.String())
+
+	assert.NoError(t, recordComponent(ctx, inv, applier, "app", []*unstructured.Unstructured{deployment}, true, &out))
+	assert.Equal(t, []inventory.ObjectReference{inventory.NewObjectReference(deployment)}, inv.objects("app"))
+	assert.Equal(t, "Pruning 1 objects from `app`\nservice \"app\" deleted\n", out.String())
+
+	services := schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	_, err := client.Resource(services).Namespace("testns").Get(ctx, "app", metav1.GetOptions{})
+	assert.Error(t, err)
+}
+
+func TestDownComponentFromInventory(t *testing.T) {
+	ctx := context.Background()
+	configMap := inventoryObject("v1", "ConfigMap", "stack-env")
+	applier, _ := fakeApplier(configMap.DeepCopy())
+	inv := fakeComponentInventory()
+	assert.NoError(t, inv.add(ctx, "removed", objectReferences([]*unstructured.Unstructured{configMap})))
+
+	// the component has no manifests, so its objects can only be found through the inventory
+	var out bytes.Buffer
+	err := downComponent(downCmd, latest.ComponentDescription{Name: "removed"}, inv, applier, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "configmap \"stack-env\" deleted\n\n", out.String())
+	assert.Empty(t, inv.componentNames())
+}
+
+func TestUnconfiguredComponents(t *testing.T) {
+	inv := fakeComponentInventory()
+	ref := inventory.NewObjectReference(inventoryObject("v1", "ConfigMap", "stack-env"))
+	assert.NoError(t, inv.add(context.Background(), "config", []inventory.ObjectReference{ref}))
+	assert.NoError(t, inv.add(context.Background(), "removed", []inventory.ObjectReference{ref}))
+
+	assert.Equal(t, []string{"removed"}, unconfiguredComponents(inv, []latest.ComponentDescription{{Name: "config"}, {Name: "app"}}))
+}
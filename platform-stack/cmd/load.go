@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/spf13/cobra"
+	"io"
+	"strings"
+)
+
+const kindLoadTemplate = `kind load docker-image {{ .Image }} --name {{ .Cluster }}`
+const minikubeLoadTemplate = `minikube image load {{ .Image }} --profile {{ .Cluster }}`
+const microk8sLoadTemplate = `docker save {{ .Image }} | microk8s ctr image import -`
+
+type ImageLoadRequest struct {
+	Image   string
+	Cluster string
+}
+
+// loadContext reports whether built images are to be loaded into the cluster, as they are when the load flag is given
+// or the environment is local, and returns the active kube context to load them into
+func loadContext(cmd *cobra.Command, env latest.EnvironmentDescription) (kubeContext string, load bool) {
+	load, _ = cmd.Flags().GetBool("load")
+	if !load && !env.Local {
+		return "", false
+	}
+	return getContext(), true
+}
+
+// clusterImageLoader returns the command template that loads host-built images into the cluster of a kube context,
+// along with the name of the cluster. Clusters that share the host's Docker daemon need no loading, and an empty
+// template is returned for them.
+func clusterImageLoader(kubeContext string) (loadTemplate, cluster string, err error) {
+	switch {
+	case strings.HasPrefix(kubeContext, "kind-"):
+		return kindLoadTemplate, strings.TrimPrefix(kubeContext, "kind-"), nil
+	case kubeContext == "minikube":
+		return minikubeLoadTemplate, kubeContext, nil
+	case kubeContext == "microk8s":
+		return microk8sLoadTemplate, kubeContext, nil
+	case kubeContext == "docker-desktop" || kubeContext == "docker-for-desktop":
+		return "", kubeContext, nil
+	case kubeContext == "":
+		return "", "", fmt.Errorf("unable to load images: no kube context is active")
+	}
+	return "", "", fmt.Errorf("unable to load images into kube context `%v`: only kind, minikube, microk8s and docker-desktop clusters are supported", kubeContext)
+}
+
+// loadBuiltImage loads an image into the cluster of the given kube context when the builder's engine holds it. Images
+// found up to date in their registry rather than locally, or built by a BuildKit daemon, are not held by the engine and
+// are not loaded.
+func loadBuiltImage(ctx context.Context, builder build.Builder, image, reference, kubeContext string, out io.Writer) error {
+	inspector, ok := builder.(build.Inspector)
+	if !ok {
+		_, _ = fmt.Fprintf(out, "[%v] Not loading %v: images built by BuildKit at BUILDKIT_HOST are not held by the docker engine\n", image, reference)
+		return nil
+	}
+	_, found, err := inspector.Inspect(ctx, reference)
+	if err != nil {
+		return fmt.Errorf("looking up `%v` to load it: %w", reference, err)
+	}
+	if !found {
+		_, _ = fmt.Fprintf(out, "[%v] Not loading %v: the docker engine does not hold it, pull it to load it\n", image, reference)
+		return nil
+	}
+	return loadImage(image, reference, kubeContext, out)
+}
+
+// loadImage makes a host-built image available to the cluster of the given kube context
+func loadImage(image, reference, kubeContext string, out io.Writer) error {
+	loadTemplate, cluster, err := clusterImageLoader(kubeContext)
+	if err != nil {
+		return err
+	}
+	if loadTemplate == "" {
+		_, _ = fmt.Fprintf(out, "[%v] Cluster `%v` uses the host's images, nothing to load\n", image, cluster)
+		return nil
+	}
+
+	loadCmd, err := GenerateCommand(loadTemplate, ImageLoadRequest{Image: reference, Cluster: cluster})
+	if err != nil {
+		return err
+	}
+	var output bytes.Buffer
+	loadCmd.Stdout = &output
+	loadCmd.Stderr = &output
+	if err := loadCmd.Run(); err != nil {
+		return fmt.Errorf("loading `%v` into cluster `%v`: %v: %v", reference, cluster, err, strings.TrimSpace(output.String()))
+	}
+	_, _ = fmt.Fprintf(out, "[%v] Loaded %v into cluster `%v`\n", image, reference, cluster)
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClusterImageLoader(t *testing.T) {
+	tests := []struct {
+		kubeContext string
+		command     string
+		err         string
+	}{
+		{"kind-dev", "kind load docker-image localhost:5000/app:v1 --name dev", ""},
+		{"minikube", "minikube image load localhost:5000/app:v1 --profile minikube", ""},
+		{"microk8s", "docker save localhost:5000/app:v1 | microk8s ctr image import -", ""},
+		{"docker-desktop", "", ""},
+		{"platform-stg-blue", "", "unable to load images into kube context `platform-stg-blue`: only kind, minikube, microk8s and docker-desktop clusters are supported"},
+		{"", "", "unable to load images: no kube context is active"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kubeContext, func(t *testing.T) {
+			loadTemplate, cluster, err := clusterImageLoader(tt.kubeContext)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.command == "" {
+				assert.Empty(t, loadTemplate)
+				return
+			}
+			command, err := GenerateCommandString(loadTemplate, ImageLoadRequest{Image: "localhost:5000/app:v1", Cluster: cluster})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.command, command)
+		})
+	}
+}
+
+func TestLoadContext(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("load", false, "")
+
+	_, load := loadContext(cmd, latest.EnvironmentDescription{Name: "staging"})
+	assert.False(t, load)
+	_, load = loadContext(cmd, latest.EnvironmentDescription{Name: "local", Local: true})
+	assert.True(t, load)
+
+	assert.NoError(t, cmd.Flags().Set("load", "true"))
+	_, load = loadContext(cmd, latest.EnvironmentDescription{Name: "staging"})
+	assert.True(t, load)
+}
+
+func TestLoadBuiltImage(t *testing.T) {
+	var out bytes.Buffer
+	local := &fakeBuilder{fakeImages: fakeImages{"app:v1": {ID: "sha256:config"}}}
+	assert.NoError(t, loadBuiltImage(context.Background(), local, "app", "app:v1", "docker-desktop", &out))
+	assert.NoError(t, loadBuiltImage(context.Background(), local, "app", "localhost:5000/app:v1", "kind-stack", &out))
+	assert.NoError(t, loadBuiltImage(context.Background(), &build.BuildKitBuilder{}, "app", "app:v1", "kind-stack", &out))
+	assert.Equal(t, "[app] Cluster `docker-desktop` uses the host's images, nothing to load\n"+
+		"[app] Not loading localhost:5000/app:v1: the docker engine does not hold it, pull it to load it\n"+
+		"[app] Not loading app:v1: images built by BuildKit at BUILDKIT_HOST are not held by the docker engine\n", out.String())
+}
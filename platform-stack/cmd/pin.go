@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/apply"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"io"
+	"os"
+	"sigs.k8s.io/yaml"
+	"strings"
+	"sync"
+)
+
+// podContainerFields are the fields of pod specs that list containers
+var podContainerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// digestPinner resolves image references to immutable digest references, through the image's registry, or the local
+// Docker daemon where the registry cannot be reached or has no such image. Resolved references are remembered, so that
+// every manifest deployed by a run pins an image to the same digest.
+type digestPinner struct {
+	local    build.Inspector
+	registry build.Inspector
+	// warnings receives the images whose digest in the daemon differs from the one in the registry
+	warnings io.Writer
+
+	mu     sync.Mutex
+	pinned map[string]string
+}
+
+// newDigestPinner returns a pinner using the registry, and the Docker daemon at DOCKER_HOST when there is one
+func newDigestPinner() *digestPinner {
+	pinner := &digestPinner{registry: registryImages, warnings: os.Stderr, pinned: map[string]string{}}
+	if docker, err := build.NewDockerBuilder(os.Getenv("DOCKER_HOST")); err == nil {
+		pinner.local = docker
+	}
+	return pinner
+}
+
+// pin returns the reference with the digest of the image it names, e.g. `app:v1@sha256:...` for `app:v1`
+func (p *digestPinner) pin(ctx context.Context, reference string) (string, error) {
+	if strings.Contains(reference, "@") {
+		return reference, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pinned, ok := p.pinned[reference]; ok {
+		return pinned, nil
+	}
+
+	// the registry is the source of truth for tags, which the daemon may hold an older image for
+	info, found, registryErr := p.registry.Inspect(ctx, reference)
+	digest := ""
+	if registryErr == nil && found {
+		digest = info.Digest
+	}
+	if p.local != nil {
+		// the daemon only knows the digests of images it pushed or pulled, and may not be running at all
+		if localInfo, found, err := p.local.Inspect(ctx, reference); err == nil && found && localInfo.Digest != "" {
+			if digest == "" {
+				digest = localInfo.Digest
+			} else if localInfo.Digest != digest && p.warnings != nil {
+				_, _ = fmt.Fprintf(p.warnings, "Warning: the docker daemon holds `%v` at %v, but the registry holds it at %v - pinning the registry's digest\n", reference, localInfo.Digest, digest)
+			}
+		}
+	}
+	if digest == "" {
+		if registryErr != nil {
+			return "", fmt.Errorf("pinning `%v`: %w", reference, registryErr)
+		}
+		return "", fmt.Errorf("pinning `%v`: no digest found in the docker daemon or the registry, push the image first", reference)
+	}
+	p.pinned[reference] = reference + "@" + digest
+	return p.pinned[reference], nil
+}
+
+// pinManifest rewrites the container images of the objects of a rendered manifest to digest references, returning the
+// rewritten manifest along with the references it pinned. Manifests that are already pinned are returned as they are.
+func (p *digestPinner) pinManifest(ctx context.Context, rendered []byte) ([]byte, map[string]string, error) {
+	objects, err := apply.Decode(rendered)
+	if err != nil {
+		return nil, nil, err
+	}
+	pinned := map[string]string{}
+	var pinErr error
+	var visit func(value interface{})
+	visit = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, field := range podContainerFields {
+				containers, _ := v[field].([]interface{})
+				for _, container := range containers {
+					fields, _ := container.(map[string]interface{})
+					image, _ := fields["image"].(string)
+					if image == "" || pinErr != nil {
+						continue
+					}
+					reference, err := p.pin(ctx, image)
+					if err != nil {
+						pinErr = err
+						continue
+					}
+					if reference != image {
+						fields["image"] = reference
+						pinned[image] = reference
+					}
+				}
+			}
+			for _, child := range v {
+				visit(child)
+			}
+		case []interface{}:
+			for _, item := range v {
+				visit(item)
+			}
+		}
+	}
+	for _, object := range objects {
+		visit(object.Object)
+	}
+	if pinErr != nil {
+		return nil, nil, pinErr
+	}
+	if len(pinned) == 0 {
+		return rendered, pinned, nil
+	}
+
+	var manifest bytes.Buffer
+	for i, object := range objects {
+		document, err := yaml.Marshal(object.Object)
+		if err != nil {
+			return nil, nil, err
+		}
+		if i > 0 {
+			manifest.WriteString("---\n")
+		}
+		manifest.Write(document)
+	}
+	return manifest.Bytes(), pinned, nil
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/stretchr/testify/assert"
+)
+
+// unreachableImages fails every lookup, like a registry that cannot be reached
+type unreachableImages struct{}
+
+func (unreachableImages) Inspect(ctx context.Context, reference string) (build.ImageInfo, bool, error) {
+	return build.ImageInfo{}, false, fmt.Errorf("connection refused")
+}
+
+const pinTestManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+data:
+  image: app:v1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: migrate:v1
+      containers:
+      - name: app
+        image: app:v1
+      - name: proxy
+        image: proxy@sha256:0c1f
+`
+
+func TestPinManifest(t *testing.T) {
+	pinner := &digestPinner{
+		local:    fakeImages{"app:v1": {ID: "sha256:app", Digest: "sha256:9a83"}, "migrate:v1": {ID: "sha256:migrate"}},
+		registry: fakeImages{"migrate:v1": {Digest: "sha256:4b1e"}},
+		pinned:   map[string]string{},
+	}
+	manifest, pinned, err := pinner.pinManifest(context.Background(), []byte(pinTestManifest))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"app:v1":     "app:v1@sha256:9a83",
+		"migrate:v1": "migrate:v1@sha256:4b1e",
+	}, pinned)
+	assert.Contains(t, string(manifest), "image: app:v1@sha256:9a83\n")
+	assert.Contains(t, string(manifest), "image: migrate:v1@sha256:4b1e\n")
+	assert.Contains(t, string(manifest), "image: proxy@sha256:0c1f\n")
+	// only container images are pinned
+	assert.Contains(t, string(manifest), "  image: app:v1\n")
+
+	unchanged := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: empty\n"
+	manifest, pinned, err = pinner.pinManifest(context.Background(), []byte(unchanged))
+	assert.NoError(t, err)
+	assert.Empty(t, pinned)
+	assert.Equal(t, unchanged, string(manifest))
+}
+
+func TestPin(t *testing.T) {
+	registry := fakeImages{"localhost:5000/app:v1": {Digest: "sha256:9a83"}}
+	pinner := &digestPinner{registry: registry, pinned: map[string]string{}}
+	reference, err := pinner.pin(context.Background(), "localhost:5000/app:v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:5000/app:v1@sha256:9a83", reference)
+
+	// the first digest resolved is kept for the rest of the run
+	registry["localhost:5000/app:v1"] = build.ImageInfo{Digest: "sha256:77d0"}
+	reference, err = pinner.pin(context.Background(), "localhost:5000/app:v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:5000/app:v1@sha256:9a83", reference)
+
+	_, err = pinner.pin(context.Background(), "app:v2")
+	assert.EqualError(t, err, "pinning `app:v2`: no digest found in the docker daemon or the registry, push the image first")
+
+	pinner = &digestPinner{local: unreachableImages{}, registry: unreachableImages{}, pinned: map[string]string{}}
+	_, err = pinner.pin(context.Background(), "app:v1")
+	assert.EqualError(t, err, "pinning `app:v1`: connection refused")
+
+	// the daemon is only used when the registry cannot be reached
+	pinner = &digestPinner{local: fakeImages{"app:v1": {Digest: "sha256:9a83"}}, registry: unreachableImages{}, pinned: map[string]string{}}
+	reference, err = pinner.pin(context.Background(), "app:v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "app:v1@sha256:9a83", reference)
+}
+
+func TestPinPrefersRegistry(t *testing.T) {
+	var warnings bytes.Buffer
+	pinner := &digestPinner{
+		local:    fakeImages{"localhost:5000/app:latest": {Digest: "sha256:9a83"}},
+		registry: fakeImages{"localhost:5000/app:latest": {Digest: "sha256:77d0"}},
+		warnings: &warnings,
+		pinned:   map[string]string{},
+	}
+	reference, err := pinner.pin(context.Background(), "localhost:5000/app:latest")
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:5000/app:latest@sha256:77d0", reference, "a stale tag in the daemon is not pinned")
+	assert.Equal(t, "Warning: the docker daemon holds `localhost:5000/app:latest` at sha256:9a83, but the registry holds it at sha256:77d0 - pinning the registry's digest\n", warnings.String())
+}
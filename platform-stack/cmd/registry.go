@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"strings"
+)
+
+// stackRegistry returns the registry server configured for the named environment, falling back to the stack's
+// default registry
+func stackRegistry(env string) string {
+	if server, ok := config.Registry.Environments[env]; ok {
+		return strings.TrimSuffix(server, "/")
+	}
+	return strings.TrimSuffix(config.Registry.Default, "/")
+}
+
+// imageReference returns the reference an image is tagged with in the named environment: `image:tag`, prefixed by the
+// environment's registry unless the image already names one
+func imageReference(image, tag, env string) string {
+	reference := fmt.Sprintf("%v:%v", image, tag)
+	registry := stackRegistry(env)
+	if registry == "" || build.NamesRegistry(image) {
+		return reference
+	}
+	return fmt.Sprintf("%v/%v", registry, reference)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestImageReference(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	config = latest.StackConfig{Registry: latest.RegistryDescription{
+		Default:      "localhost:5000/",
+		Environments: map[string]string{"staging": "myregistry.azurecr.io", "local": ""},
+	}}
+
+	tests := []struct {
+		name      string
+		image     string
+		env       string
+		reference string
+	}{
+		{"default registry", "app", "ci", "localhost:5000/app:v1"},
+		{"environment registry", "app", "staging", "myregistry.azurecr.io/app:v1"},
+		{"environment without registry", "app", "local", "app:v1"},
+		{"image naming a registry", "docker.io/team/app", "staging", "docker.io/team/app:v1"},
+		{"image naming a repository", "team/app", "staging", "myregistry.azurecr.io/team/app:v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.reference, imageReference(tt.image, "v1", tt.env))
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"io/ioutil"
+	"time"
+)
+
+// Results of the images of a build report
+const (
+	reportBuilt     = "built"
+	reportPushed    = "pushed"
+	reportSkipped   = "skipped"
+	reportFailed    = "failed"
+	reportCancelled = "cancelled"
+)
+
+// buildReport describes the images produced by `stack build`, for `stack up --images` to deploy
+type buildReport struct {
+	Environment string             `json:"environment"`
+	Generated   time.Time          `json:"generated"`
+	Images      []buildReportImage `json:"images"`
+}
+
+// buildReportImage describes the build of a single container's image
+type buildReportImage struct {
+	Component string `json:"component"`
+	Image     string `json:"image"`
+	// Reference is the full name the image was built as, including its registry and tag
+	Reference string `json:"reference"`
+	Tag       string `json:"tag"`
+	// Digest is the digest of the image manifest in its registry, when known
+	Digest  string `json:"digest,omitempty"`
+	ImageID string `json:"imageId,omitempty"`
+	// Platforms maps each platform of a multi-platform image to the digest of its manifest
+	Platforms       map[string]string `json:"platforms,omitempty"`
+	DurationSeconds float64           `json:"durationSeconds"`
+	Result          string            `json:"result"`
+	Error           string            `json:"error,omitempty"`
+	Environment     string            `json:"environment"`
+}
+
+// newBuildReport describes the outcomes of building images for an environment
+func newBuildReport(outcomes []buildOutcome, env string) buildReport {
+	report := buildReport{Environment: env, Generated: time.Now().UTC(), Images: []buildReportImage{}}
+	for _, outcome := range outcomes {
+		image := buildReportImage{
+			Component:       outcome.job.component,
+			Image:           outcome.job.container.Image,
+			Reference:       outcome.job.tag,
+			Tag:             imageTagOf(outcome.job.tag),
+			DurationSeconds: outcome.duration.Round(time.Millisecond).Seconds(),
+			Environment:     env,
+		}
+		switch {
+		case outcome.cancelled:
+			image.Result = reportCancelled
+		case outcome.err != nil:
+			image.Result, image.Error = reportFailed, outcome.err.Error()
+		case outcome.result.skipped:
+			image.Result = reportSkipped
+		case outcome.pushed:
+			image.Result = reportPushed
+		default:
+			image.Result = reportBuilt
+		}
+		if outcome.err == nil {
+			image.Digest, image.ImageID, image.Platforms = outcome.result.Digest, outcome.result.ImageID, outcome.result.Platforms
+		}
+		report.Images = append(report.Images, image)
+	}
+	return report
+}
+
+// writeBuildReport writes the build report of the outcomes to path, if one was requested
+func writeBuildReport(path string, outcomes []buildOutcome, env string) error {
+	if path == "" {
+		return nil
+	}
+	encoded, err := json.MarshalIndent(newBuildReport(outcomes, env), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(encoded, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing build report: %w", err)
+	}
+	return nil
+}
+
+// readBuildReport reads a build report written by `stack build --report`
+func readBuildReport(path string) (buildReport, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return buildReport{}, fmt.Errorf("reading build report: %w", err)
+	}
+	var report buildReport
+	if err := json.Unmarshal(content, &report); err != nil {
+		return buildReport{}, fmt.Errorf("reading build report `%v`: %w", path, err)
+	}
+	return report, nil
+}
+
+// reportImageValues returns template values naming the images of a build report, which override those of imageValues.
+// Images with a known digest are named by it as well as their tag, e.g. `localhost:5000/app:v1@sha256:...`, so that
+// exactly the reported image is deployed.
+func reportImageValues(report buildReport, env string) ([]string, error) {
+	if report.Environment != env {
+		return nil, fmt.Errorf("the build report was built for the `%v` environment, not `%v`", report.Environment, env)
+	}
+	var values []string
+	tags := map[string]bool{}
+	for _, image := range report.Images {
+		if image.Result == reportFailed || image.Result == reportCancelled {
+			return nil, fmt.Errorf("the build report records that image `%v` of component `%v` was not built", image.Image, image.Component)
+		}
+		repository, tag := build.SplitReference(image.Reference)
+		tags[tag] = true
+		name := imageVariableName(image.Image)
+		values = append(values, fmt.Sprintf("%v_IMAGE=%v", name, repository))
+		if image.Digest != "" {
+			values = append(values, fmt.Sprintf("%v_TAG=%v@%v", name, tag, image.Digest), fmt.Sprintf("%v_DIGEST=%v", name, image.Digest))
+		} else {
+			values = append(values, fmt.Sprintf("%v_TAG=%v", name, tag))
+		}
+	}
+	if len(tags) == 1 {
+		for tag := range tags {
+			values = append([]string{"IMAGE_TAG=" + tag}, values...)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack-report")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	outcomes := []buildOutcome{
+		{job: buildJob{component: "web", container: latest.ContainerDescription{Image: "app"}, tag: "localhost:5000/app:v1"}, duration: 1500 * time.Millisecond, result: builtImage{Result: build.Result{ImageID: "sha256:config", Digest: "sha256:9a83"}}, pushed: true},
+		{job: buildJob{component: "web", container: latest.ContainerDescription{Image: "docs"}, tag: "docs:v1"}, result: builtImage{Result: build.Result{ImageID: "sha256:docs"}, skipped: true}},
+		{job: buildJob{component: "api", container: latest.ContainerDescription{Image: "api"}, tag: "localhost:5000/api:v1"}, duration: time.Second, err: fmt.Errorf("exit code: 1")},
+		{job: buildJob{component: "api", container: latest.ContainerDescription{Image: "worker"}, tag: "localhost:5000/worker:v1"}, err: context.Canceled, cancelled: true},
+	}
+	path := filepath.Join(dir, "build.json")
+	assert.NoError(t, writeBuildReport(path, outcomes, "staging"))
+
+	report, err := readBuildReport(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "staging", report.Environment)
+	assert.Equal(t, []buildReportImage{
+		{Component: "web", Image: "app", Reference: "localhost:5000/app:v1", Tag: "v1", Digest: "sha256:9a83", ImageID: "sha256:config", DurationSeconds: 1.5, Result: "pushed", Environment: "staging"},
+		{Component: "web", Image: "docs", Reference: "docs:v1", Tag: "v1", ImageID: "sha256:docs", Result: "skipped", Environment: "staging"},
+		{Component: "api", Image: "api", Reference: "localhost:5000/api:v1", Tag: "v1", DurationSeconds: 1, Result: "failed", Error: "exit code: 1", Environment: "staging"},
+		{Component: "api", Image: "worker", Reference: "localhost:5000/worker:v1", Tag: "v1", Result: "cancelled", Error: "", Environment: "staging"},
+	}, report.Images)
+
+	_, err = readBuildReport(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestReportImageValues(t *testing.T) {
+	report := buildReport{
+		Environment: "staging",
+		Images: []buildReportImage{
+			{Component: "web", Image: "stack-app", Reference: "localhost:5000/stack-app:v1", Digest: "sha256:9a83", Result: "pushed"},
+			{Component: "web", Image: "docs", Reference: "docs:v1", Result: "built"},
+		},
+	}
+	values, err := reportImageValues(report, "staging")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"IMAGE_TAG=v1",
+		"STACK_APP_IMAGE=localhost:5000/stack-app",
+		"STACK_APP_TAG=v1@sha256:9a83",
+		"STACK_APP_DIGEST=sha256:9a83",
+		"DOCS_IMAGE=docs",
+		"DOCS_TAG=v1",
+	}, values)
+
+	_, err = reportImageValues(report, "production")
+	assert.EqualError(t, err, "the build report was built for the `staging` environment, not `production`")
+
+	report.Images[1].Result = "failed"
+	_, err = reportImageValues(report, "staging")
+	assert.EqualError(t, err, "the build report records that image `docs` of component `web` was not built")
+}
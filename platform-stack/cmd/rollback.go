@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/altiscope/platform-stack/pkg/history"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <component> [revision]",
+	Short: "Re-applies an earlier revision of a component.",
+	Long: `Re-applies an earlier revision of a component.
+
+The manifests recorded with the revision are applied as they were rendered at the time, and recorded as a new revision.
+If no revision is provided, the component is rolled back to the revision before the one currently deployed.
+See ` + "`stack history`" + ` for the available revisions.`,
+	Args: cobra.RangeArgs(1, 2),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return configPreRunnerE(cmd, args)
+	},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return initK8s("")
+	},
+	RunE: rollback,
+}
+
+func rollback(cmd *cobra.Command, args []string) (err error) {
+
+	currentEnv, err := getEnvironment()
+	if err != nil {
+		return err
+	}
+	if currentEnv == (latest.EnvironmentDescription{}) {
+		return fmt.Errorf("no active environment detected")
+	}
+
+	ctx := context.Background()
+	component := args[0]
+	revisions := stackHistoryStore()
+	existing, err := revisions.List(ctx, config.Stack.Name, currentEnv.Name, component)
+	if err != nil {
+		return err
+	}
+
+	var target *history.Revision
+	if len(args) > 1 {
+		number, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid revision `%v`", args[1])
+		}
+		target, err = revisions.Get(ctx, config.Stack.Name, currentEnv.Name, component, number)
+		if err != nil {
+			return err
+		}
+	} else {
+		target, err = previousRevision(existing)
+		if err != nil {
+			return err
+		}
+	}
+
+	if currentEnv.Activation.ConfirmWithUser {
+		confirmWithUser(fmt.Sprintf("You are about to roll back `%v` to revision %v in environment `%v`", component, target.Number, currentEnv.Name))
+	}
+
+	inv, err := loadComponentInventory(ctx, stackInventoryStore(), currentEnv)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rolling back %v to revision %v\n", component, target.Number)
+	applied, err := applyRevision(target, os.Stdout)
+	if recordErr := recordComponent(ctx, inv, stackApplier(), component, applied, false, os.Stdout); recordErr != nil && err == nil {
+		err = recordErr
+	}
+
+	revision := newRevision(component, currentEnv, target.Manifests, applied, err)
+	revision.GitCommit = target.GitCommit
+	revision.PinnedImages = target.PinnedImages
+	if err == nil {
+		revision.Description = fmt.Sprintf("rollback to %v", target.Number)
+	}
+	if recordErr := recordRevision(ctx, revisions, revision); recordErr != nil && err == nil {
+		err = recordErr
+	}
+	return err
+}
+
+// previousRevision returns the latest revision that did not fail before the deployed one, which is the most recent
+// revision when none is marked deployed
+func previousRevision(revisions []*history.Revision) (*history.Revision, error) {
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("no revisions found")
+	}
+	deployed := len(revisions) - 1
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if revisions[i].Status == history.StatusDeployed {
+			deployed = i
+			break
+		}
+	}
+	for i := deployed - 1; i >= 0; i-- {
+		if revisions[i].Status != history.StatusFailed {
+			return revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no earlier revision of `%v` to roll back to", revisions[0].Component)
+}
+
+// applyRevision applies the manifests recorded with a revision, returning the objects that applied successfully
+func applyRevision(revision *history.Revision, out io.Writer) (applied []*unstructured.Unstructured, err error) {
+	for _, manifest := range revision.Manifests {
+		objects, err := applyManifest(manifest.Path, []byte(manifest.Content), out)
+		applied = append(applied, objects...)
+		if err != nil {
+			return applied, err
+		}
+	}
+	return applied, nil
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/altiscope/platform-stack/pkg/history"
+	"github.com/stretchr/testify/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestRollbackIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		fixture string
+	}{
+		{"rollback help", []string{"help", "rollback"}, "stack-rollback-help.golden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(path.Join(".", "stack"), tt.args...)
+			result, _ := cmd.CombinedOutput()
+			golden.AssertBytes(t, result, tt.fixture)
+		})
+	}
+}
+
+func TestPreviousRevision(t *testing.T) {
+	revisions := []*history.Revision{
+		{Component: "app", Number: 1, Status: history.StatusSuperseded},
+		{Component: "app", Number: 2, Status: history.StatusFailed},
+		{Component: "app", Number: 3, Status: history.StatusDeployed},
+	}
+	previous, err := previousRevision(revisions)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, previous.Number)
+
+	previous, err = previousRevision([]*history.Revision{
+		{Component: "app", Number: 1, Status: history.StatusSuperseded},
+		{Component: "app", Number: 2, Status: history.StatusDeployed},
+		{Component: "app", Number: 3, Status: history.StatusFailed},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, previous.Number, "a failed revision after the deployed one is not rolled back to the deployed one")
+
+	_, err = previousRevision(revisions[:1])
+	assert.EqualError(t, err, "no earlier revision of `app` to roll back to")
+
+	_, err = previousRevision(nil)
+	assert.EqualError(t, err, "no revisions found")
+}
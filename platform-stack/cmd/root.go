@@ -7,7 +7,11 @@ import (
 	"github.com/altiscope/platform-stack/pkg/schema/latest"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
 	"path/filepath"
 
@@ -26,6 +30,8 @@ var stackConfigurationFile string
 
 var (
 	clientset        *kubernetes.Clientset
+	dynamicClient    dynamic.Interface
+	restMapper       meta.RESTMapper
 	currentNamespace string
 )
 
@@ -174,7 +180,7 @@ func containsString(slice []string, element string) bool {
 	return false
 }
 
-// initK8s initializes a global clientset object using the system KUBECONFIG, with default merging rules
+// initK8s initializes the global clientset, dynamic client and REST mapper using the system KUBECONFIG, with default merging rules
 func initK8s(kubectx string) (err error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	configOverrides := &clientcmd.ConfigOverrides{}
@@ -194,6 +200,11 @@ func initK8s(kubectx string) (err error) {
 	if err != nil {
 		return err
 	}
+	dynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	restMapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery()))
 	for {
 		if clientset != nil {
 			break
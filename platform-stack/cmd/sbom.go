@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/altiscope/platform-stack/pkg/sbom"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// buildReportsDirectory is the directory of the stack that build reports are written to
+const buildReportsDirectory = "build-reports"
+
+// sbomSummaryFile aggregates the SBOMs written to the build reports directory
+const sbomSummaryFile = "sbom-summary.json"
+
+// sbomReport summarizes the SBOM written for an image
+type sbomReport struct {
+	Component string `json:"component"`
+	Image     string `json:"image"`
+	Tag       string `json:"tag"`
+	ImageID   string `json:"imageId"`
+	Format    string `json:"format"`
+	// Document is the path of the SBOM, relative to the build reports directory
+	Document     string         `json:"document"`
+	Distro       string         `json:"distro,omitempty"`
+	Packages     int            `json:"packages"`
+	PackageTypes map[string]int `json:"packageTypes"`
+	Generated    time.Time      `json:"generated"`
+}
+
+type sbomSummary struct {
+	Images []sbomReport `json:"images"`
+}
+
+// sbomFormat returns the SBOM format requested with --sbom, or "" when no SBOMs were requested
+func sbomFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("sbom")
+	if format == "" || containsString(sbom.Formats, format) {
+		return format, nil
+	}
+	return "", fmt.Errorf("--sbom must be one of %v, got `%v`", strings.Join(sbom.Formats, ", "), format)
+}
+
+// sbomExporter returns the builder's image store when SBOMs were requested, as SBOMs are read from built images
+func sbomExporter(format string, builder build.Builder) (build.Exporter, error) {
+	if format == "" {
+		return nil, nil
+	}
+	exporter, ok := builder.(build.Exporter)
+	if !ok {
+		return nil, fmt.Errorf("--sbom reads built images from the docker engine, so is not available with BUILDKIT_HOST")
+	}
+	return exporter, nil
+}
+
+// writeSBOM scans the layers of a built image, writing its SBOM into the build reports directory of the stack. Images
+// found up to date in a registry may not have been pulled, in which case no SBOM is written.
+func writeSBOM(ctx context.Context, exporter build.Exporter, format, component, image, tag string, built builtImage, out io.Writer) (*sbomReport, error) {
+	if inspector, ok := exporter.(build.Inspector); ok && built.skipped {
+		if _, found, err := inspector.Inspect(ctx, tag); err == nil && !found {
+			_, _ = fmt.Fprintf(out, "[%v] No SBOM written: %v is up to date in the registry, but not in the docker engine\n", image, tag)
+			return nil, nil
+		}
+	}
+	archive, err := exporter.Export(ctx, tag)
+	if err != nil {
+		return nil, fmt.Errorf("generating SBOM of `%v`: %w", tag, err)
+	}
+	defer archive.Close()
+	inventory, err := sbom.Scan(archive)
+	if err != nil {
+		return nil, fmt.Errorf("generating SBOM of `%v`: %w", tag, err)
+	}
+
+	generated := time.Now().UTC()
+	document, err := sbom.Encode(format, sbom.Image{Name: tag, ID: built.ImageID}, inventory, sbom.Metadata{Tool: "stack", Version: Version, Created: generated})
+	if err != nil {
+		return nil, err
+	}
+	relative := filepath.Join(component, image+sbom.Extension(format))
+	path := filepath.Join(viper.GetString("stack_directory"), buildReportsDirectory, relative)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, append(document, '\n'), 0644); err != nil {
+		return nil, err
+	}
+
+	report := &sbomReport{
+		Component:    component,
+		Image:        image,
+		Tag:          tag,
+		ImageID:      built.ImageID,
+		Format:       format,
+		Document:     filepath.ToSlash(relative),
+		Distro:       inventory.Distro.PrettyName,
+		Packages:     len(inventory.Packages),
+		PackageTypes: map[string]int{},
+		Generated:    generated,
+	}
+	for _, pkg := range inventory.Packages {
+		report.PackageTypes[pkg.Type]++
+	}
+	_, _ = fmt.Fprintf(out, "[%v] Wrote SBOM %v (%v packages)\n", image, filepath.Join(buildReportsDirectory, relative), report.Packages)
+	return report, nil
+}
+
+// writeSBOMSummary records the given SBOMs in the summary of the build reports directory, keeping those of images
+// that were not built this time
+func writeSBOMSummary(reports []sbomReport) error {
+	if len(reports) == 0 {
+		return nil
+	}
+	path := filepath.Join(viper.GetString("stack_directory"), buildReportsDirectory, sbomSummaryFile)
+	var summary sbomSummary
+	if existing, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(existing, &summary); err != nil {
+			return fmt.Errorf("reading `%v`: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	updated := map[string]bool{}
+	for _, report := range reports {
+		updated[report.Component+"/"+report.Image] = true
+	}
+	images := append([]sbomReport{}, reports...)
+	for _, report := range summary.Images {
+		if !updated[report.Component+"/"+report.Image] {
+			images = append(images, report)
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].Component != images[j].Component {
+			return images[i].Component < images[j].Component
+		}
+		return images[i].Image < images[j].Image
+	})
+
+	encoded, err := json.MarshalIndent(sbomSummary{Images: images}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(encoded, '\n'), 0644)
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeExporter exports the archives it holds, and knows the images it holds
+type fakeExporter struct {
+	fakeImages
+	archives map[string][]byte
+}
+
+func (f fakeExporter) Export(ctx context.Context, reference string) (io.ReadCloser, error) {
+	archive, ok := f.archives[reference]
+	if !ok {
+		return nil, fmt.Errorf("exporting `%v` failed: reference does not exist", reference)
+	}
+	return ioutil.NopCloser(bytes.NewReader(archive)), nil
+}
+
+// imageArchive returns a `docker save` archive of an image with a single layer holding the given files
+func imageArchive(t *testing.T, files map[string]string) []byte {
+	archive := func(files map[string]string) []byte {
+		var content bytes.Buffer
+		writer := tar.NewWriter(&content)
+		for _, name := range sortedMapKeys(files) {
+			assert.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}))
+			_, err := writer.Write([]byte(files[name]))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, writer.Close())
+		return content.Bytes()
+	}
+	return archive(map[string]string{
+		"manifest.json":   `[{"Config":"config.json","Layers":["layer/layer.tar"]}]`,
+		"layer/layer.tar": string(archive(files)),
+	})
+}
+
+func TestWriteSBOM(t *testing.T) {
+	dir := buildTestStack(t)
+	exporter := fakeExporter{
+		fakeImages: fakeImages{"app:v1": {ID: "sha256:app"}},
+		archives: map[string][]byte{
+			"app:v1": imageArchive(t, map[string]string{
+				"etc/os-release":                        "ID=alpine\nVERSION_ID=3.16.2\nPRETTY_NAME=\"Alpine Linux v3.16\"\n",
+				"lib/apk/db/installed":                  "P:musl\nV:1.2.3-r0\nL:MIT\n\nP:busybox\nV:1.35.0-r17\nL:GPL-2.0-only\n",
+				"app/node_modules/express/package.json": `{"name":"express","version":"4.18.1","license":"MIT"}`,
+			}),
+		},
+	}
+
+	var out bytes.Buffer
+	report, err := writeSBOM(context.Background(), exporter, "cyclonedx", "web", "app", "app:v1", builtImage{Result: build.Result{ImageID: "sha256:app"}}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "web/app.cdx.json", report.Document)
+	assert.Equal(t, "Alpine Linux v3.16", report.Distro)
+	assert.Equal(t, 3, report.Packages)
+	assert.Equal(t, map[string]int{"apk": 2, "npm": 1}, report.PackageTypes)
+	assert.Equal(t, "[app] Wrote SBOM build-reports/web/app.cdx.json (3 packages)\n", out.String())
+
+	var document struct {
+		BOMFormat  string `json:"bomFormat"`
+		Components []struct {
+			PURL string `json:"purl"`
+		} `json:"components"`
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "build-reports", "web", "app.cdx.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(content, &document))
+	assert.Equal(t, "CycloneDX", document.BOMFormat)
+	assert.Len(t, document.Components, 4)
+
+	out.Reset()
+	report, err = writeSBOM(context.Background(), exporter, "spdx", "web", "api", "api:v1", builtImage{skipped: true}, &out)
+	assert.NoError(t, err)
+	assert.Nil(t, report)
+	assert.Equal(t, "[api] No SBOM written: api:v1 is up to date in the registry, but not in the docker engine\n", out.String())
+
+	_, err = writeSBOM(context.Background(), exporter, "spdx", "web", "api", "api:v1", builtImage{}, &out)
+	assert.EqualError(t, err, "generating SBOM of `api:v1`: exporting `api:v1` failed: reference does not exist")
+}
+
+func TestWriteSBOMSummary(t *testing.T) {
+	dir := buildTestStack(t)
+	assert.NoError(t, writeSBOMSummary([]sbomReport{
+		{Component: "web", Image: "app", ImageID: "sha256:old", Packages: 1},
+		{Component: "api", Image: "api", ImageID: "sha256:api", Packages: 2},
+	}))
+	assert.NoError(t, writeSBOMSummary([]sbomReport{{Component: "web", Image: "app", ImageID: "sha256:new", Packages: 3}}))
+
+	var summary sbomSummary
+	content, err := ioutil.ReadFile(filepath.Join(dir, "build-reports", "sbom-summary.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(content, &summary))
+	assert.Len(t, summary.Images, 2)
+	assert.Equal(t, "api", summary.Images[0].Image)
+	assert.Equal(t, "sha256:new", summary.Images[1].ImageID)
+}
+
+func TestSBOMFormat(t *testing.T) {
+	cmd := buildTestCommand(t, "--sbom")
+	format, err := sbomFormat(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, "spdx", format)
+
+	_, err = sbomFormat(buildTestCommand(t, "--sbom=swid"))
+	assert.EqualError(t, err, "--sbom must be one of spdx, cyclonedx, got `swid`")
+
+	_, err = sbomExporter("spdx", &build.BuildKitBuilder{})
+	assert.EqualError(t, err, "--sbom reads built images from the docker engine, so is not available with BUILDKIT_HOST")
+}
@@ -1,31 +1,35 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"github.com/altiscope/platform-stack/pkg/build"
+	"github.com/altiscope/platform-stack/pkg/credentials"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v12 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
-var secretTypesSecretNamesMap = map[string]string{
-	"registry": "acr-service-principal",
-}
-
-const kubectlCreateRegistrySecretTemplate = `kubectl create secret docker-registry {{ .SecretName }} --docker-server=https://{{ .ContainerRegistry }}.azurecr.io --docker-username={{ .ServicePrincipleID }} --docker-password={{ .ServicePrinciplePassword }} --docker-email=noreply@airbusutm.com/
-											 kubectl label secret acr-service-principal stack={{ .StackName }}`
-
-const kubectlGetSecretTemplate = `kubectl get secrets -l stack={{ .StackName}}`
+// legacyRegistry names the Azure Container Registry of stacks that configure no registry, and give none with --registry
+const legacyRegistry = "airbusutm"
 
-type KubectlCreateRegistrySecretsRequest struct {
-	SecretName               string
-	ContainerRegistry        string
-	ServicePrincipleID       string
-	ServicePrinciplePassword string
-	StackName                string
-}
+// defaultRegistrySecretName names the registry secret of stacks that configure none in their secrets section
+const defaultRegistrySecretName = "acr-service-principal"
 
-type KubectlListRegistrySecretsRequest struct {
-	StackName string
+// registrySecretSource is a configured registry secret along with the provider of its credentials
+type registrySecretSource struct {
+	latest.RegistrySecretDescription
+	provider credentials.Provider
 }
 
 // secretsCmd represents the secrets command
@@ -37,19 +41,23 @@ var secretsCmd = &cobra.Command{
 Makes securely distributed credentials available to the stack.
 
 Available SecretTypes:
-- registry: specify the registry type for creating the 'acr-service-principal' for manifest imagePullSecrets
-"SERVICE_PRINCIPLE_ID" and "SERVICE_PRINCIPLE_PASSWORD" variables to be set in the host environment.
+- registry: creates the registry secrets of the stack config's secrets section for manifest imagePullSecrets, each
+from one of the usernamePassword, jsonKey (GCR and Artifact Registry), ecr or dockerConfig credential providers.
+Stacks that configure none get the 'acr-service-principal' secret, which requires the "SERVICE_PRINCIPLE_ID" and
+"SERVICE_PRINCIPLE_PASSWORD" variables to be set in the host environment.
+Secrets are created for the registry configured for the current environment, unless they name their server or one is
+given with --registry, as a server such as myregistry.azurecr.io or the name of an Azure Container Registry such as
+myregistry. Stacks that configure no registry default to the 'airbusutm' Azure Container Registry.
+
+Secrets are created, or updated in place when they already exist, in the current namespace and labelled with the stack's
+name. If no secretType is given, the secrets of the stack are listed with their type and keys, but not their values.
 `,
 	Args: cobra.MaximumNArgs(1),
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		return configPreRunnerE(cmd, args)
 	},
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		err := viper.BindPFlag("registry", cmd.Flags().Lookup("registry"))
-		if err != nil {
-			return err
-		}
-		return nil
+		return initK8s("")
 	},
 	RunE: createSecret,
 }
@@ -61,68 +69,277 @@ func createSecret(cmd *cobra.Command, args []string) error {
 		case "registry":
 			return createRegistrySecret(cmd, args)
 		default:
-			return fmt.Errorf("error")
+			return fmt.Errorf("unknown secret type `%v`, expected one of: registry", secretType)
 		}
 	} else {
 		return listRegistrySecret(cmd, args)
 	}
 }
 
-func labelSecret(cmd *cobra.Command, args []string) error {
+func createRegistrySecret(cmd *cobra.Command, args []string) error {
+	env, err := getEnvironment()
+	if err != nil {
+		return err
+	}
+	sources, err := registrySecretSources(env.Name, os.Environ())
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for _, source := range sources {
+		server := source.Server
+		if server == "" {
+			server, err = secretRegistry(cmd)
+			if err != nil {
+				return err
+			}
+		}
+		registryCredentials, err := source.provider.Credentials(ctx, server)
+		if err != nil {
+			return fmt.Errorf("registry secret `%v`: %w", source.Name, err)
+		}
+		secret, err := registrySecret(source.Name, stackSecretsNamespace(), server, registryCredentials)
+		if err != nil {
+			return err
+		}
+		if err := applySecret(ctx, clientset.CoreV1(), secret, os.Stdout); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func createRegistrySecret(cmd *cobra.Command, args []string) error {
-	secretName, _ := secretTypesSecretNamesMap[args[0]]
+// registrySecretSources returns the registry secrets configured for an environment with the providers of their
+// credentials, whose values are templated from environ. Stacks that configure none get the `acr-service-principal`
+// secret, holding the service principal given by SERVICE_PRINCIPLE_ID and SERVICE_PRINCIPLE_PASSWORD.
+func registrySecretSources(env string, environ []string) ([]registrySecretSource, error) {
+	if len(config.Secrets.Registries) == 0 {
+		spid := viper.GetString("SERVICE_PRINCIPLE_ID")
+		sppwd := viper.GetString("SERVICE_PRINCIPLE_PASSWORD")
+		if spid == "" || sppwd == "" {
+			return nil, fmt.Errorf("SERVICE_PRINCIPLE_ID or SERVICE_PRINCIPLE_PASSWORD must be set in order to create a Registry secret")
+		}
+		return []registrySecretSource{{
+			RegistrySecretDescription: latest.RegistrySecretDescription{Name: defaultRegistrySecretName},
+			provider:                  credentials.UsernamePassword{Username: spid, Password: sppwd},
+		}}, nil
+	}
 
-	spid := viper.GetString("SERVICE_PRINCIPLE_ID")
-	sppwd := viper.GetString("SERVICE_PRINCIPLE_PASSWORD")
+	var sources []registrySecretSource
+	for _, description := range config.Secrets.Registries {
+		if !envsApply(description.Environments, env) {
+			continue
+		}
+		provider, err := registryProvider(description, environ)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, registrySecretSource{RegistrySecretDescription: description, provider: provider})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no registry secrets configured for environment `%v`", env)
+	}
+	return sources, nil
+}
 
-	if spid == "" || sppwd == "" {
-		return fmt.Errorf("SERVICE_PRINCIPLE_ID or SERVICE_PRINCIPLE_PASSWORD must be set in order to create a Registry secret")
+// registryProvider returns the credential provider of a registry secret, templating its values from environ
+func registryProvider(description latest.RegistrySecretDescription, environ []string) (credentials.Provider, error) {
+	if description.Name == "" {
+		return nil, fmt.Errorf("registry secrets must have a name")
+	}
+	var (
+		providers []credentials.Provider
+		err       error
+	)
+	template := func(field, value string) string {
+		if err != nil || value == "" {
+			return value
+		}
+		value, err = executeEnvTemplate(fmt.Sprintf("%v of registry secret `%v`", field, description.Name), value, environ)
+		return value
 	}
 
-	createRegistrySecretCmd, err := GenerateCommand(kubectlCreateRegistrySecretTemplate, KubectlCreateRegistrySecretsRequest{
-		secretName,
-		viper.GetString("registry"),
-		spid,
-		sppwd,
-		config.Stack.Name,
-	})
+	if p := description.UsernamePassword; p != nil {
+		providers = append(providers, credentials.UsernamePassword{
+			Username: template("username", p.Username),
+			Password: template("password", p.Password),
+			Email:    template("email", p.Email),
+		})
+	}
+	if p := description.JSONKey; p != nil {
+		key := []byte(template("key", p.Key))
+		if keyFile := template("keyFile", p.KeyFile); keyFile != "" && err == nil {
+			stackDirectory, _ := filepath.Abs(viper.GetString("stack_directory"))
+			if !filepath.IsAbs(keyFile) {
+				keyFile = filepath.Join(stackDirectory, keyFile)
+			}
+			if key, err = ioutil.ReadFile(keyFile); err != nil {
+				err = fmt.Errorf("reading the key of registry secret `%v`: %w", description.Name, err)
+			}
+		}
+		providers = append(providers, credentials.JSONKey{Key: key})
+	}
+	if p := description.ECR; p != nil {
+		providers = append(providers, credentials.ECR{Region: template("region", p.Region), Profile: template("profile", p.Profile)})
+	}
+	if p := description.DockerConfig; p != nil {
+		providers = append(providers, credentials.DockerConfig{Path: template("path", p.Path)})
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
+	if len(providers) != 1 {
+		return nil, fmt.Errorf("registry secret `%v` must set exactly one of usernamePassword, jsonKey, ecr or dockerConfig", description.Name)
+	}
+	return providers[0], nil
+}
 
-	// todo: remove env append if able
-	createRegistrySecretCmd.Stdout = os.Stdout
-	createRegistrySecretCmd.Stderr = os.Stderr
-	if err := createRegistrySecretCmd.Run(); err != nil {
-		return err
+// registrySecretNames returns the names of the registry secrets configured for an environment
+func registrySecretNames(env string) []string {
+	if len(config.Secrets.Registries) == 0 {
+		return []string{defaultRegistrySecretName}
+	}
+	var names []string
+	for _, description := range config.Secrets.Registries {
+		if envsApply(description.Environments, env) {
+			names = append(names, description.Name)
+		}
 	}
+	return names
+}
 
-	return nil
+// secretRegistry returns the registry server given by the registry flag, or else the one configured for the current environment
+func secretRegistry(cmd *cobra.Command) (string, error) {
+	registry, _ := cmd.Flags().GetString("registry")
+	if registry == "" {
+		env, err := getEnvironment()
+		if err != nil {
+			return "", err
+		}
+		registry = stackRegistry(env.Name)
+	}
+	if registry == "" {
+		registry = legacyRegistry
+	}
+	return registryServer(registry), nil
 }
 
-func listRegistrySecret(cmd *cobra.Command, args []string) error {
+// registryServer returns the server of a registry given by its server, such as `myregistry.azurecr.io`, or by the name
+// of an Azure Container Registry, such as `myregistry`, as --registry took it before registries were configurable
+func registryServer(registry string) string {
+	if build.NamesRegistry(registry + "/") {
+		return registry
+	}
+	return fmt.Sprintf("https://%v.azurecr.io", registry)
+}
 
-	getSecretsCmd, err := GenerateCommand(kubectlGetSecretTemplate, KubectlListRegistrySecretsRequest{
-		config.Stack.Name,
-	})
+func listRegistrySecret(cmd *cobra.Command, args []string) error {
+	secrets, err := listStackSecrets(context.Background(), clientset.CoreV1(), stackSecretsNamespace())
 	if err != nil {
 		return err
 	}
+	if len(secrets) == 0 {
+		fmt.Printf("No secrets found for stack `%v`\n", config.Stack.Name)
+		return nil
+	}
+	printSecrets(secrets, os.Stdout)
+	return nil
+}
 
-	// todo: remove env append if able
-	getSecretsCmd.Stdout = os.Stdout
-	getSecretsCmd.Stderr = os.Stderr
-	if err := getSecretsCmd.Run(); err != nil {
-		return err
+// stackSecretsNamespace returns the namespace the stack's secrets are kept in, which is the current namespace
+func stackSecretsNamespace() string {
+	if currentNamespace == "" {
+		return "default"
 	}
+	return currentNamespace
+}
 
+// stackSecretLabels returns the labels identifying the secrets of the stack
+func stackSecretLabels() map[string]string {
+	return map[string]string{"stack": config.Stack.Name}
+}
+
+// registrySecret returns a docker-registry secret holding the credentials of a registry, like those created by
+// `kubectl create secret docker-registry`
+func registrySecret(name, namespace, server string, registryCredentials credentials.Credentials) (*v1.Secret, error) {
+	dockerConfig, err := credentials.DockerConfigJSON(server, registryCredentials)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: stackSecretLabels()},
+		Type:       v1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{v1.DockerConfigJsonKey: dockerConfig},
+	}, nil
+}
+
+// applySecret creates a secret, or replaces the data and adds the labels of the existing secret of the same name, so
+// that it can be applied any number of times
+func applySecret(ctx context.Context, api v12.CoreV1Interface, secret *v1.Secret, out io.Writer) error {
+	secrets := api.Secrets(secret.Namespace)
+	existing, err := secrets.Get(ctx, secret.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("creating secret `%v`: %w", secret.Name, err)
+		}
+		_, _ = fmt.Fprintf(out, "Created secret `%v`\n", secret.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading secret `%v`: %w", secret.Name, err)
+	}
+	if existing.Type != secret.Type {
+		return fmt.Errorf("secret `%v` already exists with type `%v` - delete it to replace it with a `%v` secret", secret.Name, existing.Type, secret.Type)
+	}
+
+	if existing.Labels == nil {
+		existing.Labels = map[string]string{}
+	}
+	for key, value := range secret.Labels {
+		existing.Labels[key] = value
+	}
+	existing.Data = secret.Data
+	if _, err := secrets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("updating secret `%v`: %w", secret.Name, err)
+	}
+	_, _ = fmt.Fprintf(out, "Updated secret `%v`\n", secret.Name)
 	return nil
 }
 
+// listStackSecrets returns the secrets labelled as belonging to the stack, sorted by name
+func listStackSecrets(ctx context.Context, api v12.CoreV1Interface, namespace string) ([]v1.Secret, error) {
+	list, err := api.Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: fmt.Sprintf("stack=%v", config.Stack.Name)})
+	if err != nil {
+		return nil, fmt.Errorf("listing secrets: %w", err)
+	}
+	secrets := list.Items
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+	return secrets, nil
+}
+
+// printSecrets writes a row per secret, naming its keys but never showing their values
+func printSecrets(secrets []v1.Secret, out io.Writer) {
+	columnsTemplate := "%-32v%-36v%-40v%v\n"
+	_, _ = fmt.Fprintf(out, columnsTemplate, "NAME", "TYPE", "KEYS", "AGE")
+	for _, secret := range secrets {
+		keys := make([]string, 0, len(secret.Data))
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		_, _ = fmt.Fprintf(out, columnsTemplate,
+			secret.Name,
+			secret.Type,
+			valueOrNone(strings.Join(keys, ",")),
+			translateTimestampSince(secret.CreationTimestamp),
+		)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(secretsCmd)
-	secretsCmd.Flags().StringP("registry", "c", "airbusutm", "Name of registry referenced by secret")
+	secretsCmd.Flags().StringP("registry", "c", "", "Server of the registry referenced by secret, e.g. myregistry.azurecr.io, or the name of an Azure Container Registry, e.g. myregistry. Defaults to the registry configured for the current environment, or else airbusutm")
 }
@@ -1,60 +1,79 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/cobra"
+	"io"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v12 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"os"
 )
 
-const kubectlDeleteSecretTemplate = `kubectl delete secrets -l stack={{ .StackName}}`
-
-type KubectlDeleteSecretsRequest struct {
-	SecretName string
-	StackName  string
-}
-
 // environmentListCmd represents the environmentList command
 var secretsDeleteCmd = &cobra.Command{
 	Use:   "delete [secretType]",
 	Short: "Delete the named stock secret.",
-	Long:  `Delete the named stock secret.`,
-	Args:  cobra.MaximumNArgs(1),
-	RunE:  deleteSecret,
+	Long: `Delete the named stock secret.
+
+If no secretType is given, every secret labelled with the stack's name is deleted, after confirmation.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: deleteSecret,
 }
 
 func deleteSecret(cmd *cobra.Command, args []string) error {
-	request := KubectlDeleteSecretsRequest{
-		"",
-		config.Stack.Name,
-	}
-
+	var secretNames []string
 	if len(args) > 0 {
-		fmt.Println(args[0])
-		secretType, ok := secretTypesSecretNamesMap[args[0]]
-		if ok {
-			request.SecretName = secretType
-		} else {
+		if args[0] != "registry" {
 			return fmt.Errorf("invalid secret type specified")
 		}
-
+		env, err := getEnvironment()
+		if err != nil {
+			return err
+		}
+		secretNames = registrySecretNames(env.Name)
+		if len(secretNames) == 0 {
+			return fmt.Errorf("no registry secrets configured for environment `%v`", env.Name)
+		}
 	} else {
 		if !confirmWithUser("you are about to delete all secrets for the stack") {
 			return nil
 		}
 	}
 
-	deleteSecretsCmd, err := GenerateCommand(kubectlDeleteSecretTemplate, request)
-	if err != nil {
+	if err := initK8s(""); err != nil {
 		return err
 	}
+	return deleteStackSecrets(context.Background(), clientset.CoreV1(), stackSecretsNamespace(), secretNames, os.Stdout)
+}
 
-	// todo: remove env append if able
-	deleteSecretsCmd.Stdout = os.Stdout
-	deleteSecretsCmd.Stderr = os.Stderr
-	if err := deleteSecretsCmd.Run(); err != nil {
-		return err
+// deleteStackSecrets deletes the named secrets of the stack, or all of the stack's secrets if no names are given
+func deleteStackSecrets(ctx context.Context, api v12.CoreV1Interface, namespace string, names []string, out io.Writer) error {
+	if len(names) == 0 {
+		secrets, err := listStackSecrets(ctx, api, namespace)
+		if err != nil {
+			return err
+		}
+		for _, secret := range secrets {
+			names = append(names, secret.Name)
+		}
+	}
+	if len(names) == 0 {
+		_, _ = fmt.Fprintf(out, "No secrets found for stack `%v`\n", config.Stack.Name)
+		return nil
 	}
 
+	for _, name := range names {
+		err := api.Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("secret `%v` not found in namespace `%v`", name, namespace)
+		}
+		if err != nil {
+			return fmt.Errorf("deleting secret `%v`: %w", name, err)
+		}
+		_, _ = fmt.Fprintf(out, "Deleted secret `%v`\n", name)
+	}
 	return nil
 }
 
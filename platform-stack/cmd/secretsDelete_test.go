@@ -1,13 +1,43 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/stretchr/testify/assert"
 	"gotest.tools/v3/golden"
 	"gotest.tools/v3/icmd"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 	"os/exec"
 	"path"
 	"testing"
 )
 
+func TestDeleteStackSecrets(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	config = latest.StackConfig{Stack: latest.StackDescription{Name: "testapp"}}
+
+	secret := func(name, stack string) *v1.Secret {
+		return &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "testns", Labels: map[string]string{"stack": stack}}}
+	}
+	api := fake.NewSimpleClientset(secret("acr-service-principal", "testapp"), secret("app-env", "testapp"), secret("other", "otherapp")).CoreV1()
+
+	var out bytes.Buffer
+	assert.NoError(t, deleteStackSecrets(context.Background(), api, "testns", []string{"acr-service-principal"}, &out))
+	err := deleteStackSecrets(context.Background(), api, "testns", []string{"acr-service-principal"}, &out)
+	assert.EqualError(t, err, "secret `acr-service-principal` not found in namespace `testns`")
+
+	assert.NoError(t, deleteStackSecrets(context.Background(), api, "testns", nil, &out))
+	assert.NoError(t, deleteStackSecrets(context.Background(), api, "testns", nil, &out))
+	assert.Equal(t, "Deleted secret `acr-service-principal`\nDeleted secret `app-env`\nNo secrets found for stack `testapp`\n", out.String())
+
+	remaining, err := api.Secrets("testns").List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, remaining.Items, 1)
+}
+
 func TestSecretsDeleteIntegration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/secrets"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var secretsEditCmd = &cobra.Command{
+	Use:   "edit <env> [--age <recipient>]",
+	Short: "Edit the encrypted secrets of an environment.",
+	Long: `Edit the encrypted secrets of an environment.
+
+The secrets-<env>.enc.yaml file of the stack directory is decrypted with sops and opened in $EDITOR, and is encrypted
+again when the editor exits with changes. A file that does not exist yet is created, encrypted for the age recipients
+given with --age, or else for those of the creation rules of the stack's .sops.yaml.
+
+Files are decrypted with the age keys of SOPS_AGE_KEY_FILE, or else ~/.config/sops/age/keys.txt. The values of the
+file reach the cluster as the Kubernetes Secrets declared by the 'secrets' of components, which 'stack up' and
+'stack secrets sync' create, and are never rendered into manifests. They can also be written out with
+'stack secrets fetch --backend sops'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: editSecrets,
+}
+
+func editSecrets(cmd *cobra.Command, args []string) error {
+	env := args[0]
+	if len(config.Environments) > 0 {
+		configured := false
+		for _, environment := range config.Environments {
+			configured = configured || environment.Name == env
+		}
+		if !configured {
+			return fmt.Errorf("no environment named `%v` is configured", env)
+		}
+	}
+	recipients, _ := cmd.Flags().GetStringSlice("age")
+	file := &secrets.SOPS{Path: encryptedSecretsPath(env)}
+	return file.Edit(context.Background(), recipients, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// encryptedSecretsPath returns the path of the sops encrypted secrets of an environment
+func encryptedSecretsPath(env string) string {
+	directory, _ := filepath.Abs(viper.GetString("stack_directory"))
+	return filepath.Join(directory, fmt.Sprintf("secrets-%v.enc.yaml", env))
+}
+
+// encryptedSecretsFiles holds the files decrypted so far, so that each is only decrypted once
+var encryptedSecretsFiles = struct {
+	sync.Mutex
+	files map[string]*secrets.SOPS
+}{files: map[string]*secrets.SOPS{}}
+
+// encryptedSecretsFile returns the encrypted secrets file at path, shared by every use of it in a run
+func encryptedSecretsFile(path string) *secrets.SOPS {
+	encryptedSecretsFiles.Lock()
+	defer encryptedSecretsFiles.Unlock()
+	file, ok := encryptedSecretsFiles.files[path]
+	if !ok {
+		file = &secrets.SOPS{Path: path}
+		encryptedSecretsFiles.files[path] = file
+	}
+	return file
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsEditCmd)
+	secretsEditCmd.Flags().StringSlice("age", []string{}, "Age recipients to encrypt a new secrets file for")
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditSecretsEnvironment(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	dir := buildTestStack(t)
+	config = latest.StackConfig{Environments: []latest.EnvironmentDescription{{Name: "local"}, {Name: "ci"}}}
+
+	assert.EqualError(t, editSecrets(secretsEditCmd, []string{"loacl"}), "no environment named `loacl` is configured")
+	assert.Equal(t, filepath.Join(dir, "secrets-ci.enc.yaml"), encryptedSecretsPath("ci"))
+	assert.Same(t, encryptedSecretsFile(encryptedSecretsPath("ci")), encryptedSecretsFile(encryptedSecretsPath("ci")), "files are only decrypted once per run")
+}
@@ -1,32 +1,42 @@
 package cmd
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/altiscope/platform-stack/pkg/secrets"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-const gsmFetchSecretTemplate = `GOOGLE_APPLICATION_CREDENTIALS={{ .ServiceAccountFile }} gsm-buddy get -i {{ .SecretInputFile }} -p {{ .GcpProjectId }} > {{ .SecretOutputFile }} 2>error.log`
-const gsmAccessSecretTemplate = `gcloud secrets versions access latest --secret="gsm-secret-reader-global-blue" --project={{ .GcpProjectId }} > {{ .GsmReaderJsonFile }}`
-
-type GsmAccessSecretsRequest struct {
-	GcpProjectId      string
-	GsmReaderJsonFile string
-}
-
-type GsmFetchSecretsRequest struct {
-	GcpProjectId       string
-	ServiceAccountFile string
-	SecretInputFile    string
-	SecretOutputFile   string
-}
+// gsmReaderSecretPrefix names the secret holding the key of the reader service account, followed by its flavor
+const gsmReaderSecretPrefix = "gsm-secret-reader-global-"
 
 var secretsFetchCmd = &cobra.Command{
 	Use:   "fetch [-e <env>] [-p <gcp-project-id>] [-i <input-file-directory>] [-o <output-file-directory>]",
 	Short: "Fetch secrets for the secret IDs in the input file.",
 	Long: `Fetch secrets for the secret IDs in the input file.
+
+Secrets are read from GCP Secret Manager with the key of a reader service account, which is taken from --key-file,
+or else the base64 encoded GSM_SECRET_READER_<ENV>_<VERSION> variable. For the local environment, or when
+USE_GSM_IAM_ROLE=yes, the key is itself read from Secret Manager with the application default credentials. Keys are
+only kept in memory, and the output file is only readable by the current user.
+
+With --backend vault, secrets are read from the KV v1 or v2 engines of the Vault server at --vault-address or
+VAULT_ADDR, and secret IDs are paths followed by the key of a value, e.g. 'secret/platform/weather#API_KEY'. Vault is
+logged in to with --vault-auth:
+- token: VAULT_TOKEN, or the token saved by 'vault login'
+- approle: the role ID given by --vault-role or VAULT_ROLE_ID, and the secret ID of VAULT_SECRET_ID
+- kubernetes: the --vault-role role, with the token of the pod's service account
+
+With --backend sops, secrets are decrypted from the stack's secrets-<env>.enc.yaml, as edited by 'stack secrets edit',
+and secret IDs are the keys of the file.
+
 Example:
 	Input: cat deployments/secret-ids-ci.json:
 	{
@@ -42,95 +52,172 @@ Example:
 	RunE: fetchSecrets,
 }
 
+// newGSMBackend returns a Secret Manager backend for a project, authenticated with the given service account key or
+// the application default credentials, and is replaced in tests
+var newGSMBackend = func(ctx context.Context, project string, key []byte) (secrets.Backend, error) {
+	return secrets.NewGSM(ctx, project, key)
+}
+
 func fetchSecrets(cmd *cobra.Command, args []string) error {
 	env, _ := cmd.Flags().GetString("env")
-	project, _ := cmd.Flags().GetString("project")
 	input, _ := cmd.Flags().GetString("input")
 	output, _ := cmd.Flags().GetString("output")
-	sa, _ := cmd.Flags().GetString("service-account")
-	saFlavor, _ := cmd.Flags().GetString("sa-version")
 
-	if env == "local" || os.Getenv("USE_GSM_IAM_ROLE") == "yes" {
-		accessSecretsCmd, err := GenerateCommand(gsmAccessSecretTemplate, GsmAccessSecretsRequest{
-			GcpProjectId:      project,
-			GsmReaderJsonFile: sa,
-		})
+	ctx := context.Background()
+	backend, err := secretsBackend(ctx, cmd, env)
+	if err != nil {
+		return err
+	}
+
+	ids, err := secrets.ReadIDs(filepath.Join(input, fmt.Sprintf("secret-ids-%s.json", env)))
+	if err != nil {
+		return err
+	}
+	values, err := secrets.Fetch(ctx, backend, ids)
+	if err != nil {
+		return err
+	}
+	outputFile := filepath.Join(output, fmt.Sprintf("secrets-%s.json", env))
+	if err := secrets.WriteValues(outputFile, values); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %v secrets to %v\n", len(values), outputFile)
+	return nil
+}
+
+// secretsBackend returns the backend chosen by --backend for an environment
+func secretsBackend(ctx context.Context, cmd *cobra.Command, env string) (secrets.Backend, error) {
+	backend, _ := cmd.Flags().GetString("backend")
+	switch backend {
+	case "gsm":
+		project, _ := cmd.Flags().GetString("project")
+		keyFile, _ := cmd.Flags().GetString("key-file")
+		saFlavor, _ := cmd.Flags().GetString("sa-version")
+		key, err := gsmReaderKey(ctx, env, project, keyFile, saFlavor)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		// For debugging only
-		//fmt.Println(accessSecretsCmd)
+		return newGSMBackend(ctx, project, key)
+	case "vault":
+		return vaultBackend(ctx, cmd)
+	case "sops":
+		return encryptedSecretsFile(encryptedSecretsPath(env)), nil
+	}
+	return nil, fmt.Errorf("--backend must be one of gsm, vault, sops, got `%v`", backend)
+}
 
-		accessSecretsCmd.Stdout = os.Stdout
-		accessSecretsCmd.Stderr = os.Stderr
-		if err := accessSecretsCmd.Run(); err != nil {
-			return err
-		}
-	} else {
-		secretReaderEnvVar := ""
-		if env == "local" || env == "ci" {
-			secretReaderEnvVar = "GSM_SECRET_READER_DEV_" + strings.ToUpper(saFlavor)
-		} else if env == "prev" || env == "preview" {
-			secretReaderEnvVar = "GSM_SECRET_READER_PREV_" + strings.ToUpper(saFlavor)
-		} else if env == "stg" || env == "staging" {
-			secretReaderEnvVar = "GSM_SECRET_READER_STG_" + strings.ToUpper(saFlavor)
-		} else if env == "prod" || env == "production" {
-			secretReaderEnvVar = "GSM_SECRET_READER_PROD_" + strings.ToUpper(saFlavor)
-		} else {
-			return fmt.Errorf("no GCP Secret Manager Project configured for the target environment.")
-		}
+// vaultBackend returns a Vault backend logged in with the auth method chosen by --vault-auth
+func vaultBackend(ctx context.Context, cmd *cobra.Command) (secrets.Backend, error) {
+	var description latest.VaultBackendDescription
+	description.Address, _ = cmd.Flags().GetString("vault-address")
+	description.Auth, _ = cmd.Flags().GetString("vault-auth")
+	description.Role, _ = cmd.Flags().GetString("vault-role")
+	description.AuthPath, _ = cmd.Flags().GetString("vault-auth-path")
+	description.KVVersion, _ = cmd.Flags().GetInt("vault-kv-version")
+	return newVaultBackend(ctx, description)
+}
 
-		if os.Getenv(secretReaderEnvVar) == "" {
-			return fmt.Errorf("GSM_SECRET_READER_{DEV|PREV|STG|PROD}_{BLUE|GREEN} not set.")
+// newVaultBackend returns a Vault backend logged in as described, taking the address, AppRole credentials and
+// namespace from the environment when they are not given
+func newVaultBackend(ctx context.Context, description latest.VaultBackendDescription) (secrets.Backend, error) {
+	address := description.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if description.KVVersion < 0 || description.KVVersion > 2 {
+		return nil, fmt.Errorf("the Vault KV version must be 1 or 2, got %v", description.KVVersion)
+	}
+
+	var auth secrets.VaultAuth
+	role := description.Role
+	switch description.Auth {
+	case "", "token":
+		auth = secrets.VaultToken("")
+	case "approle":
+		if role == "" {
+			role = os.Getenv("VAULT_ROLE_ID")
 		}
+		auth = secrets.VaultAppRole{Mount: description.AuthPath, RoleID: role, SecretID: os.Getenv("VAULT_SECRET_ID")}
+	case "kubernetes":
+		auth = secrets.VaultKubernetes{Mount: description.AuthPath, Role: role}
+	default:
+		return nil, fmt.Errorf("the Vault auth method must be one of token, approle, kubernetes, got `%v`", description.Auth)
+	}
 
-		saKey, err := base64.StdEncoding.DecodeString(os.Getenv(secretReaderEnvVar))
+	vault := &secrets.Vault{Address: address, Namespace: os.Getenv("VAULT_NAMESPACE"), KVVersion: description.KVVersion}
+	if err := vault.Login(ctx, auth); err != nil {
+		return nil, err
+	}
+	return vault, nil
+}
+
+// gsmReaderKey returns the key of the service account secrets are read with, or nil to read them with the application
+// default credentials
+func gsmReaderKey(ctx context.Context, env, project, keyFile, saFlavor string) ([]byte, error) {
+	if keyFile != "" {
+		key, err := ioutil.ReadFile(keyFile)
 		if err != nil {
-			return fmt.Errorf("failed to decode GSM reader service account key: %v", err)
+			return nil, fmt.Errorf("failed to read GSM reader service account key: %v", err)
 		}
+		return key, nil
+	}
 
-		if _, err := os.Stat(sa); os.IsNotExist(err) {
-			_, err := os.Create(sa)
-			if err != nil {
-				return fmt.Errorf("failed to create a file to save GSM reader service account key: %v", err)
-			}
+	if env == "local" || os.Getenv("USE_GSM_IAM_ROLE") == "yes" {
+		backend, err := newGSMBackend(ctx, project, nil)
+		if err != nil {
+			return nil, err
 		}
-
-		err = os.WriteFile(sa, saKey, 0644)
+		key, err := backend.Secret(ctx, gsmReaderSecretPrefix+saFlavor)
 		if err != nil {
-			return fmt.Errorf("failed to save GSM reader service account key: %v", err)
+			return nil, fmt.Errorf("failed to read GSM reader service account key: %v", err)
 		}
+		return key, nil
 	}
 
-	request := GsmFetchSecretsRequest{
-		GcpProjectId:       project,
-		ServiceAccountFile: sa,
-		SecretInputFile:    fmt.Sprintf("%s/secret-ids-%s.json", input, env),
-		SecretOutputFile:   fmt.Sprintf("%s/secrets-%s.json", output, env),
+	secretReaderEnvVar := ""
+	if env == "ci" {
+		secretReaderEnvVar = "GSM_SECRET_READER_DEV_" + strings.ToUpper(saFlavor)
+	} else if env == "prev" || env == "preview" {
+		secretReaderEnvVar = "GSM_SECRET_READER_PREV_" + strings.ToUpper(saFlavor)
+	} else if env == "stg" || env == "staging" {
+		secretReaderEnvVar = "GSM_SECRET_READER_STG_" + strings.ToUpper(saFlavor)
+	} else if env == "prod" || env == "production" {
+		secretReaderEnvVar = "GSM_SECRET_READER_PROD_" + strings.ToUpper(saFlavor)
+	} else {
+		return nil, fmt.Errorf("no GCP Secret Manager Project configured for the target environment.")
 	}
 
-	fetchSecretsCmd, err := GenerateCommand(gsmFetchSecretTemplate, request)
-	if err != nil {
-		return err
+	if os.Getenv(secretReaderEnvVar) == "" {
+		return nil, fmt.Errorf("GSM_SECRET_READER_{DEV|PREV|STG|PROD}_{BLUE|GREEN} not set.")
 	}
-	// For debugging only
-	//fmt.Println(fetchSecretsCmd)
 
-	fetchSecretsCmd.Stdout = os.Stdout
-	fetchSecretsCmd.Stderr = os.Stderr
-	if err := fetchSecretsCmd.Run(); err != nil {
-		return err
+	key, err := base64.StdEncoding.DecodeString(os.Getenv(secretReaderEnvVar))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GSM reader service account key: %v", err)
 	}
+	return key, nil
+}
 
-	return nil
+// addSecretsBackendFlags adds the flags choosing the backend that secret IDs are read from, and how it is logged in to
+func addSecretsBackendFlags(flags *pflag.FlagSet) {
+	flags.StringP("project", "p", "utmgsmdev", "GCP Project ID for Secret Manager (e.g. utmgsmdev, utmgsmstg, utmgsm, etc.)")
+	flags.String("key-file", "", "Path to a GSM Reader service account key, used instead of the one in 'GSM_SECRET_READER_<e>_<v>'")
+	// the reader key used to be written to --service-account, and is now only kept in memory
+	flags.StringP("service-account", "s", "/tmp/gsm-secret-reader.json", "Path the GSM Reader service account key was written to")
+	_ = flags.MarkDeprecated("service-account", "the reader key is no longer written to disk, and the flag is ignored - use --key-file to read the key from a file")
+	flags.StringP("sa-version", "v", "blue", "Service account version flavor (blue|green) used as a postfix for environment variable 'GSM_SECRET_READER_<e>_<v>' to allow rotation")
+	flags.String("backend", "gsm", "Secret store to read secrets from (gsm|vault|sops)")
+	flags.String("vault-address", "", "Address of the Vault server. Defaults to VAULT_ADDR")
+	flags.String("vault-auth", "token", "Method to log in to Vault with (token|approle|kubernetes)")
+	flags.String("vault-role", "", "Role ID of the AppRole, or role of the Kubernetes auth method, to log in to Vault with")
+	flags.String("vault-auth-path", "", "Path the Vault auth method is mounted at. Defaults to 'approle' or 'kubernetes'")
+	flags.Int("vault-kv-version", 0, "Version of the Vault KV secrets engines (1|2). Looked up for each engine when not given")
 }
 
 func init() {
 	secretsCmd.AddCommand(secretsFetchCmd)
 	secretsFetchCmd.Flags().StringP("env", "e", "local", "Deployment target (e.g. local, ci, prod, etc.)")
-	secretsFetchCmd.Flags().StringP("project", "p", "utmgsmdev", "GCP Project ID for Secret Manager (e.g. utmgsmdev, utmgsmstg, utmgsm, etc.)")
 	secretsFetchCmd.Flags().StringP("input", "i", "deployments", "Directory for the secret ID manifest file (manifest file needs to be named as: 'secret-ids-<env>.json')")
 	secretsFetchCmd.Flags().StringP("output", "o", "deployments", "Directory for the output file (to be stored as 'secrets-<env>.json')")
-	secretsFetchCmd.Flags().StringP("service-account", "s", "/tmp/gsm-secret-reader.json", "Path to the GSM Reader service account")
-	secretsFetchCmd.Flags().StringP("sa-version", "v", "blue", "Service account version flavor (blue|green) used as a postfix for environment variable 'GSM_SECRET_READER_<e>_<v>' to allow rotation")
+	addSecretsBackendFlags(secretsFetchCmd.Flags())
 }
@@ -1,13 +1,121 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/secrets"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
 	"gotest.tools/v3/golden"
 	"gotest.tools/v3/icmd"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"testing"
 )
 
+// fetchTestCommand returns a command with the fetch flags set by args, which are reset when the test completes
+func fetchTestCommand(t *testing.T, args ...string) *cobra.Command {
+	return flagsTestCommand(t, secretsFetchCmd, args...)
+}
+
+// flagsTestCommand returns a command with the flags of source set by args, which are reset when the test completes
+func flagsTestCommand(t *testing.T, source *cobra.Command, args ...string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().AddFlagSet(source.Flags())
+	assert.NoError(t, cmd.Flags().Parse(args))
+	t.Cleanup(func() {
+		source.Flags().VisitAll(func(flag *pflag.Flag) {
+			_ = flag.Value.Set(flag.DefValue)
+			flag.Changed = false
+		})
+	})
+	return cmd
+}
+
+func TestFetchSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack-secrets-fetch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret-ids-ci.json"), []byte(`{"API_KEY": "platform-api-key"}`), 0644))
+
+	defer func(f func(context.Context, string, []byte) (secrets.Backend, error)) { newGSMBackend = f }(newGSMBackend)
+	var keys []string
+	newGSMBackend = func(ctx context.Context, project string, key []byte) (secrets.Backend, error) {
+		keys = append(keys, fmt.Sprintf("%v:%s", project, key))
+		return secrets.Fake{"platform-api-key": "key", "gsm-secret-reader-global-green": "local-reader-key"}, nil
+	}
+	_ = os.Setenv("GSM_SECRET_READER_DEV_BLUE", base64.StdEncoding.EncodeToString([]byte("ci-reader-key")))
+	defer os.Unsetenv("GSM_SECRET_READER_DEV_BLUE")
+	assert.NoError(t, fetchSecrets(fetchTestCommand(t, "-i", dir, "-o", dir, "-p", "utmgsmdev", "-e", "ci", "-v", "blue"), nil))
+	assert.Equal(t, []string{"utmgsmdev:ci-reader-key"}, keys)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "secrets-ci.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"API_KEY": "key"}`, string(content))
+	info, err := os.Stat(filepath.Join(dir, "secrets-ci.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// -s used to name the file the reader key was written to, and is ignored
+	keys = nil
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "reader.json"), []byte("file-reader-key"), 0600))
+	cmd := &cobra.Command{}
+	cmd.Flags().AddFlagSet(secretsFetchCmd.Flags())
+	var warnings bytes.Buffer
+	cmd.Flags().SetOutput(&warnings)
+	assert.NoError(t, cmd.Flags().Parse([]string{"-s", filepath.Join(dir, "missing.json"), "--key-file", filepath.Join(dir, "reader.json")}))
+	assert.NoError(t, fetchSecrets(cmd, nil))
+	assert.Equal(t, []string{"utmgsmdev:file-reader-key"}, keys)
+	assert.Contains(t, warnings.String(), "Flag --service-account has been deprecated")
+
+	keys = nil
+	key, err := gsmReaderKey(context.Background(), "local", "utmgsmdev", "", "green")
+	assert.NoError(t, err)
+	assert.Equal(t, "local-reader-key", string(key))
+	assert.Equal(t, []string{"utmgsmdev:"}, keys)
+
+	_, err = gsmReaderKey(context.Background(), "prod", "utmgsm", "", "green")
+	assert.EqualError(t, err, "GSM_SECRET_READER_{DEV|PREV|STG|PROD}_{BLUE|GREEN} not set.")
+}
+
+func TestFetchSecretsVault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack-secrets-fetch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret-ids-staging.json"), []byte(`{"DB_PASSWORD": "kv/platform/db#password"}`), 0644))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			_, _ = w.Write([]byte(`{"auth": {"client_token": "approle-token"}}`))
+		case r.URL.Path == "/v1/kv/platform/db" && r.Header.Get("X-Vault-Token") == "approle-token":
+			_, _ = w.Write([]byte(`{"data": {"password": "db-password"}}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	_ = os.Setenv("VAULT_SECRET_ID", "secret-id")
+	defer os.Unsetenv("VAULT_SECRET_ID")
+	cmd := fetchTestCommand(t, "-e", "staging", "-i", dir, "-o", dir, "--backend", "vault",
+		"--vault-address", server.URL, "--vault-auth", "approle", "--vault-role", "stack-ci", "--vault-kv-version", "1")
+	assert.NoError(t, fetchSecrets(cmd, nil))
+	content, err := ioutil.ReadFile(filepath.Join(dir, "secrets-staging.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"DB_PASSWORD": "db-password"}`, string(content))
+
+	assert.NoError(t, cmd.Flags().Set("vault-auth", "ldap"))
+	assert.EqualError(t, fetchSecrets(cmd, nil), "the Vault auth method must be one of token, approle, kubernetes, got `ldap`")
+}
+
 func TestSecretsFetchIntegration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -0,0 +1,508 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/altiscope/platform-stack/pkg/secrets"
+	"github.com/spf13/cobra"
+	"io"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	v13 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	v12 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the states of a component secret in the cluster, compared to its values in the secret backend
+const (
+	secretInSync   = "in-sync"
+	secretDrifted  = "drifted"
+	secretMissing  = "missing"
+	secretOrphaned = "orphaned"
+)
+
+// restartedAtAnnotation is the pod template annotation `kubectl rollout restart` sets to restart a workload
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// secretHashesAnnotation is the pod template annotation recording the hashes of the component secrets a workload was
+// last restarted with, as a comma separated list of `<name>=<hash>`
+const secretHashesAnnotation = "stack-secret-hashes"
+
+var secretsStatusCmd = &cobra.Command{
+	Use:   "status [--rotate]",
+	Short: "Compare the secrets of components with their values in the secret backend.",
+	Long: `Compare the secrets of components with their values in the secret backend.
+
+The secrets declared by the components of the current environment are read from the stack's secret backend, and a hash
+of their keys and values is compared to that of the secrets in the cluster. Values are never printed. Each secret is:
+- in-sync: the secret in the cluster holds the values of the backend
+- drifted: the secret in the cluster holds other values, or other keys, which are named
+- missing: the secret has not been created in the cluster
+- orphaned: the secret was created for a component, but is no longer declared for the current environment
+
+The values of the secret IDs in secret-ids-<env>.json, which 'stack secrets fetch' writes to secrets-<env>.json, are
+read from the backend chosen by the same flags as 'stack secrets fetch', and compared to those of secrets-<env>.json and
+of the Secret created from it, when --fetched-secret names one. Their rows are named after the variables, with the file
+in place of a component.
+
+With --rotate, drifted and missing secrets are created or updated from the backend, and the Deployments that consume
+component secrets, through volumes, environment variables or imagePullSecrets, are restarted when any of those secrets
+changed since they were last restarted by --rotate. This includes secrets updated by 'stack up' and 'stack secrets sync',
+which do not restart their consumers. The hashes of the secrets each Deployment was restarted with are kept in its
+stack-secret-hashes pod template annotation, so Deployments without one are restarted the first time. Orphaned secrets
+are left in place, and can be removed with 'stack secrets delete'. Fetched values that changed are written to
+secrets-<env>.json and to the --fetched-secret Secret, whose consumers are restarted the same way, while manifests
+rendered from the file are only updated by the next 'stack up'.
+
+Registry secrets are not compared, and are refreshed by running 'stack secrets registry' again.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return initK8s("")
+	},
+	RunE: secretsStatus,
+}
+
+// secretStatus is the state of a secret of the stack in the cluster
+type secretStatus struct {
+	name      string
+	component string
+	status    string
+	details   string
+	// desired is the secret as read from the backend, which is nil for orphaned secrets
+	desired *v1.Secret
+}
+
+func secretsStatus(cmd *cobra.Command, args []string) error {
+	env, err := getEnvironment()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	syncer := newComponentSecretSyncer(env.Name)
+	statuses, err := secretStatuses(ctx, syncer, config.Components)
+	if err != nil {
+		return err
+	}
+	fetched, err := readFetchedSecrets(ctx, cmd, env.Name)
+	if err != nil {
+		return err
+	}
+	if fetched != nil {
+		fetchedStatuses, err := fetched.statuses(ctx, syncer.api, syncer.namespace)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, fetchedStatuses...)
+	}
+	if len(statuses) == 0 {
+		fmt.Printf("No component secrets declared, and no secret IDs found, for environment `%v`\n", env.Name)
+		return nil
+	}
+	printSecretStatuses(statuses, os.Stdout)
+
+	if rotate, _ := cmd.Flags().GetBool("rotate"); rotate {
+		return rotateSecrets(ctx, syncer, clientset.AppsV1(), statuses, fetched, time.Now(), os.Stdout)
+	}
+	return nil
+}
+
+// secretStatuses compares the secrets components declare with those in the cluster, and finds the secrets created for
+// components that are no longer declared, sorted by name
+func secretStatuses(ctx context.Context, syncer *componentSecretSyncer, components []latest.ComponentDescription) ([]secretStatus, error) {
+	var statuses []secretStatus
+	declared := map[string]bool{}
+	for _, component := range components {
+		desired, err := syncer.componentSecrets(ctx, component)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range desired {
+			declared[secret.Name] = true
+			status := secretStatus{name: secret.Name, component: component.Name, desired: secret}
+			live, err := syncer.api.Secrets(syncer.namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				status.status = secretMissing
+			} else if err != nil {
+				return nil, fmt.Errorf("reading secret `%v`: %w", secret.Name, err)
+			} else if secretHash(live) == secretHash(secret) {
+				status.status = secretInSync
+			} else {
+				status.status = secretDrifted
+				status.details = secretDrift(live, secret)
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	live, err := listStackSecrets(ctx, syncer.api, syncer.namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range live {
+		component, ok := secret.Labels[componentSecretLabel]
+		if ok && !declared[secret.Name] {
+			statuses = append(statuses, secretStatus{name: secret.Name, component: component, status: secretOrphaned})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].name < statuses[j].name
+	})
+	return statuses, nil
+}
+
+// secretHash returns a hash of the type, keys and values of a secret
+func secretHash(secret *v1.Secret) string {
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%v\x00", secret.Type)
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(hash, "%v\x00%x\x00", key, sha256.Sum256(secret.Data[key]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// secretDrift describes how a secret in the cluster differs from the desired secret, by the names of its keys
+func secretDrift(live, desired *v1.Secret) string {
+	var changed, missing, extra []string
+	for key, value := range desired.Data {
+		liveValue, ok := live.Data[key]
+		if !ok {
+			missing = append(missing, key)
+		} else if string(liveValue) != string(value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range live.Data {
+		if _, ok := desired.Data[key]; !ok {
+			extra = append(extra, key)
+		}
+	}
+
+	var details []string
+	if live.Type != desired.Type {
+		details = append(details, fmt.Sprintf("type %v, expected %v", live.Type, desired.Type))
+	}
+	for _, keys := range []struct {
+		description string
+		keys        []string
+	}{{"changed", changed}, {"missing", missing}, {"extra", extra}} {
+		if len(keys.keys) > 0 {
+			sort.Strings(keys.keys)
+			details = append(details, fmt.Sprintf("%v: %v", keys.description, strings.Join(keys.keys, ",")))
+		}
+	}
+	return strings.Join(details, "; ")
+}
+
+// printSecretStatuses writes a row per secret, naming the keys that drifted but never showing their values
+func printSecretStatuses(statuses []secretStatus, out io.Writer) {
+	columnsTemplate := "%-32v%-24v%-12v%v\n"
+	_, _ = fmt.Fprintf(out, columnsTemplate, "NAME", "COMPONENT", "STATUS", "DETAILS")
+	for _, status := range statuses {
+		_, _ = fmt.Fprintf(out, columnsTemplate, status.name, status.component, status.status, valueOrNone(status.details))
+	}
+}
+
+// rotateSecrets creates or updates the drifted and missing secrets from the backend, along with the fetched values when
+// given, and restarts the Deployments that consume secrets whose hash differs from the one recorded when they were last
+// restarted
+func rotateSecrets(ctx context.Context, syncer *componentSecretSyncer, apps v13.AppsV1Interface, statuses []secretStatus, fetched *fetchedSecrets, now time.Time, out io.Writer) error {
+	hashes := map[string]string{}
+	rotated := false
+	for _, status := range statuses {
+		if status.desired == nil {
+			continue
+		}
+		hashes[status.name] = secretHash(status.desired)
+		if status.status != secretDrifted && status.status != secretMissing {
+			continue
+		}
+		if err := applySecret(ctx, syncer.api, status.desired, out); err != nil {
+			return err
+		}
+		rotated = true
+	}
+	if fetched != nil {
+		secret, err := fetched.rotate(ctx, syncer.api, syncer.namespace, out)
+		if err != nil {
+			return err
+		}
+		if secret != nil {
+			hashes[secret.Name] = secretHash(secret)
+		}
+		rotated = rotated || fetched.fileStale || fetched.secretStale
+	}
+
+	deployments, err := apps.Deployments(syncer.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing deployments: %w", err)
+	}
+	restarted := false
+	for _, deployment := range deployments.Items {
+		recorded := parseSecretHashes(deployment.Spec.Template.Annotations[secretHashesAnnotation])
+		var stale []string
+		for name := range consumedSecrets(deployment.Spec.Template.Spec) {
+			hash, ok := hashes[name]
+			if !ok {
+				continue
+			}
+			if recorded[name] != hash {
+				stale = append(stale, name)
+			}
+			recorded[name] = hash
+		}
+		if len(stale) == 0 {
+			continue
+		}
+		sort.Strings(stale)
+		patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q,%q:%q}}}}}`,
+			restartedAtAnnotation, now.Format(time.RFC3339), secretHashesAnnotation, formatSecretHashes(recorded))
+		if _, err := apps.Deployments(syncer.namespace).Patch(ctx, deployment.Name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("restarting deployment `%v`: %w", deployment.Name, err)
+		}
+		_, _ = fmt.Fprintf(out, "Restarted deployment `%v` to use secrets %v\n", deployment.Name, strings.Join(stale, ","))
+		restarted = true
+	}
+	if !rotated && !restarted {
+		_, _ = fmt.Fprintln(out, "All secrets are in sync, nothing to rotate")
+	}
+	return nil
+}
+
+// fetchedSecrets are the values of the secret IDs of secret-ids-<env>.json, which `stack secrets fetch` writes to
+// secrets-<env>.json, and the Secret created from that file, if any
+type fetchedSecrets struct {
+	// path is the secrets-<env>.json file
+	path string
+	// secret names the Secret created from the file, whose keys are the names of the values
+	secret string
+	// values are read from the backend
+	values map[string]string
+
+	// fileStale and secretStale are set by statuses when the file or the Secret differ from the backend
+	fileStale, secretStale bool
+}
+
+// readFetchedSecrets reads the values of the secret IDs in the --input directory from the backend of the fetch flags,
+// or returns nil when the environment has no secret IDs
+func readFetchedSecrets(ctx context.Context, cmd *cobra.Command, env string) (*fetchedSecrets, error) {
+	input, _ := cmd.Flags().GetString("input")
+	output, _ := cmd.Flags().GetString("output")
+	secret, _ := cmd.Flags().GetString("fetched-secret")
+	idsPath := filepath.Join(input, fmt.Sprintf("secret-ids-%s.json", env))
+	if _, err := os.Stat(idsPath); os.IsNotExist(err) {
+		if secret != "" {
+			return nil, fmt.Errorf("--fetched-secret is given, but `%v` does not exist", idsPath)
+		}
+		return nil, nil
+	}
+
+	ids, err := secrets.ReadIDs(idsPath)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := secretsBackend(ctx, cmd, env)
+	if err != nil {
+		return nil, err
+	}
+	values, err := secrets.Fetch(ctx, backend, ids)
+	if err != nil {
+		return nil, err
+	}
+	return &fetchedSecrets{path: filepath.Join(output, fmt.Sprintf("secrets-%s.json", env)), secret: secret, values: values}, nil
+}
+
+// statuses compares the values read from the backend with those of the file and of the Secret, by variable name, and
+// finds the values of the file whose IDs were removed
+func (f *fetchedSecrets) statuses(ctx context.Context, api v12.CoreV1Interface, namespace string) ([]secretStatus, error) {
+	var file map[string]string
+	if _, err := os.Stat(f.path); err == nil {
+		if file, err = secrets.ReadValues(f.path); err != nil {
+			return nil, err
+		}
+	}
+	var live map[string][]byte
+	if f.secret != "" {
+		secret, err := api.Secrets(namespace).Get(ctx, f.secret, metav1.GetOptions{})
+		if err == nil {
+			live = secret.Data
+		} else if !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("reading secret `%v`: %w", f.secret, err)
+		}
+	}
+
+	source := filepath.Base(f.path)
+	names := make([]string, 0, len(f.values))
+	for name := range f.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var statuses []secretStatus
+	for _, name := range names {
+		value := f.values[name]
+		var changed, missing []string
+		if fileValue, ok := file[name]; !ok {
+			missing = append(missing, source)
+			f.fileStale = true
+		} else if fileValue != value {
+			changed = append(changed, source)
+			f.fileStale = true
+		}
+		if f.secret != "" {
+			if liveValue, ok := live[name]; !ok {
+				missing = append(missing, "secret "+f.secret)
+				f.secretStale = true
+			} else if string(liveValue) != value {
+				changed = append(changed, "secret "+f.secret)
+				f.secretStale = true
+			}
+		}
+
+		status := secretStatus{name: name, component: source, status: secretInSync}
+		var details []string
+		if len(changed) > 0 {
+			status.status = secretDrifted
+			details = append(details, "changed in: "+strings.Join(changed, ","))
+		}
+		if len(missing) > 0 {
+			status.status = secretMissing
+			details = append(details, "missing from: "+strings.Join(missing, ","))
+		}
+		status.details = strings.Join(details, "; ")
+		statuses = append(statuses, status)
+	}
+
+	var orphaned []string
+	for name := range file {
+		if _, ok := f.values[name]; !ok {
+			orphaned = append(orphaned, name)
+		}
+	}
+	sort.Strings(orphaned)
+	for _, name := range orphaned {
+		statuses = append(statuses, secretStatus{name: name, component: source, status: secretOrphaned})
+		f.fileStale = true
+	}
+	return statuses, nil
+}
+
+// rotate writes the values read from the backend to the file and to the Secret when they differ, and returns the
+// Secret so that its consumers are restarted, or nil when there is none
+func (f *fetchedSecrets) rotate(ctx context.Context, api v12.CoreV1Interface, namespace string, out io.Writer) (*v1.Secret, error) {
+	if f.fileStale {
+		if err := secrets.WriteValues(f.path, f.values); err != nil {
+			return nil, err
+		}
+		_, _ = fmt.Fprintf(out, "Wrote %v secrets to %v\n", len(f.values), f.path)
+	}
+	if f.secret == "" {
+		return nil, nil
+	}
+
+	secret, err := api.Secrets(namespace).Get(ctx, f.secret, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		if !f.secretStale {
+			return nil, nil
+		}
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: f.secret, Namespace: namespace, Labels: stackSecretLabels()},
+			Type:       v1.SecretTypeOpaque,
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("reading secret `%v`: %w", f.secret, err)
+	}
+	if !f.secretStale {
+		return secret, nil
+	}
+
+	data := make(map[string][]byte, len(secret.Data)+len(f.values))
+	for key, value := range secret.Data {
+		data[key] = value
+	}
+	for name, value := range f.values {
+		data[name] = []byte(value)
+	}
+	secret.Data = data
+	if err := applySecret(ctx, api, secret, out); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// parseSecretHashes parses the value of the secret hashes annotation, ignoring malformed entries
+func parseSecretHashes(annotation string) map[string]string {
+	hashes := map[string]string{}
+	for _, entry := range strings.Split(annotation, ",") {
+		if parts := strings.SplitN(entry, "=", 2); len(parts) == 2 {
+			hashes[parts[0]] = parts[1]
+		}
+	}
+	return hashes
+}
+
+// formatSecretHashes formats the value of the secret hashes annotation, sorted by secret name
+func formatSecretHashes(hashes map[string]string) string {
+	entries := make([]string, 0, len(hashes))
+	for name, hash := range hashes {
+		entries = append(entries, name+"="+hash)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// consumedSecrets returns the names of the secrets a pod uses, through volumes, environment variables or
+// imagePullSecrets
+func consumedSecrets(pod v1.PodSpec) map[string]bool {
+	names := map[string]bool{}
+	for _, secret := range pod.ImagePullSecrets {
+		names[secret.Name] = true
+	}
+	for _, volume := range pod.Volumes {
+		if volume.Secret != nil {
+			names[volume.Secret.SecretName] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					names[source.Secret.Name] = true
+				}
+			}
+		}
+	}
+	containers := append(append([]v1.Container{}, pod.InitContainers...), pod.Containers...)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				names[envFrom.SecretRef.Name] = true
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				names[env.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+	}
+	return names
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsStatusCmd)
+	secretsStatusCmd.Flags().StringP("input", "i", "deployments", "Directory of the secret ID manifest file, named 'secret-ids-<env>.json', whose values are compared")
+	secretsStatusCmd.Flags().StringP("output", "o", "deployments", "Directory of the 'secrets-<env>.json' file written by 'stack secrets fetch'")
+	secretsStatusCmd.Flags().String("fetched-secret", "", "Name of the Secret created from 'secrets-<env>.json', whose values are compared too")
+	addSecretsBackendFlags(secretsStatusCmd.Flags())
+	secretsStatusCmd.Flags().Bool("rotate", false, "Update drifted and missing secrets from the backend, and restart the Deployments consuming secrets that changed since they were last restarted")
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/altiscope/platform-stack/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecretStatuses(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	config = latest.StackConfig{Stack: latest.StackDescription{Name: "testapp"}}
+
+	labels := map[string]string{"stack": "testapp", "stack-component": "app"}
+	client := fake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "weather", Namespace: "testns", Labels: labels},
+			Type:       v1.SecretTypeOpaque,
+			Data:       map[string][]byte{"API_KEY": []byte("weather-key")},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "testns", Labels: labels},
+			Type:       v1.SecretTypeOpaque,
+			Data:       map[string][]byte{"password": []byte("old-password"), "host": []byte("db")},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "testns", Labels: labels},
+			Type:       v1.SecretTypeOpaque,
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "acr-service-principal", Namespace: "testns", Labels: map[string]string{"stack": "testapp"}},
+			Type:       v1.SecretTypeDockerConfigJson,
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "testns"},
+			Spec: appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{
+				Name: "api",
+				Env:  []v1.EnvVar{{Name: "DB_PASSWORD", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "db"}, Key: "password"}}}},
+			}}}}},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "testns"},
+			Spec: appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+				Volumes:    []v1.Volume{{Name: "certs", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "certs"}}}},
+				Containers: []v1.Container{{Name: "worker", EnvFrom: []v1.EnvFromSource{{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "weather"}}}}}},
+			}}},
+		},
+	)
+	backend := secrets.Fake{"weather-key": "weather-key", "db-password": "new-password", "tls-cert": "cert"}
+	syncer := &componentSecretSyncer{
+		env:       "local",
+		api:       client.CoreV1(),
+		namespace: "testns",
+		newBackend: func(ctx context.Context, env string) (secrets.Backend, error) {
+			return backend, nil
+		},
+	}
+	components := []latest.ComponentDescription{{Name: "app", Secrets: []latest.ComponentSecretDescription{
+		{Name: "weather", Keys: map[string]string{"API_KEY": "weather-key"}},
+		{Name: "db", Keys: map[string]string{"password": "db-password", "user": "db-password"}},
+		{Name: "certs", Keys: map[string]string{"tls.crt": "tls-cert"}},
+	}}}
+
+	statuses, err := secretStatuses(context.Background(), syncer, components)
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	printSecretStatuses(statuses, &out)
+	assert.Equal(t, `NAME                            COMPONENT               STATUS      DETAILS
+certs                           app                     missing     <none>
+db                              app                     drifted     changed: password; missing: user; extra: host
+legacy                          app                     orphaned    <none>
+weather                         app                     in-sync     <none>
+`, out.String())
+	assert.NotContains(t, out.String(), "new-password", "values are never printed")
+
+	out.Reset()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, rotateSecrets(context.Background(), syncer, client.AppsV1(), statuses, nil, now, &out))
+	assert.Equal(t, "Created secret `certs`\nUpdated secret `db`\nRestarted deployment `api` to use secrets db\nRestarted deployment `worker` to use secrets certs,weather\n", out.String())
+
+	db, err := client.CoreV1().Secrets("testns").Get(context.Background(), "db", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"password": []byte("new-password"), "user": []byte("new-password")}, db.Data)
+	api, err := client.AppsV1().Deployments("testns").Get(context.Background(), "api", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2026-10-18T12:00:00Z", api.Spec.Template.Annotations[restartedAtAnnotation])
+	assert.Equal(t, "db="+secretHash(db), api.Spec.Template.Annotations[secretHashesAnnotation])
+
+	statuses, err = secretStatuses(context.Background(), syncer, components)
+	assert.NoError(t, err)
+	for _, status := range statuses {
+		if status.name != "legacy" {
+			assert.Equal(t, secretInSync, status.status, status.name)
+		}
+	}
+	out.Reset()
+	assert.NoError(t, rotateSecrets(context.Background(), syncer, client.AppsV1(), statuses, nil, now, &out))
+	assert.Equal(t, "All secrets are in sync, nothing to rotate\n", out.String())
+
+	backend["db-password"] = "newer-password"
+	out.Reset()
+	assert.NoError(t, syncer.sync(context.Background(), components[0], &out))
+	assert.Equal(t, "Updated secret `weather`\nUpdated secret `db`\nUpdated secret `certs`\nThe workloads using secrets db were not restarted - run `stack secrets status --rotate` to restart them\n", out.String())
+	statuses, err = secretStatuses(context.Background(), syncer, components)
+	assert.NoError(t, err)
+	out.Reset()
+	assert.NoError(t, rotateSecrets(context.Background(), syncer, client.AppsV1(), statuses, nil, now, &out))
+	assert.Equal(t, "Restarted deployment `api` to use secrets db\n", out.String(), "consumers of secrets updated by sync are restarted")
+}
+
+func TestFetchedSecretStatuses(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	config = latest.StackConfig{Stack: latest.StackDescription{Name: "testapp"}}
+	dir, err := ioutil.TempDir("", "stack-secrets-status")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret-ids-local.json"), []byte(`{"API_KEY": "platform-api-key", "DB_PASSWORD": "platform-db-password"}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secrets-local.json"), []byte(`{"API_KEY": "old-key", "TOKEN": "token"}`), 0600))
+
+	defer func(f func(context.Context, string, []byte) (secrets.Backend, error)) { newGSMBackend = f }(newGSMBackend)
+	newGSMBackend = func(ctx context.Context, project string, key []byte) (secrets.Backend, error) {
+		return secrets.Fake{"platform-api-key": "key", "platform-db-password": "password", "gsm-secret-reader-global-blue": "reader-key"}, nil
+	}
+	client := fake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-env", Namespace: "testns"},
+			Type:       v1.SecretTypeOpaque,
+			Data:       map[string][]byte{"API_KEY": []byte("key"), "OTHER": []byte("other")},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "testns"},
+			Spec: appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{
+				Name:    "api",
+				EnvFrom: []v1.EnvFromSource{{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "app-env"}}}},
+			}}}}},
+		},
+	)
+	syncer := &componentSecretSyncer{env: "local", api: client.CoreV1(), namespace: "testns"}
+
+	cmd := flagsTestCommand(t, secretsStatusCmd, "-i", dir, "-o", dir, "--fetched-secret", "app-env")
+	fetched, err := readFetchedSecrets(context.Background(), cmd, "local")
+	assert.NoError(t, err)
+	statuses, err := fetched.statuses(context.Background(), syncer.api, syncer.namespace)
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	printSecretStatuses(statuses, &out)
+	assert.Equal(t, `NAME                            COMPONENT               STATUS      DETAILS
+API_KEY                         secrets-local.json      drifted     changed in: secrets-local.json
+DB_PASSWORD                     secrets-local.json      missing     missing from: secrets-local.json,secret app-env
+TOKEN                           secrets-local.json      orphaned    <none>
+`, out.String())
+
+	out.Reset()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, rotateSecrets(context.Background(), syncer, client.AppsV1(), statuses, fetched, now, &out))
+	assert.Equal(t, "Wrote 2 secrets to "+filepath.Join(dir, "secrets-local.json")+"\nUpdated secret `app-env`\nRestarted deployment `api` to use secrets app-env\n", out.String())
+	values, err := secrets.ReadValues(filepath.Join(dir, "secrets-local.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"API_KEY": "key", "DB_PASSWORD": "password"}, values)
+	secret, err := client.CoreV1().Secrets("testns").Get(context.Background(), "app-env", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"API_KEY": []byte("key"), "DB_PASSWORD": []byte("password"), "OTHER": []byte("other")}, secret.Data)
+
+	fetched, err = readFetchedSecrets(context.Background(), cmd, "local")
+	assert.NoError(t, err)
+	statuses, err = fetched.statuses(context.Background(), syncer.api, syncer.namespace)
+	assert.NoError(t, err)
+	for _, status := range statuses {
+		assert.Equal(t, secretInSync, status.status, status.name)
+	}
+	out.Reset()
+	assert.NoError(t, rotateSecrets(context.Background(), syncer, client.AppsV1(), statuses, fetched, now, &out))
+	assert.Equal(t, "All secrets are in sync, nothing to rotate\n", out.String())
+
+	fetched, err = readFetchedSecrets(context.Background(), cmd, "ci")
+	assert.EqualError(t, err, "--fetched-secret is given, but `"+filepath.Join(dir, "secret-ids-ci.json")+"` does not exist")
+	assert.NoError(t, cmd.Flags().Set("fetched-secret", ""))
+	fetched, err = readFetchedSecrets(context.Background(), cmd, "ci")
+	assert.NoError(t, err)
+	assert.Nil(t, fetched, "environments without secret IDs have no fetched values")
+}
+
+func TestSecretHashes(t *testing.T) {
+	hashes := map[string]string{"weather": "abc", "db": "def"}
+	assert.Equal(t, "db=def,weather=abc", formatSecretHashes(hashes))
+	assert.Equal(t, hashes, parseSecretHashes(formatSecretHashes(hashes)))
+	assert.Equal(t, map[string]string{}, parseSecretHashes(""))
+}
+
+func TestSecretHash(t *testing.T) {
+	secret := &v1.Secret{Type: v1.SecretTypeOpaque, Data: map[string][]byte{"a": []byte("bc"), "d": []byte("e")}}
+	assert.Equal(t, secretHash(secret), secretHash(secret.DeepCopy()))
+	assert.NotEqual(t, secretHash(secret), secretHash(&v1.Secret{Type: v1.SecretTypeOpaque, Data: map[string][]byte{"a": []byte("b"), "d": []byte("ce")}}))
+	assert.NotEqual(t, secretHash(secret), secretHash(&v1.Secret{Type: v1.SecretTypeBasicAuth, Data: secret.Data}))
+}
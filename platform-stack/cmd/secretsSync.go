@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/altiscope/platform-stack/pkg/secrets"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v12 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// componentSecretLabel names the component a secret of the stack was created for
+const componentSecretLabel = "stack-component"
+
+var secretsSyncCmd = &cobra.Command{
+	Use:   "sync [<component>...]",
+	Short: "Create or update the secrets of components from the stack's secret backend.",
+	Long: `Create or update the secrets of components from the stack's secret backend.
+
+The secrets listed by the components of the stack config are read from the first backend of the secrets section that
+applies to the current environment, or else decrypted from the environment's secrets-<env>.enc.yaml, and created or
+updated in the current namespace. 'stack up' syncs the secrets of each component before applying its manifests, so this
+is only needed to refresh secrets whose values have changed. Workloads consuming updated secrets are not restarted, and
+keep the old values of environment variables until 'stack secrets status --rotate' restarts them.
+
+If no components are given, the secrets of every component in the current environment are synced.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return initK8s("")
+	},
+	RunE: syncSecrets,
+}
+
+func syncSecrets(cmd *cobra.Command, args []string) error {
+	env, err := getEnvironment()
+	if err != nil {
+		return err
+	}
+	components, err := parseComponentArgs(args, config.Components)
+	if err != nil {
+		return err
+	}
+	syncer := newComponentSecretSyncer(env.Name)
+	for _, component := range components {
+		if err := syncer.sync(context.Background(), component, os.Stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// componentSecretSyncer creates the secrets of components in the cluster, connecting to the secret backend the first
+// time a component has secrets to sync
+type componentSecretSyncer struct {
+	env        string
+	api        v12.CoreV1Interface
+	namespace  string
+	environ    []string
+	newBackend func(ctx context.Context, env string) (secrets.Backend, error)
+
+	once    sync.Once
+	backend secrets.Backend
+	err     error
+}
+
+// newComponentSecretSyncer returns a syncer for the secrets of an environment, kept in the current namespace
+func newComponentSecretSyncer(env string) *componentSecretSyncer {
+	return &componentSecretSyncer{
+		env:        env,
+		api:        clientset.CoreV1(),
+		namespace:  stackSecretsNamespace(),
+		environ:    os.Environ(),
+		newBackend: stackSecretsBackend,
+	}
+}
+
+// sync creates or updates the secrets of a component in the syncer's environment, noting the secrets whose values
+// changed, as the workloads consuming them are not restarted
+func (s *componentSecretSyncer) sync(ctx context.Context, component latest.ComponentDescription, out io.Writer) error {
+	secrets, err := s.componentSecrets(ctx, component)
+	if err != nil {
+		return err
+	}
+	var changed []string
+	for _, secret := range secrets {
+		live, err := s.api.Secrets(s.namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("reading secret `%v`: %w", secret.Name, err)
+		}
+		if err == nil && secretHash(live) != secretHash(secret) {
+			changed = append(changed, secret.Name)
+		}
+		if err := applySecret(ctx, s.api, secret, out); err != nil {
+			return err
+		}
+	}
+	if len(changed) > 0 {
+		_, _ = fmt.Fprintf(out, "The workloads using secrets %v were not restarted - run `stack secrets status --rotate` to restart them\n", strings.Join(changed, ","))
+	}
+	return nil
+}
+
+// componentSecrets returns the secrets of a component in the syncer's environment, with their values read from the
+// backend
+func (s *componentSecretSyncer) componentSecrets(ctx context.Context, component latest.ComponentDescription) ([]*v1.Secret, error) {
+	var descriptions []latest.ComponentSecretDescription
+	for _, description := range component.Secrets {
+		if envsApply(description.Environments, s.env) {
+			descriptions = append(descriptions, description)
+		}
+	}
+	if len(descriptions) == 0 || !envsApply(component.Environments, s.env) {
+		return nil, nil
+	}
+
+	s.once.Do(func() {
+		s.backend, s.err = s.newBackend(ctx, s.env)
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+	var secrets []*v1.Secret
+	for _, description := range descriptions {
+		secret, err := componentSecret(ctx, s.backend, component.Name, description, s.namespace, s.environ)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+// componentSecret reads the values of a component's secret from a backend, templating their IDs from environ
+func componentSecret(ctx context.Context, backend secrets.Backend, component string, description latest.ComponentSecretDescription, namespace string, environ []string) (*v1.Secret, error) {
+	if description.Name == "" {
+		return nil, fmt.Errorf("the secrets of component `%v` must have a name", component)
+	}
+	if len(description.Keys) == 0 {
+		return nil, fmt.Errorf("secret `%v` of component `%v` has no keys", description.Name, component)
+	}
+	ids := make(map[string]string, len(description.Keys))
+	for key, id := range description.Keys {
+		id, err := executeEnvTemplate(fmt.Sprintf("ID of key `%v` of secret `%v`", key, description.Name), id, environ)
+		if err != nil {
+			return nil, err
+		}
+		ids[key] = id
+	}
+	values, err := secrets.Fetch(ctx, backend, ids)
+	if err != nil {
+		return nil, fmt.Errorf("secret `%v` of component `%v`: %w", description.Name, component, err)
+	}
+
+	secretType := v1.SecretTypeOpaque
+	if description.Type != "" {
+		secretType = v1.SecretType(description.Type)
+	}
+	labels := stackSecretLabels()
+	labels[componentSecretLabel] = component
+	data := make(map[string][]byte, len(values))
+	for key, value := range values {
+		data[key] = []byte(value)
+	}
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: description.Name, Namespace: namespace, Labels: labels},
+		Type:       secretType,
+		Data:       data,
+	}, nil
+}
+
+// stackSecretsBackend returns the first secret backend of the stack config that applies to an environment, or else the
+// environment's encrypted secrets file
+func stackSecretsBackend(ctx context.Context, env string) (secrets.Backend, error) {
+	for _, description := range config.Secrets.Backends {
+		if !envsApply(description.Environments, env) {
+			continue
+		}
+		if description.GSM != nil && description.Vault != nil {
+			return nil, fmt.Errorf("the secret backend of environment `%v` must set at most one of gsm or vault", env)
+		}
+		if description.GSM != nil {
+			return configuredGSMBackend(ctx, *description.GSM)
+		}
+		if description.Vault != nil {
+			return newVaultBackend(ctx, *description.Vault)
+		}
+		break
+	}
+
+	path := encryptedSecretsPath(env)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no secret backend is configured for environment `%v`, and `%v` does not exist - create it with `stack secrets edit %v`", env, filepath.Base(path), env)
+	}
+	return encryptedSecretsFile(path), nil
+}
+
+// configuredGSMBackend returns a Secret Manager backend authenticated with the configured key file, or else the
+// application default credentials
+func configuredGSMBackend(ctx context.Context, description latest.GSMBackendDescription) (secrets.Backend, error) {
+	if description.Project == "" {
+		return nil, fmt.Errorf("the gsm secret backend must name a project")
+	}
+	var key []byte
+	if description.KeyFile != "" {
+		keyFile, err := executeEnvTemplate("keyFile of the gsm secret backend", description.KeyFile, os.Environ())
+		if err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(keyFile) {
+			stackDirectory, _ := filepath.Abs(viper.GetString("stack_directory"))
+			keyFile = filepath.Join(stackDirectory, keyFile)
+		}
+		if key, err = ioutil.ReadFile(keyFile); err != nil {
+			return nil, fmt.Errorf("reading the key of the gsm secret backend: %w", err)
+		}
+	}
+	return newGSMBackend(ctx, description.Project, key)
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsSyncCmd)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/altiscope/platform-stack/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestComponentSecretSyncer(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	config = latest.StackConfig{Stack: latest.StackDescription{Name: "testapp"}}
+
+	backends := 0
+	syncer := &componentSecretSyncer{
+		env:       "local",
+		api:       fake.NewSimpleClientset().CoreV1(),
+		namespace: "testns",
+		environ:   []string{"WEATHER_ENV=local"},
+		newBackend: func(ctx context.Context, env string) (secrets.Backend, error) {
+			backends++
+			return secrets.Fake{"weather-local-key": "weather-key", "db-password": "hunter2"}, nil
+		},
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, syncer.sync(context.Background(), latest.ComponentDescription{Name: "frontend"}, &out))
+	assert.Equal(t, 0, backends, "the backend is only connected to for components with secrets")
+
+	app := latest.ComponentDescription{Name: "app", Secrets: []latest.ComponentSecretDescription{
+		{Name: "weather", Keys: map[string]string{"API_KEY": "weather-{{ .WEATHER_ENV }}-key"}},
+		{Name: "db", Type: "kubernetes.io/basic-auth", Keys: map[string]string{"password": "db-password"}},
+		{Name: "prod-only", Keys: map[string]string{"KEY": "missing"}, Environments: []string{"production"}},
+	}}
+	assert.NoError(t, syncer.sync(context.Background(), app, &out))
+	assert.NoError(t, syncer.sync(context.Background(), app, &out))
+	assert.Equal(t, 1, backends)
+	assert.Equal(t, "Created secret `weather`\nCreated secret `db`\nUpdated secret `weather`\nUpdated secret `db`\n", out.String())
+
+	weather, err := syncer.api.Secrets("testns").Get(context.Background(), "weather", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.SecretTypeOpaque, weather.Type)
+	assert.Equal(t, map[string]string{"stack": "testapp", "stack-component": "app"}, weather.Labels)
+	assert.Equal(t, map[string][]byte{"API_KEY": []byte("weather-key")}, weather.Data)
+	db, err := syncer.api.Secrets("testns").Get(context.Background(), "db", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.SecretTypeBasicAuth, db.Type)
+
+	app.Secrets = []latest.ComponentSecretDescription{{Name: "weather", Keys: map[string]string{"API_KEY": "weather-local-key", "UNITS": "weather-units"}}}
+	assert.EqualError(t, syncer.sync(context.Background(), app, &out), "secret `weather` of component `app`: fetching `UNITS`: secret `weather-units` not found")
+	app.Secrets = []latest.ComponentSecretDescription{{Name: "weather"}}
+	assert.EqualError(t, syncer.sync(context.Background(), app, &out), "secret `weather` of component `app` has no keys")
+
+	failing := &componentSecretSyncer{env: "local", newBackend: func(ctx context.Context, env string) (secrets.Backend, error) {
+		return nil, fmt.Errorf("no Vault token found")
+	}}
+	assert.EqualError(t, failing.sync(context.Background(), latest.ComponentDescription{Name: "app", Secrets: []latest.ComponentSecretDescription{{Name: "weather"}}}, &out), "no Vault token found")
+}
+
+func TestStackSecretsBackend(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	dir := buildTestStack(t)
+	config = latest.StackConfig{}
+
+	_, err := stackSecretsBackend(context.Background(), "local")
+	assert.EqualError(t, err, "no secret backend is configured for environment `local`, and `secrets-local.enc.yaml` does not exist - create it with `stack secrets edit local`")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secrets-local.enc.yaml"), []byte("API_KEY: ENC[...]\n"), 0644))
+	backend, err := stackSecretsBackend(context.Background(), "local")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "secrets-local.enc.yaml"), backend.(*secrets.SOPS).Path)
+
+	defer func(f func(context.Context, string, []byte) (secrets.Backend, error)) { newGSMBackend = f }(newGSMBackend)
+	var keys []string
+	newGSMBackend = func(ctx context.Context, project string, key []byte) (secrets.Backend, error) {
+		keys = append(keys, fmt.Sprintf("%v:%s", project, key))
+		return secrets.Fake{}, nil
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "reader.json"), []byte("reader-key"), 0600))
+	config.Secrets.Backends = []latest.SecretBackendDescription{
+		{Environments: []string{"local"}},
+		{Environments: []string{"staging"}, GSM: &latest.GSMBackendDescription{Project: "utmgsmstg", KeyFile: "reader.json"}},
+		{GSM: &latest.GSMBackendDescription{Project: "utmgsm"}},
+	}
+	backend, err = stackSecretsBackend(context.Background(), "local")
+	assert.NoError(t, err)
+	assert.IsType(t, &secrets.SOPS{}, backend, "backends setting no store use the encrypted secrets file")
+	_, err = stackSecretsBackend(context.Background(), "staging")
+	assert.NoError(t, err)
+	_, err = stackSecretsBackend(context.Background(), "production")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"utmgsmstg:reader-key", "utmgsm:"}, keys)
+
+	config.Secrets.Backends = []latest.SecretBackendDescription{{Vault: &latest.VaultBackendDescription{Auth: "ldap"}}}
+	_, err = stackSecretsBackend(context.Background(), "production")
+	assert.EqualError(t, err, "the Vault auth method must be one of token, approle, kubernetes, got `ldap`")
+	config.Secrets.Backends[0].GSM = &latest.GSMBackendDescription{Project: "utmgsm"}
+	_, err = stackSecretsBackend(context.Background(), "production")
+	assert.EqualError(t, err, "the secret backend of environment `production` must set at most one of gsm or vault")
+}
@@ -1,13 +1,119 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"github.com/altiscope/platform-stack/pkg/credentials"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
 	"gotest.tools/v3/golden"
 	"gotest.tools/v3/icmd"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"testing"
 )
 
+func TestRegistrySecretSources(t *testing.T) {
+	dir := buildTestStack(t)
+	defer func(c latest.StackConfig) { config = c }(config)
+	key := `{"type":"service_account","client_email":"puller@stack.iam.gserviceaccount.com"}`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "puller.json"), []byte(key), 0600))
+
+	config = latest.StackConfig{Secrets: latest.SecretsDescription{Registries: []latest.RegistrySecretDescription{
+		{Name: "ghcr", Server: "ghcr.io", UsernamePassword: &latest.UsernamePasswordCredentials{Username: "bot", Password: "{{ .GHCR_TOKEN }}"}},
+		{Name: "gar", Server: "us-docker.pkg.dev", Environments: []string{"production"}, JSONKey: &latest.JSONKeyCredentials{KeyFile: "puller.json"}},
+		{Name: "ecr", ECR: &latest.ECRCredentials{Region: "eu-west-1"}, Environments: []string{"staging"}},
+	}}}
+	sources, err := registrySecretSources("production", []string{"GHCR_TOKEN=token"})
+	assert.NoError(t, err)
+	assert.Len(t, sources, 2)
+	assert.Equal(t, credentials.UsernamePassword{Username: "bot", Password: "token"}, sources[0].provider)
+	assert.Equal(t, credentials.JSONKey{Key: []byte(key)}, sources[1].provider)
+	assert.Equal(t, []string{"ghcr", "ecr"}, registrySecretNames("staging"))
+
+	_, err = registrySecretSources("production", nil)
+	assert.EqualError(t, err, "password of registry secret `ghcr` requires the environment variable `GHCR_TOKEN`, which is not set")
+
+	config.Secrets.Registries = []latest.RegistrySecretDescription{{
+		Name:             "both",
+		UsernamePassword: &latest.UsernamePasswordCredentials{Username: "bot", Password: "token"},
+		DockerConfig:     &latest.DockerConfigCredentials{},
+	}}
+	_, err = registrySecretSources("production", nil)
+	assert.EqualError(t, err, "registry secret `both` must set exactly one of usernamePassword, jsonKey, ecr or dockerConfig")
+
+	config.Secrets.Registries = nil
+	assert.Equal(t, []string{"acr-service-principal"}, registrySecretNames("production"))
+	_, err = registrySecretSources("production", nil)
+	assert.EqualError(t, err, "SERVICE_PRINCIPLE_ID or SERVICE_PRINCIPLE_PASSWORD must be set in order to create a Registry secret")
+}
+
+func TestApplySecret(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	config = latest.StackConfig{Stack: latest.StackDescription{Name: "testapp"}}
+
+	api := fake.NewSimpleClientset().CoreV1()
+	secret, err := registrySecret("acr-service-principal", "testns", "myregistry.azurecr.io", credentials.Credentials{Username: "sp-id", Password: "sp-password"})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.SecretTypeDockerConfigJson, secret.Type)
+	assert.JSONEq(t, `{"auths":{"myregistry.azurecr.io":{"username":"sp-id","password":"sp-password","auth":"c3AtaWQ6c3AtcGFzc3dvcmQ="}}}`, string(secret.Data[".dockerconfigjson"]))
+
+	var out bytes.Buffer
+	assert.NoError(t, applySecret(context.Background(), api, secret, &out))
+	secret, err = registrySecret("acr-service-principal", "testns", "myregistry.azurecr.io", credentials.Credentials{Username: "sp-id", Password: "rotated"})
+	assert.NoError(t, err)
+	assert.NoError(t, applySecret(context.Background(), api, secret, &out))
+	assert.Equal(t, "Created secret `acr-service-principal`\nUpdated secret `acr-service-principal`\n", out.String())
+
+	applied, err := api.Secrets("testns").Get(context.Background(), "acr-service-principal", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"stack": "testapp"}, applied.Labels)
+	assert.Contains(t, string(applied.Data[".dockerconfigjson"]), `"password":"rotated"`)
+
+	opaque := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "acr-service-principal", Namespace: "testns"}, Type: v1.SecretTypeOpaque}
+	err = applySecret(context.Background(), api, opaque, &out)
+	assert.EqualError(t, err, "secret `acr-service-principal` already exists with type `kubernetes.io/dockerconfigjson` - delete it to replace it with a `Opaque` secret")
+}
+
+func TestPrintSecrets(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	config = latest.StackConfig{Stack: latest.StackDescription{Name: "testapp"}}
+
+	api := fake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-env", Namespace: "testns", Labels: map[string]string{"stack": "testapp"}},
+			Type:       v1.SecretTypeOpaque,
+			Data:       map[string][]byte{"TOKEN": []byte("secret-token"), "API_KEY": []byte("secret-key")},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "acr-service-principal", Namespace: "testns", Labels: map[string]string{"stack": "testapp"}},
+			Type:       v1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{".dockerconfigjson": []byte("{}")},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "testns", Labels: map[string]string{"stack": "otherapp"}},
+			Type:       v1.SecretTypeOpaque,
+		},
+	).CoreV1()
+
+	secrets, err := listStackSecrets(context.Background(), api, "testns")
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	printSecrets(secrets, &out)
+	assert.Equal(t, ""+
+		"NAME                            TYPE                                KEYS                                    AGE\n"+
+		"acr-service-principal           kubernetes.io/dockerconfigjson      .dockerconfigjson                       <unknown>\n"+
+		"app-env                         Opaque                              API_KEY,TOKEN                           <unknown>\n",
+		out.String())
+	assert.NotContains(t, out.String(), "secret-token")
+}
+
 func TestSecretsIntegration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -42,3 +148,17 @@ func TestSecretsIntegration(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistryServer(t *testing.T) {
+	assert.Equal(t, "https://airbusutm.azurecr.io", registryServer("airbusutm"))
+	assert.Equal(t, "myregistry.azurecr.io", registryServer("myregistry.azurecr.io"))
+	assert.Equal(t, "localhost:5000", registryServer("localhost:5000"))
+	assert.Equal(t, "ghcr.io/team", registryServer("ghcr.io/team"))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().StringP("registry", "c", "", "")
+	assert.NoError(t, cmd.Flags().Parse([]string{"-c", "myacr"}))
+	server, err := secretRegistry(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://myacr.azurecr.io", server)
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const gitShortCommitTemplate = `git -C "{{ .Directory }}" rev-parse --short HEAD`
+const gitDescribeTemplate = `git -C "{{ .Directory }}" describe --tags --always`
+const gitStatusTemplate = `git -C "{{ .Directory }}" status --porcelain`
+
+const defaultDateTimeFormat = "2006-01-02_15-04-05"
+
+// invalidTagCharacters matches the characters docker does not allow in tags
+var invalidTagCharacters = regexp.MustCompile(`[^\w.-]`)
+
+// tagSources provides the state tag policies are resolved from, so that they can be faked in tests
+type tagSources struct {
+	git     func(commandTemplate string) (string, error)
+	now     func() time.Time
+	environ func() []string
+}
+
+// resolveTag resolves the image tag of a tag policy, or `latest` when no strategy is configured
+func resolveTag(policy latest.TagPolicyDescription, sources tagSources) (tag string, err error) {
+	strategies := 0
+	for _, set := range []bool{policy.GitCommit != nil, policy.GitTag != nil, policy.DateTime != nil, policy.EnvTemplate != nil} {
+		if set {
+			strategies++
+		}
+	}
+	if strategies > 1 {
+		return "", fmt.Errorf("tagPolicy must set only one of gitCommit, gitTag, dateTime or envTemplate")
+	}
+
+	switch {
+	case policy.GitCommit != nil:
+		commandTemplate := gitShortCommitTemplate
+		if policy.GitCommit.Full {
+			commandTemplate = gitCommitTemplate
+		}
+		commit, err := sources.git(commandTemplate)
+		if err != nil {
+			return "", fmt.Errorf("resolving gitCommit tag: %w", err)
+		}
+		tag = policy.GitCommit.Prefix + commit
+	case policy.GitTag != nil:
+		description, err := sources.git(gitDescribeTemplate)
+		if err != nil {
+			return "", fmt.Errorf("resolving gitTag tag: %w", err)
+		}
+		tag = policy.GitTag.Prefix + description
+	case policy.DateTime != nil:
+		format := policy.DateTime.Format
+		if format == "" {
+			format = defaultDateTimeFormat
+		}
+		location := time.Local
+		if policy.DateTime.TimeZone != "" {
+			location, err = time.LoadLocation(policy.DateTime.TimeZone)
+			if err != nil {
+				return "", fmt.Errorf("invalid dateTime timezone `%v`: %w", policy.DateTime.TimeZone, err)
+			}
+		}
+		tag = sources.now().In(location).Format(format)
+	case policy.EnvTemplate != nil:
+		tag, err = executeEnvTemplate(fmt.Sprintf("envTemplate `%v`", policy.EnvTemplate.Template), policy.EnvTemplate.Template, sources.environ())
+		if err != nil {
+			return "", err
+		}
+	default:
+		tag = "latest"
+	}
+
+	if policy.DirtyMarker {
+		status, err := sources.git(gitStatusTemplate)
+		if err != nil {
+			return "", fmt.Errorf("checking for uncommitted changes: %w", err)
+		}
+		if status != "" {
+			tag += "-dirty"
+		}
+	}
+
+	tag = invalidTagCharacters.ReplaceAllString(tag, "-")
+	if tag == "" || strings.HasPrefix(tag, ".") || strings.HasPrefix(tag, "-") || len(tag) > 128 {
+		return "", fmt.Errorf("tagPolicy resolved the invalid tag `%v`", tag)
+	}
+	return tag, nil
+}
+
+// stackGit runs a git command template against the stack directory, returning its trimmed output
+func stackGit(commandTemplate string) (string, error) {
+	directory, _ := filepath.Abs(viper.GetString("stack_directory"))
+	gitCmd, err := GenerateCommand(commandTemplate, GitCommitRequest{Directory: directory})
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	gitCmd.Stdout = &stdout
+	gitCmd.Stderr = &stderr
+	if err := gitCmd.Run(); err != nil {
+		return "", fmt.Errorf("%v: %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+var stackTag struct {
+	once sync.Once
+	tag  string
+	err  error
+}
+
+// imageTag returns the tag images are built and deployed with: the imageTag flag when given, or else the stack's tag
+// policy. The policy is resolved once per invocation, so that every image gets the same tag.
+func imageTag(cmd *cobra.Command) (string, error) {
+	if tag, _ := cmd.Flags().GetString("imageTag"); tag != "" {
+		return tag, nil
+	}
+	stackTag.once.Do(func() {
+		stackTag.tag, stackTag.err = resolveTag(config.TagPolicy, tagSources{git: stackGit, now: time.Now, environ: os.Environ})
+	})
+	return stackTag.tag, stackTag.err
+}
+
+// imageValues returns the template values that name the images of the stack's containers in the given environment:
+// `<IMAGE>_IMAGE` for the image reference without a tag and `<IMAGE>_TAG` for its tag, where `<IMAGE>` is the upper
+// cased image name, e.g. STACK_APP_IMAGE for `stack-app`. IMAGE_TAG is set to the tag as well.
+func imageValues(tag, env string) []string {
+	values := []string{fmt.Sprintf("IMAGE_TAG=%v", tag)}
+	seen := map[string]bool{}
+	for _, component := range config.Components {
+		for _, container := range component.Containers {
+			name := imageVariableName(container.Image)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			reference := strings.TrimSuffix(imageReference(container.Image, tag, env), ":"+tag)
+			values = append(values, fmt.Sprintf("%v_IMAGE=%v", name, reference), fmt.Sprintf("%v_TAG=%v", name, tag))
+		}
+	}
+	return values
+}
+
+var invalidVariableCharacters = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// imageVariableName returns the template variable prefix of an image, e.g. TEAM_APP for `team/app`
+func imageVariableName(image string) string {
+	return invalidVariableCharacters.ReplaceAllString(strings.ToUpper(image), "_")
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/altiscope/platform-stack/pkg/schema/latest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestResolveTag(t *testing.T) {
+	clean := map[string]string{
+		gitShortCommitTemplate: "0123abc",
+		gitCommitTemplate:      "0123abcdef0123abcdef0123abcdef0123abcdef",
+		gitDescribeTemplate:    "v1.2.0-3-g0123abc",
+		gitStatusTemplate:      "",
+	}
+	dirty := map[string]string{gitShortCommitTemplate: "0123abc", gitStatusTemplate: " M main.go"}
+	sources := func(git map[string]string) tagSources {
+		return tagSources{
+			git: func(commandTemplate string) (string, error) {
+				output, ok := git[commandTemplate]
+				if !ok {
+					return "", fmt.Errorf("fatal: not a git repository")
+				}
+				return output, nil
+			},
+			now:     func() time.Time { return time.Date(2021, 3, 1, 12, 30, 5, 0, time.UTC) },
+			environ: func() []string { return []string{"RELEASE=2021.03", "TRACK=beta/1"} },
+		}
+	}
+
+	tests := []struct {
+		name   string
+		policy latest.TagPolicyDescription
+		git    map[string]string
+		tag    string
+		err    string
+	}{
+		{"no policy", latest.TagPolicyDescription{}, clean, "latest", ""},
+		{"git commit", latest.TagPolicyDescription{GitCommit: &latest.GitCommitTagger{}}, clean, "0123abc", ""},
+		{"full git commit with prefix", latest.TagPolicyDescription{GitCommit: &latest.GitCommitTagger{Prefix: "sha-", Full: true}}, clean, "sha-0123abcdef0123abcdef0123abcdef0123abcdef", ""},
+		{"git tag", latest.TagPolicyDescription{GitTag: &latest.GitTagTagger{}}, clean, "v1.2.0-3-g0123abc", ""},
+		{"date time", latest.TagPolicyDescription{DateTime: &latest.DateTimeTagger{}}, clean, "2021-03-01_12-30-05", ""},
+		{"date time with format and zone", latest.TagPolicyDescription{DateTime: &latest.DateTimeTagger{Format: "20060102T1504", TimeZone: "America/New_York"}}, clean, "20210301T0730", ""},
+		{"env template", latest.TagPolicyDescription{EnvTemplate: &latest.EnvTemplateTagger{Template: "{{ .RELEASE }}-{{ .TRACK }}"}}, clean, "2021.03-beta-1", ""},
+		{"dirty marker on clean tree", latest.TagPolicyDescription{GitCommit: &latest.GitCommitTagger{}, DirtyMarker: true}, clean, "0123abc", ""},
+		{"dirty marker on dirty tree", latest.TagPolicyDescription{GitCommit: &latest.GitCommitTagger{}, DirtyMarker: true}, dirty, "0123abc-dirty", ""},
+		{"several strategies", latest.TagPolicyDescription{GitCommit: &latest.GitCommitTagger{}, GitTag: &latest.GitTagTagger{}}, clean, "", "tagPolicy must set only one of gitCommit, gitTag, dateTime or envTemplate"},
+		{"not a git repository", latest.TagPolicyDescription{GitTag: &latest.GitTagTagger{}}, map[string]string{}, "", "resolving gitTag tag: fatal: not a git repository"},
+		{"unset env variable", latest.TagPolicyDescription{EnvTemplate: &latest.EnvTemplateTagger{Template: "{{ .UNSET }}"}}, clean, "", "envTemplate `{{ .UNSET }}` requires the environment variable `UNSET`, which is not set"},
+		{"invalid time zone", latest.TagPolicyDescription{DateTime: &latest.DateTimeTagger{TimeZone: "Nowhere/City"}}, clean, "", "invalid dateTime timezone `Nowhere/City`: unknown time zone Nowhere/City"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, err := resolveTag(tt.policy, sources(tt.git))
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.tag, tag)
+		})
+	}
+}
+
+func TestImageValues(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	config = latest.StackConfig{
+		Registry: latest.RegistryDescription{Environments: map[string]string{"staging": "myregistry.azurecr.io"}},
+		Components: []latest.ComponentDescription{
+			{Name: "app", Containers: []latest.ContainerDescription{{Image: "stack-app"}, {Image: "team/worker"}}},
+			{Name: "app-live", Containers: []latest.ContainerDescription{{Image: "stack-app"}}},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"IMAGE_TAG=0123abc",
+		"STACK_APP_IMAGE=stack-app",
+		"STACK_APP_TAG=0123abc",
+		"TEAM_WORKER_IMAGE=team/worker",
+		"TEAM_WORKER_TAG=0123abc",
+	}, imageValues("0123abc", "local"))
+	assert.Equal(t, "STACK_APP_IMAGE=myregistry.azurecr.io/stack-app", imageValues("0123abc", "staging")[1])
+}
@@ -3,31 +3,25 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/altiscope/platform-stack/pkg/apply"
+	"github.com/altiscope/platform-stack/pkg/history"
+	"github.com/altiscope/platform-stack/pkg/render"
 	"github.com/altiscope/platform-stack/pkg/schema/latest"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-const kubectlApplyTemplate = `kubectl apply -f "{{ .YamlFile }}"`
-
-const kubetplRenderTemplate = `kubetpl render {{if .Output}} -o {{.OutputFile}} {{end}} --allow-fs-access {{ .Manifest }} {{ range .TemplateConfig }} -i {{.}} {{end}} {{ range .Env }} -s {{.}} {{end}}`
-
-type KubectlApplyRequest struct {
-	YamlFile string
-}
-
-type KubetplRenderRequest struct {
-	Manifest       string
-	TemplateConfig []string
-	Env            []string
-	OutputFile     string
-	Output         bool
-}
+// defaultReadinessTimeoutSeconds bounds how long dependents wait on a component when no `--wait` period is given
+const defaultReadinessTimeoutSeconds = 300
 
 // upCmd represents the up command
 var upCmd = &cobra.Command{
@@ -35,7 +29,20 @@ var upCmd = &cobra.Command{
 	Short: "Brings up components of the stack.",
 	Long: `Brings up components of the stack.
 
-If no components are provided as arguments, all configured components will be brought up.'`,
+If no components are provided as arguments, all configured components will be brought up.'
+
+Applied objects are recorded in an inventory ConfigMap for the stack and environment. With --prune, objects recorded by
+earlier runs that are no longer rendered are deleted, including those of components removed from the configuration
+when no components are given.
+
+With --images build.json, images are named as in a report written by 'stack build --report' rather than by the
+stack's tagPolicy. Images the report has a digest for are deployed by digest, with <IMAGE>_TAG set to
+'<tag>@<digest>' and <IMAGE>_DIGEST to the digest.
+
+With --pin-digests, every container image of the rendered manifests is deployed by the digest it currently has in its
+registry, or in the local docker daemon when the registry cannot be reached or has no such image, e.g. 'app:v1' is
+deployed as 'app:v1@sha256:...'. The pinned references are recorded in the component's revision, so that
+'stack rollback' re-deploys exactly the same images.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		err := viper.BindPFlag("wait", cmd.Flags().Lookup("wait"))
 		if err != nil {
@@ -45,6 +52,14 @@ If no components are provided as arguments, all configured components will be br
 		if err != nil {
 			return err
 		}
+		err = viper.BindPFlag("prune", cmd.Flags().Lookup("prune"))
+		if err != nil {
+			return err
+		}
+		// rendering happens in-process, so a dry run needs no cluster access
+		if viper.GetBool("dryrun") {
+			return nil
+		}
 		return initK8s("")
 	},
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
@@ -93,33 +108,18 @@ func upComponents(cmd *cobra.Command, args []string) (err error) {
 
 	dryrun := viper.GetBool("dryrun")
 
-	// Bring up each configured component
-	for _, component := range upComponents {
-		if !dryrun {
-			if !envsApply(component.Environments, currentEnv.Name) {
-				fmt.Printf("skipping `up` for component `%v`: not in active environment\n", component.Name)
-				continue
-			}
-			fmt.Println("Bringing up", component.Name)
-		}
-		err := componentUpFunction(cmd, component, currentEnv)
+	var inv *componentInventory
+	if !dryrun {
+		inv, err = loadComponentInventory(context.Background(), stackInventoryStore(), currentEnv)
 		if err != nil {
-			fmt.Printf("Bringing up `%v` failed", component.Name)
 			return err
 		}
 	}
 
-	wait := viper.GetInt("wait")
-	if wait >= 0 {
-		waitTime := wait * 1000
-		api := clientset.CoreV1()
-		err, ctx := waitForStackWithTimeout(api, cmd, time.Duration(waitTime))
-		if err != nil {
-			return err
-		}
-		if ctx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("timed out waiting for stack")
-		}
+	// Bring up each configured component, dependencies first
+	err = upComponentGraph(cmd, upComponents, currentEnv, inv, os.Stdout)
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -146,98 +146,271 @@ func upAllComponents(cmd *cobra.Command, args []string) (err error) {
 
 	dryrun := viper.GetBool("dryrun")
 
-	// Bring up each configured component
-	for _, component := range upComponents {
-		if !dryrun {
-			if !envsApply(component.Environments, currentEnv.Name) {
-				fmt.Printf("skipping `up` for component `%v`: not in active environment\n", component.Name)
-				continue
-			}
-			fmt.Println("Bringing up", component.Name)
-		}
-		err := componentUpFunction(cmd, component, currentEnv)
+	var inv *componentInventory
+	if !dryrun {
+		inv, err = loadComponentInventory(context.Background(), stackInventoryStore(), currentEnv)
 		if err != nil {
-			fmt.Printf("Bringing up `%v` failed", component.Name)
 			return err
 		}
 	}
 
-	wait := viper.GetInt("wait")
-	if wait >= 0 {
-		waitTime := wait * 1000
-		api := clientset.CoreV1()
-		err, ctx := waitForStackWithTimeout(api, cmd, time.Duration(waitTime))
+	// Bring up each configured component, dependencies first
+	err = upComponentGraph(cmd, upComponents, currentEnv, inv, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	// components removed from the configuration are only known to the inventory
+	if inv != nil && viper.GetBool("prune") {
+		for _, name := range unconfiguredComponents(inv, config.Components) {
+			if err := pruneComponent(context.Background(), inv, stackApplier(), name, os.Stdout); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// upComponentGraph brings up components in dependency order. Independent components are brought up concurrently, and
+// components with dependents are waited on until their workloads have rolled out before their dependents start.
+// With `--wait`, every component is waited on.
+// Output is buffered per component and written in topological order so that it reads the same on every run.
+// Applied objects are recorded in inv, which is nil for dry runs, and each component brought up is recorded as a new revision.
+func upComponentGraph(cmd *cobra.Command, components []latest.ComponentDescription, currentEnv latest.EnvironmentDescription, inv *componentInventory, out io.Writer) (err error) {
+	graph, err := newComponentGraph(components, config.Components)
+	if err != nil {
+		return err
+	}
+	images, err := stackImageValues(cmd, currentEnv.Name)
+	if err != nil {
+		return err
+	}
+
+	dryrun := viper.GetBool("dryrun")
+	prune := viper.GetBool("prune")
+	waitAll := viper.GetInt("wait") >= 0
+	ordered := graph.topologicalOrder()
+	var revisions *history.Store
+	if inv != nil {
+		revisions = stackHistoryStore()
+	}
+	var pinner *digestPinner
+	if pin, _ := cmd.Flags().GetBool("pin-digests"); pin {
+		pinner = newDigestPinner()
+	}
+	var secretSyncer *componentSecretSyncer
+	if !dryrun {
+		secretSyncer = newComponentSecretSyncer(currentEnv.Name)
+	}
+	output := newOrderedOutput(ordered, out)
+	defer output.flush()
+
+	upComponent := func(ctx context.Context, component latest.ComponentDescription) error {
+		defer output.complete(component.Name)
+		componentOut := output.writer(component.Name)
+		if !dryrun {
+			if !envsApply(component.Environments, currentEnv.Name) {
+				_, _ = fmt.Fprintf(componentOut, "skipping `up` for component `%v`: not in active environment\n", component.Name)
+				if prune {
+					return pruneComponent(ctx, inv, stackApplier(), component.Name, componentOut)
+				}
+				return nil
+			}
+			_, _ = fmt.Fprintln(componentOut, "Bringing up", component.Name)
+			if err := secretSyncer.sync(ctx, component, componentOut); err != nil {
+				_, _ = fmt.Fprintf(componentOut, "Bringing up `%v` failed", component.Name)
+				return err
+			}
+		}
+		objects, manifests, pinned, err := componentUpFunction(ctx, cmd, component, currentEnv, images, pinner, componentOut)
+		if inv != nil {
+			// objects applied before a failure are recorded too, but nothing is pruned until the whole component applies
+			recordErr := recordComponent(ctx, inv, stackApplier(), component.Name, objects, prune && err == nil, componentOut)
+			if recordErr == nil {
+				revision := newRevision(component.Name, currentEnv, manifests, objects, err)
+				revision.PinnedImages = pinned
+				recordErr = recordRevision(ctx, revisions, revision)
+			}
+			if err == nil {
+				err = recordErr
+			}
+		}
 		if err != nil {
+			_, _ = fmt.Fprintf(componentOut, "Bringing up `%v` failed", component.Name)
 			return err
 		}
-		if ctx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("timed out waiting for stack")
+		if dryrun || !(waitAll || graph.hasDependents(component.Name)) {
+			return nil
 		}
+		_, _ = fmt.Fprintf(componentOut, "Waiting for `%v` to be ready\n", component.Name)
+		return waitForRollout(ctx, objects, readinessTimeout(), componentOut)
 	}
 
-	return nil
+	// dry runs only render, so there is nothing to gain from running them concurrently
+	if dryrun {
+		for _, component := range ordered {
+			if err := upComponent(context.Background(), component); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return graph.walk(context.Background(), upComponent)
 }
 
-func componentUpFunction(cmd *cobra.Command, component latest.ComponentDescription, stackEnv latest.EnvironmentDescription) (err error) {
+// readinessTimeout is the time allowed for the workloads of a component to roll out
+func readinessTimeout() time.Duration {
+	wait := viper.GetInt("wait")
+	if wait < 0 {
+		wait = defaultReadinessTimeoutSeconds
+	}
+	return time.Duration(wait) * time.Second
+}
 
-	absoluteProjectDirectory, _ := filepath.Abs(viper.GetString("stack_directory"))
-	requiredVariables := component.RequiredVariables
-	envOverrides, _ := cmd.Flags().GetStringSlice("env")
+// componentUpFunction renders and applies the manifests of a component with the given image values, pinning their images
+// to digests if a pinner is given, and returns the applied objects, the rendered manifests and the image references that were pinned
+func componentUpFunction(ctx context.Context, cmd *cobra.Command, component latest.ComponentDescription, stackEnv latest.EnvironmentDescription, images []string, pinner *digestPinner, out io.Writer) (applied []*unstructured.Unstructured, manifests []history.Manifest, pinned map[string]string, err error) {
 
 	for _, manifest := range component.Manifests {
-		manifestName := strings.TrimSuffix(filepath.Base(manifest), filepath.Ext(manifest))
-		manifestPath := filepath.Join(absoluteProjectDirectory, manifest)
-		manifestDirectory := filepath.Dir(manifestPath)
-		outputYamlFile := fmt.Sprintf("%v/%v-generated.yaml", manifestDirectory, manifestName)
-
-		envs, err := generateEnvs(requiredVariables, os.Getenv)
+		rendered, err := renderManifest(cmd, component, manifest, stackEnv, images)
 		if err != nil {
-			return err
+			return applied, manifests, pinned, err
 		}
-		envs = append(envs, envOverrides...)
-
-		// if a componet does not have config specified, try to find the magic template config
-		cf := component.TemplateConfig
-		if len(cf) == 0 {
-			cf = []string{fmt.Sprintf("%v/config-%v.env", manifestDirectory, stackEnv.Name)}
+		if pinner != nil {
+			var references map[string]string
+			rendered, references, err = pinner.pinManifest(ctx, rendered)
+			if err != nil {
+				return applied, manifests, pinned, fmt.Errorf("pinning the images of `%v`: %w", manifest, err)
+			}
+			if pinned == nil {
+				pinned = map[string]string{}
+			}
+			for reference, digestReference := range references {
+				pinned[reference] = digestReference
+			}
 		}
 
 		dryrun := viper.GetBool("dryrun")
-		generateYamlCmd, err := GenerateCommand(kubetplRenderTemplate, KubetplRenderRequest{
-			Manifest:       fmt.Sprintf("%v/%v.yaml", manifestDirectory, manifestName),
-			TemplateConfig: cf,
-			Env:            envs,
-			OutputFile:     outputYamlFile,
-			Output:         !dryrun,
-		})
+		if dryrun {
+			_, _ = out.Write(rendered)
+			continue
+		}
+		manifests = append(manifests, history.Manifest{Path: manifest, Content: string(rendered)})
+
+		objects, err := applyManifest(manifest, rendered, out)
+		applied = append(applied, objects...)
 		if err != nil {
-			return err
+			return applied, manifests, pinned, err
 		}
+	}
 
-		// todo: remove env append if able
-		generateYamlCmd.Env = append(os.Environ())
-		generateYamlCmd.Stdout = os.Stdout
-		generateYamlCmd.Stderr = os.Stderr
-		if err := generateYamlCmd.Run(); err != nil {
-			return err
+	return applied, manifests, pinned, nil
+}
+
+// applyManifest writes a rendered manifest beside its template and applies it to the cluster, returning the objects
+// that applied successfully
+func applyManifest(manifest string, rendered []byte, out io.Writer) (applied []*unstructured.Unstructured, err error) {
+	if err := ioutil.WriteFile(generatedManifestPath(manifest), rendered, 0644); err != nil {
+		return applied, err
+	}
+
+	objects, err := apply.Decode(rendered)
+	if err != nil {
+		return applied, err
+	}
+	results := stackApplier().Apply(context.Background(), objects)
+	for _, result := range results {
+		if result.Err == nil {
+			applied = append(applied, result.Object)
 		}
+	}
+	if failed := apply.PrintResults(results, out); failed > 0 {
+		return applied, fmt.Errorf("%v of %v objects in `%v` failed to apply", failed, len(results), manifest)
+	}
+	return applied, nil
+}
 
-		if !dryrun {
-			applyYamlCmd, err := GenerateCommand(kubectlApplyTemplate, KubectlApplyRequest{
-				YamlFile: outputYamlFile,
-			})
-			if err != nil {
-				return err
-			}
-			applyYamlCmd.Stdout = os.Stdout
-			applyYamlCmd.Stderr = os.Stderr
-			if err := applyYamlCmd.Run(); err != nil {
-				return err
-			}
+// generatedManifestPath returns the path `up` writes the rendered form of a manifest to
+func generatedManifestPath(manifest string) string {
+	absoluteProjectDirectory, _ := filepath.Abs(viper.GetString("stack_directory"))
+	manifestName := strings.TrimSuffix(filepath.Base(manifest), filepath.Ext(manifest))
+	manifestPath := filepath.Join(absoluteProjectDirectory, manifest)
+	manifestDirectory := filepath.Dir(manifestPath)
+	return fmt.Sprintf("%v/%v-generated.yaml", manifestDirectory, manifestName)
+}
+
+// stackImageValues returns the template values naming the images deployed to an environment: those of the stack's
+// tag, overridden by those of the build report given with --images. They are resolved once per run and given to
+// renderManifest for every manifest. Stacks with no tagPolicy get none unless --imageTag or --images is given, so that
+// the image values of their template configs are not replaced by `latest`.
+func stackImageValues(cmd *cobra.Command, env string) ([]string, error) {
+	tagFlag, _ := cmd.Flags().GetString("imageTag")
+	reportPath, _ := cmd.Flags().GetString("images")
+	if tagFlag == "" && reportPath == "" && config.TagPolicy == (latest.TagPolicyDescription{}) {
+		return nil, nil
+	}
+	tag, err := imageTag(cmd)
+	if err != nil {
+		return nil, err
+	}
+	values := imageValues(tag, env)
+	if reportPath != "" {
+		report, err := readBuildReport(reportPath)
+		if err != nil {
+			return nil, err
+		}
+		reported, err := reportImageValues(report, env)
+		if err != nil {
+			return nil, err
 		}
+		values = append(values, reported...)
 	}
+	return values, nil
+}
 
-	return nil
+// renderManifest renders one of the component's manifests with the component's required variables, any `--env`
+// overrides given to cmd, and its template config - defaulting to `config-<environment>.env` beside the manifest. The
+// given image values are defaults, which the template config and overrides take precedence over.
+func renderManifest(cmd *cobra.Command, component latest.ComponentDescription, manifest string, stackEnv latest.EnvironmentDescription, images []string) ([]byte, error) {
+	absoluteProjectDirectory, _ := filepath.Abs(viper.GetString("stack_directory"))
+	manifestPath := filepath.Join(absoluteProjectDirectory, manifest)
+	manifestDirectory := filepath.Dir(manifestPath)
+	envOverrides, _ := cmd.Flags().GetStringSlice("env")
+
+	requiredEnvs, err := generateEnvs(component.RequiredVariables, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	envs := requiredEnvs
+	envs = append(envs, envOverrides...)
+
+	// if a componet does not have config specified, try to find the magic template config
+	cf := component.TemplateConfig
+	if len(cf) == 0 {
+		cf = []string{fmt.Sprintf("%v/config-%v.env", manifestDirectory, stackEnv.Name)}
+	}
+
+	return render.RenderFile(manifestPath, render.Options{
+		Defaults:      images,
+		ConfigFiles:   cf,
+		Values:        envs,
+		AllowFsAccess: true,
+	})
+}
+
+// stackApplier returns an Applier for the current cluster that manages fields on behalf of the configured stack
+func stackApplier() *apply.Applier {
+	fieldManager := config.Stack.Name
+	if fieldManager == "" {
+		fieldManager = "stack"
+	}
+	return &apply.Applier{
+		Client:       dynamicClient,
+		Mapper:       restMapper,
+		FieldManager: fieldManager,
+		Namespace:    currentNamespace,
+	}
 }
 
 // parseComponentArgs generates a list of ComponentDescriptions from the up command's arguments if provided, defaulting
@@ -264,12 +437,12 @@ func parseComponentArgs(args []string, configuredComponents []latest.ComponentDe
 }
 
 // generateEnvs builds a list of environment key value pairs that are hydrated with values obtained from the provided getEnv function.
-// Pairs are given in .env format as `key="value"`.
+// Pairs are given in .env format as `key="value"`, with values quoted so that they are read back unchanged.
 // You can provide `os.Getenv` as the argument to the getEnv parameter to access system variables
 func generateEnvs(requiredVariables []string, getEnv func(string) string) (envs []string, err error) {
 	for _, variable := range requiredVariables {
 		if getEnv(variable) != "" {
-			envs = append(envs, fmt.Sprintf(`%s="%s"`, variable, getEnv(variable)))
+			envs = append(envs, variable+"="+strconv.Quote(getEnv(variable)))
 		} else {
 			return envs, fmt.Errorf("missing environment variable: %v", variable)
 		}
@@ -279,8 +452,12 @@ func generateEnvs(requiredVariables []string, getEnv func(string) string) (envs
 
 func init() {
 	rootCmd.AddCommand(upCmd)
-	upCmd.Flags().IntP("wait", "w", -1, "Stack readiness wait period in seconds")
-	upCmd.Flags().BoolP("dryrun", "d", false, "Generate yaml only, do not kubectl apply")
+	upCmd.Flags().IntP("wait", "w", -1, "Wait up to the given period in seconds for each component's workloads to roll out")
+	upCmd.Flags().BoolP("dryrun", "d", false, "Generate yaml only, do not apply to the cluster")
 	upCmd.Flags().StringSliceP("env", "e", []string{}, "Env variables")
+	upCmd.Flags().String("imageTag", "", "Deploy images with the given tag rather than the one resolved by the stack's tagPolicy")
+	upCmd.Flags().String("images", "", "Deploy the images of a build report written by 'stack build --report', by digest where known")
+	upCmd.Flags().Bool("pin-digests", false, "Deploy every image by the digest it currently has in its registry, or else the docker daemon")
+	upCmd.Flags().Bool("prune", false, "Delete objects previously brought up by the stack that are no longer part of it")
 	upCmd.Flags().Lookup("wait").NoOptDefVal = "300"
 }
@@ -1,13 +1,17 @@
 package cmd
 
 import (
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"testing"
 
+	"github.com/altiscope/platform-stack/pkg/render"
 	"github.com/altiscope/platform-stack/pkg/schema/latest"
 	"github.com/magiconair/properties/assert"
+	"github.com/spf13/cobra"
 	"gotest.tools/v3/golden"
 	"gotest.tools/v3/icmd"
 )
@@ -66,4 +70,55 @@ func TestGenerateEnvs(t *testing.T) {
 	requiredEnvs := []string{"var1", "var2"}
 	generatedEnvs, _ := generateEnvs(requiredEnvs, mockEnv)
 	assert.Equal(t, generatedEnvs, []string{`var1="var1"`, `var2="var2"`})
+
+	values := map[string]string{"WIN_PATH": `C:\path\to`, "PASSWORD": `pa"ss`, "ESCAPE": `line\nnot-a-newline`}
+	generatedEnvs, err := generateEnvs([]string{"WIN_PATH", "PASSWORD", "ESCAPE"}, func(name string) string { return values[name] })
+	assert.Equal(t, err, nil)
+	for _, env := range generatedEnvs {
+		key, value, err := render.ParseValue(env)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, value, values[key], "required variables are rendered unchanged")
+	}
+}
+
+func TestStackApplierFieldManager(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+
+	config = latest.StackConfig{Stack: latest.StackDescription{Name: "testapp"}}
+	assert.Equal(t, "testapp", stackApplier().FieldManager)
+
+	config = latest.StackConfig{}
+	assert.Equal(t, "stack", stackApplier().FieldManager)
+}
+
+func TestRenderManifestImageValues(t *testing.T) {
+	defer func(c latest.StackConfig) { config = c }(config)
+	config = latest.StackConfig{Components: []latest.ComponentDescription{{Name: "app", Containers: []latest.ContainerDescription{{Image: "app"}}}}}
+	dir := buildTestStack(t)
+	manifest := "image: ${APP_IMAGE}:${APP_TAG}\ntag: ${IMAGE_TAG}\n"
+	assert.Equal(t, ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte(manifest), 0644), nil)
+	assert.Equal(t, ioutil.WriteFile(filepath.Join(dir, "config-local.env"), []byte("APP_IMAGE=app\nAPP_TAG=v1.2.0\nIMAGE_TAG=v1.2.0\n"), 0644), nil)
+	component := latest.ComponentDescription{Name: "app", Manifests: []string{"app.yaml"}}
+	env := latest.EnvironmentDescription{Name: "local"}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().StringSlice("env", []string{}, "")
+	cmd.Flags().String("imageTag", "", "")
+	cmd.Flags().String("images", "", "")
+	images, err := stackImageValues(cmd, env.Name)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(images), 0, "stacks without a tagPolicy get no image values")
+
+	assert.Equal(t, cmd.Flags().Set("imageTag", "v2.0.0"), nil)
+	images, err = stackImageValues(cmd, env.Name)
+	assert.Equal(t, err, nil)
+	rendered, err := renderManifest(cmd, component, "app.yaml", env, images)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(rendered), "image: app:v1.2.0\ntag: v1.2.0\n", "the template config overrides image values")
+
+	assert.Equal(t, ioutil.WriteFile(filepath.Join(dir, "config-local.env"), []byte("APP_TAG=v1.2.0\n"), 0644), nil)
+	assert.Equal(t, cmd.Flags().Set("env", "APP_TAG=v1.3.0"), nil)
+	rendered, err = renderManifest(cmd, component, "app.yaml", env, images)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(rendered), "image: app:v1.3.0\ntag: v2.0.0\n")
 }